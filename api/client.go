@@ -4,6 +4,7 @@ package api
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
@@ -39,6 +40,7 @@ type Client struct {
 	closed                       bool
 	traceLvl                     string
 	traceToken                   string
+	jobSigningKey                *ecdsa.PublicKey
 }
 
 func (c *Client) UrlFor(args ...string) (*url.URL, error) {
@@ -60,6 +62,24 @@ func (c *Client) TraceToken(t string) {
 	c.traceToken = t
 }
 
+// PinJobSigningKey makes the Client refuse the actions of any Job
+// that were not signed by the private half of key, which is in the
+// form that the .JobSigningKey template helper renders.  This guards
+// the machine agent against a proxy or a man in the middle that can
+// present a trusted certificate.  An empty key turns checking off.
+func (c *Client) PinJobSigningKey(key string) error {
+	if key == "" {
+		c.jobSigningKey = nil
+		return nil
+	}
+	pub, err := models.ParseJobSigningKey(key)
+	if err != nil {
+		return err
+	}
+	c.jobSigningKey = pub
+	return nil
+}
+
 // R encapsulates a single Request/Response round trip.  It has a slew
 // of helper methods that can be chained together to handle all common
 // operations with this API.  It handles capturing any errors that may
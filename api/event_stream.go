@@ -111,7 +111,20 @@ func (r *RecievedEvent) matches(registration string) bool {
 		(tak[2] == r.E.Key || tak[2] == "*")
 }
 
+const (
+	// eventPollInterval is how often WaitFor checks on the object it
+	// is waiting for while the EventStream is not connected.
+	eventPollInterval = 10 * time.Second
+	// maxEventBackoff is the longest an EventStream waits between
+	// attempts to reconnect.
+	maxEventBackoff = 30 * time.Second
+)
+
 // EventStream recieves events from the digitalrebar provider.  You can read recieved events by reading from its Events channel.
+//
+// If the websocket connection is lost, the EventStream reconnects and
+// registers all of its subscriptions again.  Events sent while it was
+// not connected are lost.
 type EventStream struct {
 	client        *Client
 	handleId      int64
@@ -119,21 +132,102 @@ type EventStream struct {
 	subscriptions map[string][]int64
 	recievers     map[int64]chan RecievedEvent
 	mux           *sync.Mutex
+	// generation counts the times the EventStream has connected.
+	generation int64
+	// closed is set once Close is called, after which the
+	// EventStream stops reconnecting.
+	closed bool
+	quit   chan struct{}
+}
+
+// connected reports whether the EventStream has a connection, and how
+// many times it has connected.
+func (es *EventStream) connected() (bool, int64) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	return es.conn != nil, es.generation
+}
+
+// reconnect connects the EventStream again and registers all of its
+// subscriptions.  It keeps trying until it succeeds or the
+// EventStream is closed, and reports whether it succeeded.
+func (es *EventStream) reconnect() bool {
+	backoff := time.Second
+	for {
+		es.mux.Lock()
+		closed := es.closed || es.client.closed
+		es.mux.Unlock()
+		if closed {
+			return false
+		}
+		conn, err := es.client.ws()
+		if err == nil {
+			es.mux.Lock()
+			for evt, handles := range es.subscriptions {
+				if len(handles) == 0 {
+					continue
+				}
+				if err = conn.WriteMessage(websocket.TextMessage, []byte("register "+evt)); err != nil {
+					break
+				}
+			}
+			if err == nil && !es.closed {
+				es.conn = conn
+				es.generation++
+				es.mux.Unlock()
+				return true
+			}
+			es.mux.Unlock()
+			conn.Close()
+		}
+		select {
+		case <-es.quit:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxEventBackoff {
+			backoff = maxEventBackoff
+		}
+	}
+}
+
+// finish hands err to every reciever and closes them.
+func (es *EventStream) finish(err error) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	for handle, reciever := range es.recievers {
+		reciever <- RecievedEvent{Err: err}
+		close(reciever)
+		delete(es.recievers, handle)
+	}
 }
 
 func (es *EventStream) processEvents(running chan struct{}) {
 	close(running)
 	for {
-		_, msg, err := es.conn.ReadMessage()
+		es.mux.Lock()
+		conn := es.conn
+		es.mux.Unlock()
+		if conn == nil {
+			if !es.reconnect() {
+				es.finish(fmt.Errorf("Event stream closed"))
+				return
+			}
+			continue
+		}
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			es.conn.Close()
+			conn.Close()
 			es.mux.Lock()
-			for _, reciever := range es.recievers {
-				reciever <- RecievedEvent{Err: err}
-				close(reciever)
-			}
+			es.conn = nil
+			closed := es.closed
 			es.mux.Unlock()
-			return
+			if closed {
+				es.finish(err)
+				return
+			}
+			continue
 		}
 		evt := RecievedEvent{}
 		evt.Err = json.Unmarshal(msg, &evt.E)
@@ -158,29 +252,55 @@ func (es *EventStream) processEvents(running chan struct{}) {
 	}
 }
 
-// Events creates a new EventStream from the client.
-func (c *Client) Events() (*EventStream, error) {
-	conn, err := c.ws()
-	if err != nil {
-		return nil, err
-	}
+func (c *Client) newEventStream(conn *websocket.Conn) *EventStream {
 	res := &EventStream{
 		client:        c,
 		conn:          conn,
 		subscriptions: map[string][]int64{},
 		recievers:     map[int64]chan RecievedEvent{},
 		mux:           &sync.Mutex{},
+		quit:          make(chan struct{}),
+	}
+	if conn != nil {
+		res.generation = 1
 	}
 	running := make(chan struct{})
 	go res.processEvents(running)
 	<-running
-	return res, nil
+	return res
+}
+
+// Events creates a new EventStream from the client.
+func (c *Client) Events() (*EventStream, error) {
+	conn, err := c.ws()
+	if err != nil {
+		return nil, err
+	}
+	return c.newEventStream(conn), nil
+}
+
+// retryingEvents is like Events, except that if the websocket cannot
+// be reached, it returns an EventStream that keeps trying to connect
+// in the background instead of failing.  Until it does, WaitFor polls.
+func (c *Client) retryingEvents() *EventStream {
+	conn, _ := c.ws()
+	return c.newEventStream(conn)
 }
 
 // Close closes down the EventStream.  You should drain the Events
 // until you read a RecievedEvent that has an empty E and a non-nil
 // Err
 func (es *EventStream) Close() error {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	if es.closed {
+		return nil
+	}
+	es.closed = true
+	close(es.quit)
+	if es.conn == nil {
+		return nil
+	}
 	return es.conn.WriteMessage(websocket.CloseMessage,
 		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 }
@@ -204,7 +324,9 @@ func (es *EventStream) subscribe(handle int64, events ...string) error {
 			copy(handles[idx+1:], handles[idx:])
 			handles[idx] = handle
 		}
-		if es.subscriptions[evt] == nil {
+		// While the EventStream is not connected, the
+		// subscription is registered when it reconnects.
+		if es.subscriptions[evt] == nil && es.conn != nil {
 			if err := es.conn.WriteMessage(websocket.TextMessage, []byte("register "+evt)); err != nil {
 				return err
 			}
@@ -263,7 +385,9 @@ func (es *EventStream) Deregister(handle int64) error {
 		handles = handles[:len(handles)-1]
 		es.subscriptions[evt] = handles
 		if len(handles) == 0 {
-			es.conn.WriteMessage(websocket.TextMessage, []byte("deregister "+evt))
+			if es.conn != nil {
+				es.conn.WriteMessage(websocket.TextMessage, []byte("deregister "+evt))
+			}
 			es.subscriptions[evt] = nil
 		}
 	}
@@ -277,6 +401,11 @@ func (es *EventStream) Deregister(handle int64) error {
 // in question, and returns a string indicating whether the match
 // succeeded, failed, or timed out.
 //
+// The object in each event is tested first, and item is only fetched
+// again when that matches, so that waiting costs the API nothing until
+// something happens.  While the EventStream is not connected, item is
+// fetched every eventPollInterval instead.
+//
 // The API for this function is subject to refactoring and change, and
 // should not be considered to be stable yet.
 func (es *EventStream) WaitFor(
@@ -308,24 +437,48 @@ func (es *EventStream) WaitFor(
 		}
 	}()
 
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+	_, generation := es.connected()
+	fetch := true
 	for {
-		if err := es.client.FillModel(item, id); err != nil {
-			return fmt.Sprintf("fill: %v", err), err
-		}
-		found, err := test(item)
-		if found && err == nil {
-			return "complete", nil
-		}
-		if err != nil {
-			return fmt.Sprintf("test: %v", err), err
+		if fetch {
+			if err := es.client.FillModel(item, id); err != nil {
+				return fmt.Sprintf("fill: %v", err), err
+			}
+			found, err := test(item)
+			if found && err == nil {
+				return "complete", nil
+			}
+			if err != nil {
+				return fmt.Sprintf("test: %v", err), err
+			}
+			fetch = false
 		}
 		select {
-		case evt := <-ch:
-			if evt.Err != nil {
+		case evt, ok := <-ch:
+			if !ok {
+				err := fmt.Errorf("Event stream closed")
 				return fmt.Sprintf("read: %v", err), err
 			}
-			if err != nil {
-				return fmt.Sprintf("read: %v", err), err
+			if evt.Err != nil {
+				return fmt.Sprintf("read: %v", evt.Err), evt.Err
+			}
+			// Events can arrive out of order, so a match is only
+			// trusted once it has been fetched.
+			obj := models.Clone(item)
+			if err := utils.Remarshal(evt.E.Object, obj); err != nil {
+				fetch = true
+			} else if found, _ := test(obj); found {
+				fetch = true
+			}
+		case <-poll.C:
+			// Events may have been missed while the EventStream
+			// was not connected.
+			up, g := es.connected()
+			if !up || g != generation {
+				generation = g
+				fetch = true
 			}
 		case <-interrupt:
 			return "interrupt", nil
@@ -124,3 +124,50 @@ Validated: true
 
 	session.Req().Delete(machine1)
 }
+
+func TestEventsReconnect(t *testing.T) {
+	listener, err := session.Events()
+	if err != nil {
+		t.Errorf("Failed to create EventStream: %v", err)
+		return
+	}
+	defer listener.Close()
+	handle, ch, err := listener.Register("zaphod.*.*")
+	defer listener.Deregister(handle)
+	if err != nil {
+		t.Errorf("Failed to register for zaphod events: %v", err)
+		return
+	}
+	// Drop the connection out from under the EventStream.
+	listener.mux.Lock()
+	listener.conn.Close()
+	listener.mux.Unlock()
+	for i := 0; i < 50; i++ {
+		if up, g := listener.connected(); up && g > 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if up, g := listener.connected(); !up || g != 2 {
+		t.Errorf("EventStream should have reconnected: %v %d", up, g)
+		return
+	}
+	evt := &models.Event{
+		Time:   time.Now(),
+		Type:   "zaphod",
+		Action: "created",
+		Key:    "foo",
+	}
+	if err := session.PostEvent(evt); err != nil {
+		t.Errorf("Failed to create new Event: %v", err)
+		return
+	}
+	select {
+	case recieved := <-ch:
+		if recieved.Err != nil || recieved.E.Type != "zaphod" {
+			t.Errorf("Expected a zaphod event, got %#v", recieved)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Subscriptions should have been registered again after reconnecting")
+	}
+}
@@ -32,6 +32,18 @@ func TestInfo(t *testing.T) {
 					Name:  "subnets.count",
 					Count: 0,
 				},
+				{
+					Name:  "render.cache.hits",
+					Count: 0,
+				},
+				{
+					Name:  "render.cache.misses",
+					Count: 0,
+				},
+				{
+					Name:  "render.cache.entries",
+					Count: 0,
+				},
 			},
 			Arch:    runtime.GOARCH,
 			Os:      runtime.GOOS,
@@ -4,6 +4,9 @@ package api
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,12 +14,15 @@ import (
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/VictorLowther/jsonpatch2/utils"
+	"github.com/digitalrebar/provision"
 	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
 )
 
 // JobLog gets the log for a specific Job and writes it to the passed
@@ -25,11 +31,56 @@ func (c *Client) JobLog(j *models.Job, dst io.Writer) error {
 	return c.Req().UrlFor("jobs", j.Key(), "log").Do(dst)
 }
 
+// FollowJobLog writes the log for a specific Job to the passed
+// io.Writer as it is written, until the Job is no longer created or
+// running.
+func (c *Client) FollowJobLog(j *models.Job, dst io.Writer) error {
+	return c.Req().UrlFor("jobs", j.Key(), "log").Params("follow", "true").Do(dst)
+}
+
 // JobActions returns the expanded list of templates that should be
-// written or executed for a specific Job.
+// written or executed for a specific Job.  If a job signing key has
+// been pinned with PinJobSigningKey, the actions must all carry a
+// valid signature.
 func (c *Client) JobActions(j *models.Job) ([]*models.JobAction, error) {
 	res := []*models.JobAction{}
-	return res, c.Req().UrlFor("jobs", j.Key(), "actions").Do(&res)
+	if err := c.Req().UrlFor("jobs", j.Key(), "actions").Do(&res); err != nil {
+		return res, err
+	}
+	if c.jobSigningKey != nil {
+		if err := models.VerifyJobActions(c.jobSigningKey, j.Uuid, res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// AddJobResults merges results into the Results of a running Job.
+func (c *Client) AddJobResults(j *models.Job, results map[string]interface{}) error {
+	return c.Req().Post(results).UrlFor("jobs", j.Key(), "results").Do(j)
+}
+
+// JobArtifacts lists the artifacts stored for a Job.
+func (c *Client) JobArtifacts(j *models.Job) ([]models.JobArtifact, error) {
+	res := []models.JobArtifact{}
+	return res, c.Req().UrlFor("jobs", j.Key(), "artifacts").Do(&res)
+}
+
+// JobArtifact writes the named artifact of a Job to dst.
+func (c *Client) JobArtifact(j *models.Job, name string, dst io.Writer) error {
+	return c.Req().UrlFor("jobs", j.Key(), "artifacts", name).Do(dst)
+}
+
+// PutJobArtifact stores what it reads from src as the named artifact
+// of a running Job.  If sum is not empty, it is the SHA256 checksum
+// in hex that the artifact must have.
+func (c *Client) PutJobArtifact(j *models.Job, name string, src io.Reader, sum string) (*models.JobArtifact, error) {
+	res := &models.JobArtifact{}
+	req := c.Req().Put(src).UrlFor("jobs", j.Key(), "artifacts", name)
+	if sum != "" {
+		req = req.Params("sha256", sum)
+	}
+	return res, req.Do(res)
 }
 
 // TaskRunner is responsible for expanding templates and running
@@ -53,6 +104,16 @@ type TaskRunner struct {
 	pipeWriter       *io.PipeWriter
 	agentDir, jobDir string
 	logger           io.Writer
+	// If set, the TaskRunner watches it for the Job being cancelled.
+	events *EventStream
+	// If set, the TaskRunner reports its Job in the agent's heartbeats.
+	heartbeat *agentHeartbeat
+	// mux guards cancelled and proc, which are changed when the Job
+	// is cancelled.
+	mux       sync.Mutex
+	cancelled bool
+	// The process running the current action, if any.
+	proc *os.Process
 }
 
 // NewTaskRunner creates a new TaskRunner for the passed-in machine.
@@ -146,19 +207,37 @@ func (r *TaskRunner) Perform(action *models.JobAction, taskDir string) error {
 	}
 	cmd := exec.Command("./" + path.Base(taskFile))
 	cmd.Dir = taskDir
-	cmd.Env = append(os.Environ(), "RS_TASK_DIR="+taskDir, "RS_RUNNER_DIR="+r.agentDir)
+	cmd.Env = append(os.Environ(),
+		"RS_TASK_DIR="+taskDir,
+		"RS_RUNNER_DIR="+r.agentDir,
+		"RS_RESULTS_FILE="+path.Join(taskDir, "results.json"),
+		"RS_ARTIFACTS_DIR="+path.Join(taskDir, "artifacts"))
 	cmd.Stdout = r.in
 	cmd.Stderr = r.in
+	setProcessGroup(cmd)
 	r.Log("Starting command %s\n\n", cmd.Path)
 	if err := cmd.Start(); err != nil {
 		r.Log("Command failed to start: %v", err)
 		return err
 	}
+	r.mux.Lock()
+	r.proc = cmd.Process
+	if r.cancelled {
+		killProcessGroup(r.proc)
+	}
+	r.mux.Unlock()
 	// Wait on the process, not the command to exit.
 	// We don't want to auto-close stdout and stderr,
 	// as we will continue to use them.
 	r.Log("Command running")
 	pState, _ := cmd.Process.Wait()
+	r.mux.Lock()
+	r.proc = nil
+	r.mux.Unlock()
+	if r.Cancelled() {
+		r.Log("Command killed because the job was cancelled")
+		return nil
+	}
 	status := pState.Sys().(syscall.WaitStatus)
 	sane := r.t.HasFeature("sane-exit-codes")
 	if !sane {
@@ -197,6 +276,117 @@ func (r *TaskRunner) Perform(action *models.JobAction, taskDir string) error {
 	return nil
 }
 
+// postResults sends any results the last action wrote to the file
+// named by RS_RESULTS_FILE to dr-provision, and removes the file.
+func (r *TaskRunner) postResults(taskDir string) error {
+	resultsFile := path.Join(taskDir, "results.json")
+	buf, err := ioutil.ReadFile(resultsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	os.Remove(resultsFile)
+	if err != nil {
+		r.Log("Unable to read results from %s: %v", resultsFile, err)
+		return err
+	}
+	results := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &results); err != nil {
+		r.Log("Invalid results in %s: %v", resultsFile, err)
+		return err
+	}
+	if err := r.c.AddJobResults(r.j, results); err != nil {
+		r.Log("Failed to send results: %v", err)
+		return err
+	}
+	r.Log("Sent %d results", len(results))
+	return nil
+}
+
+// sendArtifacts stores every file the last action left in the
+// directory named by RS_ARTIFACTS_DIR as an artifact of the Job, and
+// removes it.
+func (r *TaskRunner) sendArtifacts(taskDir string) error {
+	artifactDir := path.Join(taskDir, "artifacts")
+	ents, err := ioutil.ReadDir(artifactDir)
+	if err != nil {
+		r.Log("Unable to read artifacts from %s: %v", artifactDir, err)
+		return err
+	}
+	for _, ent := range ents {
+		if !ent.Mode().IsRegular() {
+			continue
+		}
+		name := path.Join(artifactDir, ent.Name())
+		if err := r.sendArtifact(name); err != nil {
+			r.Log("Failed to send artifact %s: %v", ent.Name(), err)
+			return err
+		}
+		os.Remove(name)
+	}
+	return nil
+}
+
+// sendArtifact stores the file name as an artifact of the Job, along
+// with its checksum so that dr-provision can tell if it was damaged on
+// the way.
+func (r *TaskRunner) sendArtifact(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	a, err := r.c.PutJobArtifact(r.j, path.Base(name), f, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	r.Log("Sent artifact %s (%d bytes, sha256 %s)", a.Name, a.Size, a.Sha256)
+	return nil
+}
+
+// Cancelled reports whether the Job was cancelled while it was running.
+func (r *TaskRunner) Cancelled() bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.cancelled
+}
+
+// cancel kills the running action, if any, and keeps any more from
+// being started.
+func (r *TaskRunner) cancel() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cancelled = true
+	if r.proc != nil {
+		if err := killProcessGroup(r.proc); err != nil {
+			r.Log("Failed to kill command: %v", err)
+		}
+	}
+}
+
+// watchCancel cancels the TaskRunner when the Job is cancelled.  The
+// cancellation arrives as a machines.cancel event for the Machine
+// carrying the cancelled Job.
+func (r *TaskRunner) watchCancel(ch <-chan RecievedEvent) {
+	for evt := range ch {
+		if evt.Err != nil {
+			continue
+		}
+		j := &models.Job{}
+		if err := utils.Remarshal(evt.E.Object, j); err != nil || !uuid.Equal(j.Uuid, r.j.Uuid) {
+			continue
+		}
+		r.Log("Job %s was cancelled", r.j.Key())
+		r.cancel()
+	}
+}
+
 // Run loops over all of the actions for a particular job,
 // placing files and executing scripts as appropriate.
 // It also arranges for all logging output for the actions
@@ -207,22 +397,27 @@ func (r *TaskRunner) Run() error {
 		Model: r.j.Prefix(),
 		Key:   r.j.Key(),
 	}
+	if r.heartbeat != nil {
+		r.heartbeat.startJob(r.j)
+		defer r.heartbeat.finishJob(r.j)
+	}
 	// Arrange to log everything to the job log and stderr at the same time.
 	// Due to how io.Pipe works, this should wind up being fairly synchronous.
+	// Whatever each write to the pipe hands us is sent to the job log
+	// right away, so that anyone following the log sees it as it happens.
 	reader, writer := io.Pipe()
 	r.in = io.MultiWriter(writer, r.logger)
 	r.pipeWriter = writer
 	helperWritten := false
 	go func() {
 		defer reader.Close()
-		buf := bytes.NewBuffer(make([]byte, 64*1024))
+		buf := make([]byte, 64*1024)
 		for {
-			count, err := io.CopyN(buf, reader, 64*1024)
+			count, err := reader.Read(buf)
 			if count > 0 {
-				if r.c.Req().Put(buf).UrlFor("jobs", r.j.Key(), "log").Do(nil) != nil {
+				if r.c.Req().Put(bytes.NewReader(buf[:count])).UrlFor("jobs", r.j.Key(), "log").Do(nil) != nil {
 					return
 				}
-				buf.Reset()
 			}
 			if err != nil {
 				return
@@ -242,10 +437,20 @@ func (r *TaskRunner) Run() error {
 		finalErr.AddError(err)
 		return finalErr
 	}
+	defer os.RemoveAll(taskDir)
+	if err := os.Mkdir(path.Join(taskDir, "artifacts"), 0700); err != nil {
+		r.Log("Failed to create local artifacts dir: %v", err)
+		finalErr.AddError(err)
+		return finalErr
+	}
 	// No matter how the function exits, we will try to patch the Job
 	// to an appropriate final state.
-	defer os.RemoveAll(taskDir)
 	defer func() {
+		if r.Cancelled() {
+			// dr-provision has already moved the Job to cancelled
+			// and the machine to not runnable.
+			return
+		}
 		if r.failed || r.reboot || r.stop || r.poweroff || r.incomplete {
 			newM := models.Clone(r.m).(*models.Machine)
 			newM.Runnable = false
@@ -284,6 +489,15 @@ func (r *TaskRunner) Run() error {
 		return finalErr
 	}
 	r.j = obj.(*models.Job)
+	if r.events != nil {
+		handle, ch, err := r.events.Register("machines.cancel." + r.m.Key())
+		if err != nil {
+			r.Log("Failed to watch for job %s being cancelled: %v", r.j.Key(), err)
+		} else {
+			defer r.events.Deregister(handle)
+			go r.watchCancel(ch)
+		}
+	}
 	r.Log("Starting task %s on %s", r.j.Task, r.m.Uuid)
 	// At this point, we are running.
 	actions, err := r.c.JobActions(r.j)
@@ -313,11 +527,20 @@ func (r *TaskRunner) Run() error {
 			}
 			err = r.Perform(action, taskDir)
 			// Contents is a script to run, run it.
+			if err == nil && !r.Cancelled() {
+				if r.postResults(taskDir) != nil || r.sendArtifacts(taskDir) != nil {
+					r.failed = true
+				}
+			}
 		}
 		if err != nil {
 			finalErr.AddError(err)
 			return finalErr
 		}
+		if r.Cancelled() {
+			r.Log("Task %s cancelled", r.j.Task)
+			return nil
+		}
 		r.Log("Action %s finished", action.Name)
 		// If a non-final action sets the incomplete flag, it actually
 		// means early success and stop processing actions for this task.
@@ -345,6 +568,68 @@ func (r *TaskRunner) Run() error {
 	return nil
 }
 
+// parallelStage reports whether the Stage m is in has TaskDeps, in
+// which case dr-provision hands out a Job for every Task that is ready
+// to run instead of one at a time.
+func (c *Client) parallelStage(m *models.Machine) bool {
+	s := &models.Stage{}
+	if err := c.FillModel(s, m.Stage); err != nil {
+		return false
+	}
+	return len(s.TaskDeps) > 0
+}
+
+// runParallel runs the Tasks of a Stage with TaskDeps.  It starts a
+// TaskRunner for every Job dr-provision hands out, and asks for more
+// each time one of them finishes, until there are none left or one of
+// them fails or wants the agent to stop.  It returns the last
+// TaskRunner to finish, or nil if there was nothing to run.
+func (c *Client) runParallel(m *models.Machine, agentDir string, logger io.Writer, events *EventStream, heartbeat *agentHeartbeat) (*TaskRunner, error) {
+	type result struct {
+		runner *TaskRunner
+		err    error
+	}
+	done := make(chan result)
+	running := 0
+	halt := false
+	var last *TaskRunner
+	var finalErr error
+	for {
+		for !halt {
+			runner, err := NewTaskRunner(c, m, agentDir, logger)
+			if err != nil {
+				finalErr = err
+				halt = true
+			}
+			if runner == nil {
+				break
+			}
+			runner.events = events
+			runner.heartbeat = heartbeat
+			running++
+			go func(r *TaskRunner) {
+				done <- result{r, r.Run()}
+			}(runner)
+		}
+		if running == 0 {
+			break
+		}
+		res := <-done
+		running--
+		if last != nil {
+			last.Close()
+		}
+		last = res.runner
+		if res.err != nil && finalErr == nil {
+			finalErr = res.err
+		}
+		if res.err != nil || last.failed || last.reboot || last.stop || last.poweroff || last.incomplete {
+			halt = true
+		}
+	}
+	return last, finalErr
+}
+
 //
 // changeStage takes a machine and attempts to change its stage and set return flags.
 // It will issue reboot if needed and force flags to stop = true
@@ -374,6 +659,21 @@ func (c *Client) changeStage(im *models.Machine, actuallyPowerThings bool, logge
 	}
 	wait = cs.RunnerWait
 
+	// dr-provision moves machines that follow a Workflow from Stage to
+	// Stage on its own, so all we need to do is notice.
+	if m.Workflow != "" {
+		m = models.Clone(im).(*models.Machine)
+		if err = c.FillModel(m, m.Key()); err != nil || m.Stage == currentStage {
+			return
+		}
+		changed = true
+		stop, err = c.enterStage(m, actuallyPowerThings, logger)
+		if stop {
+			wait = false
+		}
+		return
+	}
+
 	var cmObj interface{}
 	csMap := map[string]string{}
 	if csErr := c.Req().Get().UrlForM(m, "params", "change-stage/map").Params("aggregate", "true").Do(&cmObj); csErr == nil {
@@ -433,27 +733,128 @@ func (c *Client) changeStage(im *models.Machine, actuallyPowerThings bool, logge
 		// Reboot implies stopping the runner
 		wait = false
 		stop = true
-		if actuallyPowerThings {
-			var actionObj interface{}
-			if err = c.Req().Get().UrlForM(m, "actions", "nextbootpxe").Do(&actionObj); err == nil {
-				emptyMap := map[string]interface{}{}
-				var results interface{}
-				if err = c.Req().Post(emptyMap).UrlForM(m, "actions", "nextbootpxe").Do(&results); err != nil {
-					return
-				}
-			} else {
-				err = nil
-			}
+		err = c.rebootForStage(m, actuallyPowerThings, logger)
+	}
 
-			if _, err = exec.Command("reboot").Output(); err != nil {
+	return
+}
+
+// rebootForStage reboots the machine so that it can boot into the
+// BootEnv of its new Stage.
+func (c *Client) rebootForStage(m *models.Machine, actuallyPowerThings bool, logger io.Writer) (err error) {
+	if !actuallyPowerThings {
+		fmt.Fprintf(logger, "Would have rebooted on stage change")
+		return nil
+	}
+	var actionObj interface{}
+	if err = c.Req().Get().UrlForM(m, "actions", "nextbootpxe").Do(&actionObj); err == nil {
+		emptyMap := map[string]interface{}{}
+		var results interface{}
+		if err = c.Req().Post(emptyMap).UrlForM(m, "actions", "nextbootpxe").Do(&results); err != nil {
+			return
+		}
+	}
+	_, err = exec.Command("reboot").Output()
+	return
+}
+
+// enterStage handles a machine that dr-provision has moved to a new
+// Stage of its Workflow.  If the new Stage wants a reboot, or moved
+// the machine to a different BootEnv, the machine is rebooted and
+// stop is true.
+func (c *Client) enterStage(m *models.Machine, actuallyPowerThings bool, logger io.Writer) (stop bool, err error) {
+	ns := &models.Stage{Name: m.Stage}
+	if err = c.Req().Fill(ns); err != nil {
+		return
+	}
+	fmt.Fprintf(logger, "Workflow %s moved machine to Stage %s\n", m.Workflow, m.Stage)
+	if !ns.Reboot && m.Runnable {
+		return
+	}
+	return true, c.rebootForStage(m, actuallyPowerThings, logger)
+}
+
+// MachineHeartbeat tells dr-provision that the agent on the Machine is
+// still alive.  hb is updated with what dr-provision recorded.
+func (c *Client) MachineHeartbeat(m *models.Machine, hb *models.MachineHeartbeat) error {
+	return c.Req().Post(hb).UrlFor("machines", m.Key(), "heartbeat").Do(hb)
+}
+
+// agentHeartbeatInterval is how often the Agent sends heartbeats.
+const agentHeartbeatInterval = 30 * time.Second
+
+// agentHeartbeat sends heartbeats for the Agent on a Machine until it
+// is stopped.
+type agentHeartbeat struct {
+	c       *Client
+	m       *models.Machine
+	started time.Time
+	// mux guards jobs, the Jobs the Agent is running, oldest first.
+	mux  sync.Mutex
+	jobs []uuid.UUID
+	quit chan struct{}
+}
+
+func (c *Client) startHeartbeat(m *models.Machine, logger io.Writer) *agentHeartbeat {
+	h := &agentHeartbeat{
+		c:       c,
+		m:       m,
+		started: time.Now(),
+		quit:    make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(agentHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			if err := h.send(); err != nil {
+				fmt.Fprintf(logger, "Failed to send heartbeat: %v\n", err)
+			}
+			select {
+			case <-h.quit:
 				return
+			case <-ticker.C:
 			}
-		} else {
-			fmt.Fprintf(logger, "Would have rebooted on stage change")
 		}
+	}()
+	return h
+}
+
+func (h *agentHeartbeat) send() error {
+	hb := &models.MachineHeartbeat{
+		Version: provision.RS_VERSION,
+		Uptime:  int64(time.Since(h.started) / time.Second),
+	}
+	h.mux.Lock()
+	if len(h.jobs) > 0 {
+		hb.CurrentJob = h.jobs[len(h.jobs)-1]
 	}
+	h.mux.Unlock()
+	return h.c.MachineHeartbeat(h.m, hb)
+}
 
-	return
+// startJob records that the Agent is running j, and lets dr-provision
+// know right away.
+func (h *agentHeartbeat) startJob(j *models.Job) {
+	h.mux.Lock()
+	h.jobs = append(h.jobs, j.Uuid)
+	h.mux.Unlock()
+	h.send()
+}
+
+// finishJob records that the Agent is done with j.
+func (h *agentHeartbeat) finishJob(j *models.Job) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for i := range h.jobs {
+		if uuid.Equal(h.jobs[i], j.Uuid) {
+			h.jobs = append(h.jobs[:i], h.jobs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (h *agentHeartbeat) stop() {
+	close(h.quit)
 }
 
 // Agent runs the machine Agent on the current machine.
@@ -462,14 +863,23 @@ func (c *Client) changeStage(im *models.Machine, actuallyPowerThings bool, logge
 func (c *Client) Agent(m *models.Machine, exitOnNotRunnable, exitOnFailure, actuallyPowerThings bool, logger io.Writer) error {
 	fmt.Fprintf(logger, "Processing jobs for %s: %s\n", m.Key(), time.Now())
 
-	// Clear the current running job, if any
-	currentJob := &models.Job{Uuid: m.CurrentJob}
-	if c.Req().Fill(currentJob) == nil {
-		if currentJob.State == "running" || currentJob.State == "created" {
-			cj := models.Clone(currentJob).(*models.Job)
-			cj.State = "failed"
-			if _, err := c.PatchTo(currentJob, cj); err != nil {
-				return err
+	// Clear the current running job, if any, along with any jobs
+	// that were running in parallel with it.
+	jobIds := []uuid.UUID{m.CurrentJob}
+	for _, id := range m.TaskJobs {
+		if !uuid.Equal(id, m.CurrentJob) {
+			jobIds = append(jobIds, id)
+		}
+	}
+	for _, id := range jobIds {
+		currentJob := &models.Job{Uuid: id}
+		if c.Req().Fill(currentJob) == nil {
+			if currentJob.State == "running" || currentJob.State == "created" {
+				cj := models.Clone(currentJob).(*models.Job)
+				cj.State = "failed"
+				if _, err := c.PatchTo(currentJob, cj); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -481,11 +891,16 @@ func (c *Client) Agent(m *models.Machine, exitOnNotRunnable, exitOnFailure, actu
 		return err
 	}
 	defer os.RemoveAll(runnerDir)
-	events, err := c.Events()
-	if err != nil {
-		return err
+	// Wait for changes to the machine over the event stream rather
+	// than polling for them.  If the stream cannot be reached, the
+	// agent polls until it can.
+	events := c.retryingEvents()
+	if up, _ := events.connected(); !up {
+		fmt.Fprintf(logger, "Event stream unavailable, polling until it comes back\n")
 	}
 	defer events.Close()
+	heartbeat := c.startHeartbeat(m, logger)
+	defer heartbeat.stop()
 
 	if m.HasFeature("original-change-stage") || !m.HasFeature("change-stage-v2") {
 		newM := models.Clone(m).(*models.Machine)
@@ -538,7 +953,16 @@ func (c *Client) Agent(m *models.Machine, exitOnNotRunnable, exitOnFailure, actu
 			return res
 		}
 
-		runner, err = NewTaskRunner(c, m, runnerDir, logger)
+		parallel := c.parallelStage(m)
+		if parallel {
+			runner, err = c.runParallel(m, runnerDir, logger, events, heartbeat)
+		} else {
+			runner, err = NewTaskRunner(c, m, runnerDir, logger)
+			if runner != nil {
+				runner.events = events
+				runner.heartbeat = heartbeat
+			}
+		}
 		if err != nil {
 			return err
 		}
@@ -573,7 +997,8 @@ func (c *Client) Agent(m *models.Machine, exitOnNotRunnable, exitOnFailure, actu
 			// wait here for the task list or the current task to change on the machine
 			found, err := events.WaitFor(m,
 				OrItems(NotItem(EqualItem("CurrentTask", m.CurrentTask)),
-					NotItem(EqualItem("Tasks", m.Tasks))), 1*time.Hour)
+					NotItem(EqualItem("Tasks", m.Tasks)),
+					NotItem(EqualItem("Stage", m.Stage))), 1*time.Hour)
 			if err != nil {
 				res := &models.Error{
 					Type:  "AGENT_WAIT",
@@ -601,8 +1026,25 @@ func (c *Client) Agent(m *models.Machine, exitOnNotRunnable, exitOnFailure, actu
 
 			continue
 		}
-		if err := runner.Run(); err != nil {
-			return err
+		if !parallel {
+			if err := runner.Run(); err != nil {
+				return err
+			}
+		}
+		if m.Workflow != "" {
+			// Finishing the last Task of a Stage, or failing a Task,
+			// can move the machine along its Workflow.
+			stage := m.Stage
+			if err := c.FillModel(m, m.Key()); err != nil {
+				return err
+			}
+			if m.Stage != stage {
+				if stop, err := c.enterStage(m, actuallyPowerThings, logger); err != nil {
+					return err
+				} else if stop {
+					break
+				}
+			}
 		}
 
 		if runner.reboot ||
@@ -0,0 +1,16 @@
+// +build windows
+
+package api
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing, as Windows has no process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills p.  Anything it started is left alone.
+func killProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,177 @@
+package backend
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// keyIndex maps values, such as MACs or Machine UUIDs, to the keys of
+// the objects that have them.
+type keyIndex struct {
+	vals map[string][]string
+	keys map[string]map[string]struct{}
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		vals: map[string][]string{},
+		keys: map[string]map[string]struct{}{},
+	}
+}
+
+// set records that the object with key has vals, replacing what was
+// known about it.
+func (x *keyIndex) set(key string, vals ...string) {
+	x.remove(key)
+	if len(vals) == 0 {
+		return
+	}
+	x.vals[key] = vals
+	for _, val := range vals {
+		if x.keys[val] == nil {
+			x.keys[val] = map[string]struct{}{}
+		}
+		x.keys[val][key] = struct{}{}
+	}
+}
+
+// remove forgets the object with key.
+func (x *keyIndex) remove(key string) {
+	for _, val := range x.vals[key] {
+		delete(x.keys[val], key)
+		if len(x.keys[val]) == 0 {
+			delete(x.keys, val)
+		}
+	}
+	delete(x.vals, key)
+}
+
+// find adds the keys of the objects that have val to res.
+func (x *keyIndex) find(res map[string]struct{}, val string) {
+	for key := range x.keys[val] {
+		res[key] = struct{}{}
+	}
+}
+
+// addressIndex finds the Leases and Reservations for a Machine by its
+// UUID and MACs without scanning all of them.  It is kept up to date
+// from the change events for Leases and Reservations.
+type addressIndex struct {
+	sync.Mutex
+	leaseMACs, leaseMachines             *keyIndex
+	reservationMACs, reservationMachines *keyIndex
+}
+
+func newAddressIndex() *addressIndex {
+	return &addressIndex{
+		leaseMACs:           newKeyIndex(),
+		leaseMachines:       newKeyIndex(),
+		reservationMACs:     newKeyIndex(),
+		reservationMachines: newKeyIndex(),
+	}
+}
+
+func tokenMACs(strategy, token string) []string {
+	if strategy != "MAC" {
+		return nil
+	}
+	return []string{canonicalMAC(token)}
+}
+
+func uuidKeys(id uuid.UUID) []string {
+	if id == nil {
+		return nil
+	}
+	return []string{id.String()}
+}
+
+// set records l or r, whichever is not nil.  The index must be
+// locked.
+func (x *addressIndex) set(l *models.Lease, r *models.Reservation) {
+	if l != nil {
+		x.leaseMACs.set(l.Key(), tokenMACs(l.Strategy, l.Token)...)
+		x.leaseMachines.set(l.Key(), uuidKeys(l.Machine)...)
+	}
+	if r != nil {
+		x.reservationMACs.set(r.Key(), tokenMACs(r.Strategy, r.Token)...)
+		x.reservationMachines.set(r.Key(), uuidKeys(r.Machine)...)
+	}
+}
+
+// update follows action being taken on the Lease or Reservation with
+// key, which is now ref.
+func (x *addressIndex) update(prefix, action, key string, ref interface{}) {
+	x.Lock()
+	defer x.Unlock()
+	switch prefix {
+	case "leases":
+		if l, ok := ref.(*Lease); ok && action != "delete" {
+			x.set(l.Lease, nil)
+			return
+		}
+		x.leaseMACs.remove(key)
+		x.leaseMachines.remove(key)
+	case "reservations":
+		if r, ok := ref.(*Reservation); ok && action != "delete" {
+			x.set(nil, r.Reservation)
+			return
+		}
+		x.reservationMACs.remove(key)
+		x.reservationMachines.remove(key)
+	}
+}
+
+// load replaces what is known about the objects in prefix with objs.
+func (x *addressIndex) load(prefix string, objs []models.Model) {
+	x.Lock()
+	defer x.Unlock()
+	switch prefix {
+	case "leases":
+		x.leaseMACs, x.leaseMachines = newKeyIndex(), newKeyIndex()
+		for _, obj := range objs {
+			x.set(AsLease(obj).Lease, nil)
+		}
+	case "reservations":
+		x.reservationMACs, x.reservationMachines = newKeyIndex(), newKeyIndex()
+		for _, obj := range objs {
+			x.set(nil, AsReservation(obj).Reservation)
+		}
+	}
+}
+
+// lookup returns the sorted keys of the objects that byMachine has
+// for m, or that byMAC has for one of the MACs of m.
+func (x *addressIndex) lookup(byMAC, byMachine *keyIndex, m *models.Machine, macs bool) []string {
+	found := map[string]struct{}{}
+	byMachine.find(found, m.Key())
+	if macs {
+		for _, mac := range machineMACs(m) {
+			byMAC.find(found, mac)
+		}
+	}
+	res := make([]string, 0, len(found))
+	for key := range found {
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// leasesFor returns the keys of the Leases linked to m, and if macs is
+// true, of the ones for the MACs of m.
+func (x *addressIndex) leasesFor(m *models.Machine, macs bool) []string {
+	x.Lock()
+	defer x.Unlock()
+	return x.lookup(x.leaseMACs, x.leaseMachines, m, macs)
+}
+
+// reservationsFor returns the keys of the Reservations linked to m,
+// and if macs is true, of the ones for the MACs of m.
+func (x *addressIndex) reservationsFor(m *models.Machine, macs bool) []string {
+	x.Lock()
+	defer x.Unlock()
+	return x.lookup(x.reservationMACs, x.reservationMachines, m, macs)
+}
@@ -210,7 +210,7 @@ func (b *BootEnv) genRoot(commonRoot *template.Template, e models.ErrorAdder) *t
 		}
 	}
 	if b.BootParams != "" {
-		tmpl, err := template.New("machine").Parse(b.BootParams)
+		tmpl, err := newTemplate("machine").Parse(b.BootParams)
 		if err != nil {
 			e.Errorf("Error compiling boot parameter template: %v", err)
 		} else {
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// bulkChange applies the change described by req to a copy of m.
+func (rt *RequestTracker) bulkChange(m *Machine, req *models.BulkMachineRequest) (*Machine, error) {
+	e := &models.Error{
+		Code:  http.StatusConflict,
+		Type:  "BULK",
+		Model: m.Prefix(),
+		Key:   m.Key(),
+	}
+	nm := &models.Machine{}
+	if len(req.Patch) == 0 {
+		nm = models.Clone(m.Machine).(*models.Machine)
+	} else {
+		buf, err := json.Marshal(m.Machine)
+		if err != nil {
+			e.AddError(err)
+			return nil, e
+		}
+		buf, err, loc := req.Patch.Apply(buf)
+		if err != nil {
+			e.Errorf("Patch error at line %d: %v", loc, err)
+			return nil, e
+		}
+		if err := json.Unmarshal(buf, nm); err != nil {
+			e.AddError(err)
+			return nil, e
+		}
+		if !uuid.Equal(nm.Uuid, m.Uuid) {
+			e.Errorf("Patch may not change the Uuid")
+			return nil, e
+		}
+	}
+	if req.Stage != "" {
+		nm.Stage = req.Stage
+	}
+	for _, p := range req.AddProfiles {
+		found := false
+		for _, have := range nm.Profiles {
+			if have == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			nm.Profiles = append(nm.Profiles, p)
+		}
+	}
+	if len(req.RemoveProfiles) > 0 {
+		profiles := []string{}
+		for _, have := range nm.Profiles {
+			keep := true
+			for _, p := range req.RemoveProfiles {
+				if have == p {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				profiles = append(profiles, have)
+			}
+		}
+		nm.Profiles = profiles
+	}
+	if len(req.Params) > 0 {
+		if nm.Params == nil {
+			nm.Params = map[string]interface{}{}
+		}
+		e.Code = http.StatusUnprocessableEntity
+		e.Type = ValidationError
+		for k, v := range req.Params {
+			for _, msg := range rt.ParamErrors(k, v) {
+				e.Errorf("Key '%s': %s", k, msg)
+			}
+			nm.Params[k] = v
+		}
+		if err := e.HasError(); err != nil {
+			return nil, err
+		}
+	}
+	res := AsMachine(toBackend(nm, rt))
+	if req.Force {
+		res.ForceChange()
+	}
+	return res, nil
+}
+
+// checkChange runs the checks that updating old to n would, and that
+// can be made without saving n or rendering anything for it.
+func (n *Machine) checkChange(rt *RequestTracker, old *Machine) error {
+	n.Fill()
+	n.setRT(rt)
+	defer n.clearRT()
+	n.ClearValidation()
+	if err := n.OnChange(old); err != nil {
+		return err
+	}
+	n.Machine.Validate()
+	for i, p := range n.Profiles {
+		if rt.Find("profiles", p) == nil {
+			n.Errorf("Profile %s (at %d) does not exist", p, i)
+		}
+	}
+	if rt.Find("stages", n.Stage) == nil {
+		n.Errorf("Stage %s does not exist", n.Stage)
+	}
+	if rt.Find("bootenvs", n.BootEnv) == nil {
+		n.Errorf("Bootenv %s does not exist", n.BootEnv)
+	}
+	if n.Workflow != "" && rt.Find("workflows", n.Workflow) == nil {
+		n.Errorf("Workflow %s does not exist", n.Workflow)
+	}
+	for k, v := range n.Params {
+		if ov, ok := old.Params[k]; ok && reflect.DeepEqual(ov, v) {
+			continue
+		}
+		for _, msg := range rt.ParamErrors(k, v) {
+			n.Errorf("Key '%s': %s", k, msg)
+		}
+	}
+	return n.MakeError(http.StatusUnprocessableEntity, ValidationError, n)
+}
+
+// BulkMachines applies the change described by req to every Machine
+// that passes filters, and returns how it went for each of them.  A
+// failure for one Machine does not stop the others from being
+// changed.  The caller must hold the locks needed to update machines.
+func (rt *RequestTracker) BulkMachines(req *models.BulkMachineRequest, filters ...index.Filter) ([]*models.BulkMachineResult, error) {
+	e := &models.Error{
+		Code:  http.StatusBadRequest,
+		Type:  "BULK",
+		Model: "machines",
+	}
+	if len(req.Filter) == 0 {
+		e.Errorf("Filter is required")
+	}
+	if len(req.Patch) == 0 && req.Stage == "" && len(req.AddProfiles) == 0 &&
+		len(req.RemoveProfiles) == 0 && len(req.Params) == 0 {
+		e.Errorf("Nothing to change")
+	}
+	if err := e.HasError(); err != nil {
+		return nil, err
+	}
+	idx, err := index.All(filters...)(&rt.stores("machines").Index)
+	if err != nil {
+		e.AddError(err)
+		return nil, e
+	}
+	res := []*models.BulkMachineResult{}
+	for _, i := range idx.Items() {
+		m := AsMachine(i)
+		r := &models.BulkMachineResult{Machine: m.Uuid, Name: m.Name}
+		res = append(res, r)
+		nm, err := rt.bulkChange(m, req)
+		if err == nil {
+			if req.DryRun {
+				err = nm.checkChange(rt, m)
+			} else {
+				_, err = rt.Update(nm)
+			}
+		}
+		if err != nil {
+			be, ok := err.(*models.Error)
+			if !ok {
+				be = &models.Error{
+					Code:  http.StatusUnprocessableEntity,
+					Type:  ValidationError,
+					Model: m.Prefix(),
+					Key:   m.Key(),
+				}
+				be.AddError(err)
+			}
+			r.Error = be
+			continue
+		}
+		r.Object = nm.Machine
+	}
+	if !req.DryRun {
+		rt.Infof("Bulk change applied to %d Machines", len(res))
+	}
+	return res, nil
+}
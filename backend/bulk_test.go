@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestBulkMachines(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, machineLockMap["update"]...)
+	b1 := &models.Machine{Name: "b1", Uuid: uuid.NewRandom()}
+	b2 := &models.Machine{Name: "b2", Uuid: uuid.NewRandom()}
+	c1 := &models.Machine{Name: "c1", Uuid: uuid.NewRandom()}
+	createTests := []crudTest{
+		{"Create bulk Stage", rt.Create, &models.Stage{Name: "bulk", BootEnv: "local"}, true},
+		{"Create bulk Profile", rt.Create, &models.Profile{Name: "bulk"}, true},
+		{"Create b1", rt.Create, b1, true},
+		{"Create b2", rt.Create, b2, true},
+		{"Create c1", rt.Create, c1, true},
+	}
+	for _, test := range createTests {
+		test.Test(t, rt)
+	}
+	find := func(m *models.Machine) *Machine {
+		return AsMachine(rt.Find("machines", m.UUID()))
+	}
+	filter := map[string]string{"Name": "Between(b1,b2)"}
+	bulk := func(req *models.BulkMachineRequest, fails ...string) {
+		t.Helper()
+		if req.Filter == nil {
+			req.Filter = filter
+		}
+		byName := find(b1).Indexes()["Name"]
+		res, err := rt.BulkMachines(req, index.Sort(byName), index.Between("b1", "b2"))
+		if err != nil {
+			t.Errorf("Bulk change failed: %v", err)
+			return
+		}
+		if len(res) != 2 {
+			t.Errorf("Expected results for 2 Machines, got %d", len(res))
+			return
+		}
+		for _, r := range res {
+			failed := false
+			for _, name := range fails {
+				failed = failed || name == r.Name
+			}
+			if failed && r.Error == nil {
+				t.Errorf("Bulk change should have failed for %s", r.Name)
+			} else if !failed && r.Error != nil {
+				t.Errorf("Bulk change failed for %s: %v", r.Name, r.Error)
+			} else if !failed && (r.Object == nil || !uuid.Equal(r.Object.Uuid, r.Machine)) {
+				t.Errorf("Bulk change did not return %s", r.Name)
+			}
+		}
+	}
+	rt.Do(func(d Stores) {
+		if _, err := rt.BulkMachines(&models.BulkMachineRequest{Stage: "bulk"}); err == nil {
+			t.Errorf("Bulk change without a Filter should have failed")
+		}
+		if _, err := rt.BulkMachines(&models.BulkMachineRequest{Filter: filter}); err == nil {
+			t.Errorf("Bulk change without a change should have failed")
+		}
+		bulk(&models.BulkMachineRequest{Stage: "bulk", AddProfiles: []string{"bulk"}, DryRun: true})
+		bulk(&models.BulkMachineRequest{AddProfiles: []string{"missing"}, DryRun: true}, "b1", "b2")
+		if m := find(b1); m.Stage == "bulk" || len(m.Profiles) != 0 {
+			t.Errorf("A dry run should not change anything")
+		}
+		bulk(&models.BulkMachineRequest{
+			Stage:       "bulk",
+			AddProfiles: []string{"bulk"},
+			Params:      map[string]interface{}{"bulk/param": "set"},
+		})
+		for _, m := range []*models.Machine{b1, b2} {
+			nm := find(m)
+			if nm.Stage != "bulk" || len(nm.Profiles) != 1 || nm.Params["bulk/param"] != "set" {
+				t.Errorf("%s was not changed: %s %v %v", nm.Name, nm.Stage, nm.Profiles, nm.Params)
+			}
+		}
+		if find(c1).Stage == "bulk" {
+			t.Errorf("c1 should not have been changed")
+		}
+		patch := jsonpatch2.Patch{}
+		if err := json.Unmarshal([]byte(`[
+  {"op": "test", "path": "/Name", "value": "b1"},
+  {"op": "replace", "path": "/Description", "value": "patched"}
+]`), &patch); err != nil {
+			t.Fatalf("Failed to parse patch: %v", err)
+		}
+		bulk(&models.BulkMachineRequest{Patch: patch}, "b2")
+		if find(b1).Description != "patched" || find(b2).Description == "patched" {
+			t.Errorf("Only b1 should have been patched")
+		}
+		bulk(&models.BulkMachineRequest{RemoveProfiles: []string{"bulk"}})
+		if len(find(b2).Profiles) != 0 {
+			t.Errorf("The bulk Profile should have been removed from b2")
+		}
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/digitalrebar/logger"
@@ -228,6 +229,14 @@ func Fill(t store.KeySaver) {
 		if obj.User == nil {
 			obj.User = &models.User{}
 		}
+	case *Workflow:
+		if obj.Workflow == nil {
+			obj.Workflow = &models.Workflow{}
+		}
+	case *Rollout:
+		if obj.Rollout == nil {
+			obj.Rollout = &models.Rollout{}
+		}
 	default:
 		panic(fmt.Sprintf("Unknown backend model %T", t))
 	}
@@ -265,6 +274,10 @@ func ModelToBackend(m models.Model) store.KeySaver {
 		return &Template{Template: obj}
 	case *models.User:
 		return &User{User: obj}
+	case *models.Workflow:
+		return &Workflow{Workflow: obj}
+	case *models.Rollout:
+		return &Rollout{Rollout: obj}
 	default:
 		panic(fmt.Sprintf("Unknown model %T", m))
 	}
@@ -430,6 +443,26 @@ func toBackend(m models.Model, rt *RequestTracker) store.KeySaver {
 		res.User = obj
 		res.rt = rt
 		return &res
+	case *models.Workflow:
+		var res Workflow
+		if ours != nil {
+			res = *ours.(*Workflow)
+		} else {
+			res = Workflow{}
+		}
+		res.Workflow = obj
+		res.rt = rt
+		return &res
+	case *models.Rollout:
+		var res Rollout
+		if ours != nil {
+			res = *ours.(*Rollout)
+		} else {
+			res = Rollout{}
+		}
+		res.Rollout = obj
+		res.rt = rt
+		return &res
 
 	default:
 		log.Panicf("Unknown model %T", m)
@@ -503,6 +536,13 @@ type DataTracker struct {
 	thunks              []func()
 	thunkMux            *sync.Mutex
 	publishers          *Publishers
+	renderCache         *renderCache
+	macIndex            *macIndex
+	addressIndex        *addressIndex
+	heartbeats          *heartbeats
+	logMux              *sync.Mutex
+	logWatchers         map[string][]chan struct{}
+	started             time.Time
 }
 
 func (p *DataTracker) LogFor(s string) logger.Logger {
@@ -510,6 +550,18 @@ func (p *DataTracker) LogFor(s string) logger.Logger {
 }
 
 func (p *DataTracker) Publish(prefix, action, key string, ref interface{}) {
+	if p.renderCache != nil {
+		p.renderCache.invalidate(prefix, action, key, ref)
+	}
+	if prefix == "machines" && p.macIndex != nil {
+		p.macIndex.update(action, key, ref)
+	}
+	if prefix == "machines" && p.heartbeats != nil {
+		p.heartbeats.update(action, key)
+	}
+	if p.addressIndex != nil {
+		p.addressIndex.update(prefix, action, key, ref)
+	}
 	if p.publishers != nil {
 		p.publishers.Publish(prefix, action, key, ref)
 	}
@@ -531,12 +583,14 @@ func allKeySavers() []models.Model {
 		&Profile{},
 		&BootEnv{},
 		&Stage{},
-		&Machine{},
+		&Workflow{},
 		&Subnet{},
+		&Machine{},
 		&Reservation{},
 		&Lease{},
 		&Plugin{},
 		&Job{},
+		&Rollout{},
 	}
 }
 
@@ -668,6 +722,18 @@ func (p *DataTracker) rebuildCache(loadRT *RequestTracker) (hard, soft *models.E
 		}
 
 		p.objs[prefix].Index = *index.Create(res)
+		if prefix == "machines" && p.macIndex != nil {
+			p.macIndex = newMacIndex()
+			for _, thing := range res {
+				p.macIndex.set(AsMachine(thing).Machine)
+			}
+		}
+		if prefix == "machines" && p.heartbeats != nil {
+			p.heartbeats.load(res)
+		}
+		if p.addressIndex != nil {
+			p.addressIndex.load(prefix, res)
+		}
 		if prefix == "bootenvs" {
 			for _, thing := range p.objs[prefix].Items() {
 				benv := AsBootEnv(thing)
@@ -683,7 +749,7 @@ func (p *DataTracker) rebuildCache(loadRT *RequestTracker) (hard, soft *models.E
 				tmpl := AsTemplate(thing)
 				fmt.Fprintf(buf, `{{define "%s"}}%s{{end}}`, tmpl.ID, tmpl.Contents)
 			}
-			root, err := template.New("").Parse(buf.String())
+			root, err := newTemplate("").Parse(buf.String())
 			if err != nil {
 				hard.Errorf("Unable to load root templates: %v", err)
 				return
@@ -714,7 +780,12 @@ func ValidateDataTrackerStore(backend store.Store, logger logger.Logger) (hard,
 		GlobalProfileName: "global",
 		thunks:            make([]func(), 0),
 		thunkMux:          &sync.Mutex{},
+		logMux:            &sync.Mutex{},
 		publishers:        &Publishers{},
+		renderCache:       newRenderCache(),
+		macIndex:          newMacIndex(),
+		addressIndex:      newAddressIndex(),
+		heartbeats:        newHeartbeats(),
 	}
 
 	// Load stores.
@@ -752,7 +823,13 @@ func NewDataTracker(backend store.Store,
 		GlobalProfileName: "global",
 		thunks:            make([]func(), 0),
 		thunkMux:          &sync.Mutex{},
+		logMux:            &sync.Mutex{},
 		publishers:        publishers,
+		started:           time.Now(),
+		renderCache:       newRenderCache(),
+		macIndex:          newMacIndex(),
+		addressIndex:      newAddressIndex(),
+		heartbeats:        newHeartbeats(),
 	}
 
 	// Make sure incoming writable backend has all stores created
@@ -782,14 +859,23 @@ func NewDataTracker(backend store.Store,
 			res.runningPrefs[pref.Name] = pref.Val
 		}
 
-		// Set systemGrantorSecret and baseTokenSecret if unset and save it to backing store.
+		// Set systemGrantorSecret, baseTokenSecret, and secureParamSecret if unset and save it to backing store.
 		prefs := res.Prefs()
-		for _, pref := range []string{"systemGrantorSecret", "baseTokenSecret"} {
+		for _, pref := range []string{"systemGrantorSecret", "baseTokenSecret", "secureParamSecret"} {
 			if val, ok := prefs[pref]; !ok || val == "" {
 				prefs[pref] = randString(32)
 				savePrefs = true
 			}
 		}
+		// Likewise make the key used to sign rendered Job actions.
+		if val, ok := prefs["jobSigningKey"]; !ok || val == "" {
+			if key, err := generateJobSigningKey(); err != nil {
+				res.Errorf("Failed to generate jobSigningKey: %v", err)
+			} else {
+				prefs["jobSigningKey"] = key
+				savePrefs = true
+			}
+		}
 		// Migrate any number-based logging preferences
 		for _, name := range []string{"debugDhcp",
 			"debugRenderer",
@@ -913,6 +999,14 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 		}
 		return true
 	}
+	boolCheck := func(name, val string) bool {
+		_, e := strconv.ParseBool(val)
+		if e == nil {
+			return true
+		}
+		err.Errorf("%s: %s", name, e.Error())
+		return false
+	}
 	intCheck := func(name, val string) bool {
 		_, e := strconv.Atoi(val)
 		if e == nil {
@@ -943,6 +1037,19 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 			if lenCheck(name, val) && savePref(name, val) {
 				p.tokenManager.updateKey([]byte(val))
 			}
+		case "secureParamSecret":
+			// Changing this would orphan every sealed param value.
+			if old := p.pref(name); old != "" && old != val {
+				err.Errorf("%s: Cannot be changed once set", name)
+			} else if lenCheck(name, val) {
+				savePref(name, val)
+			}
+		case "jobSigningKey":
+			if _, err1 := parseJobSigningKey(val); err1 != nil {
+				err.Errorf("%s: Invalid key: %v", name, err1)
+			} else {
+				savePref(name, val)
+			}
 		case "defaultBootEnv":
 			be := benvCheck(name, val)
 			if be != nil && !be.OnlyUnknown {
@@ -957,10 +1064,19 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 				err.AddError(p.RenderUnknown(rt))
 			}
 		case "unknownTokenTimeout",
-			"knownTokenTimeout":
+			"knownTokenTimeout",
+			"jobArtifactMaxSize",
+			"jobRetentionCount",
+			"jobRetentionAge",
+			"jobRetentionFailedAge",
+			"agentHeartbeatTimeout":
 			if intCheck(name, val) {
 				savePref(name, val)
 			}
+		case "reserveMachineAddresses":
+			if boolCheck(name, val) {
+				savePref(name, val)
+			}
 		case "debugDhcp",
 			"debugRenderer",
 			"debugBootEnv",
@@ -978,6 +1094,11 @@ func (p *DataTracker) SetPrefs(rt *RequestTracker, prefs map[string]string) erro
 			err.Errorf("Unknown preference %s", name)
 		}
 	}
+	// Templates can read preferences, and changing them does not
+	// publish an event.
+	if p.renderCache != nil {
+		p.renderCache.invalidate("preferences", "update", "", nil)
+	}
 	return err.HasError()
 }
 
@@ -1043,5 +1164,8 @@ func (p *DataTracker) Backup() ([]byte, error) {
 // Assumes that all locks are held
 func (p *DataTracker) ReplaceBackend(rt *RequestTracker, st store.Store) (hard, soft error) {
 	p.Backend = st
+	if p.renderCache != nil {
+		p.renderCache.reset()
+	}
 	return p.rebuildCache(rt)
 }
@@ -101,6 +101,7 @@ func FindLease(rt *RequestTracker,
 			}
 		}
 		lease.State = "ACK"
+		lease.linkMachine(rt)
 		rt.Save(lease)
 	})
 	return
@@ -290,6 +291,7 @@ func FindOrCreateLease(rt *RequestTracker,
 				leases.Add(lease)
 			}
 			lease.ExpireTime = time.Now().Add(time.Minute)
+			lease.linkMachine(rt)
 
 			// If we are proxy, we don't save leases.  The address is empty.
 			if subnet == nil || !subnet.Proxy {
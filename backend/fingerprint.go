@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// FindMachineByFingerprint returns the Machine whose Fingerprint best
+// matches fp, or nil if no Machine matches at all.  If more than one
+// Machine matches equally well, it returns a 409 error that names all
+// of them.  The caller must hold the machines lock.
+func (rt *RequestTracker) FindMachineByFingerprint(fp *models.MachineFingerprint) (*Machine, error) {
+	e := &models.Error{
+		Code:  http.StatusUnprocessableEntity,
+		Type:  ValidationError,
+		Model: "machines",
+	}
+	fp.Validate(e)
+	if err := e.HasError(); err != nil {
+		return nil, err
+	}
+	best := 0
+	found := []*Machine{}
+	for _, i := range rt.stores("machines").Items() {
+		m := AsMachine(i)
+		score := fp.Score(m.Fingerprint)
+		switch {
+		case score == 0 || score < best:
+			continue
+		case score > best:
+			best = score
+			found = []*Machine{}
+		}
+		found = append(found, m)
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return found[0], nil
+	}
+	// Which Machines matched is left out, since the caller may not be
+	// allowed to see them.
+	e.Code = http.StatusConflict
+	e.Type = "Conflict"
+	e.Errorf("Fingerprint matches %d Machines equally well", len(found))
+	return nil, e
+}
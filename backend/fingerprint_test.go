@@ -0,0 +1,55 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestFingerprint(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "workflows")
+	fps := []*models.MachineFingerprint{
+		{SystemUUID: "4C4C4544-0001", SerialNumber: "S1", MACs: []string{"52:54:00:00:00:01"}},
+		{SystemUUID: "00000000-0000-0000-0000-000000000000", SerialNumber: "To Be Filled By O.E.M.", MACs: []string{"52:54:00:00:00:02"}},
+		{SystemUUID: "00000000-0000-0000-0000-000000000000", SerialNumber: "To Be Filled By O.E.M.", MACs: []string{"52:54:00:00:00:03"}},
+	}
+	names := []string{"fp1", "fp2", "fp3"}
+	rt.Do(func(d Stores) {
+		for i := range fps {
+			m := &models.Machine{Name: names[i], Uuid: uuid.NewRandom(), Fingerprint: fps[i]}
+			if _, err := rt.Create(m); err != nil {
+				t.Errorf("Failed to create machine %s: %v", names[i], err)
+			}
+		}
+	})
+	tests := []struct {
+		name   string
+		fp     *models.MachineFingerprint
+		expect string
+		err    bool
+	}{
+		{"SystemUUID", &models.MachineFingerprint{SystemUUID: "4c4c4544-0001"}, "fp1", false},
+		{"SystemUUID beats MAC", &models.MachineFingerprint{SystemUUID: "4c4c4544-0001", MACs: []string{"52:54:00:00:00:02"}}, "fp1", false},
+		{"MAC", &models.MachineFingerprint{MACs: []string{"52-54-00-00-00-03"}}, "fp3", false},
+		{"Placeholder serial", &models.MachineFingerprint{SerialNumber: "To Be Filled By O.E.M."}, "", false},
+		{"Ambiguous", &models.MachineFingerprint{MACs: []string{"52:54:00:00:00:02", "52:54:00:00:00:03"}}, "", true},
+		{"Bad MAC", &models.MachineFingerprint{MACs: []string{"fred"}}, "", true},
+	}
+	for _, test := range tests {
+		rt.Do(func(d Stores) {
+			m, err := rt.FindMachineByFingerprint(test.fp)
+			if test.err != (err != nil) {
+				t.Errorf("%s: unexpected error state: %v", test.name, err)
+			}
+			name := ""
+			if m != nil {
+				name = m.Name
+			}
+			if name != test.expect {
+				t.Errorf("%s: expected machine %q, got %q", test.name, test.expect, name)
+			}
+		})
+	}
+}
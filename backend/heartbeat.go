@@ -0,0 +1,180 @@
+package backend
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// defaultAgentHeartbeatTimeout is used when the agentHeartbeatTimeout
+// preference is not set.
+const defaultAgentHeartbeatTimeout = 120
+
+// heartbeatSaveInterval is how far behind the Heartbeat saved with a
+// Machine can fall before ExpireJobs saves the one kept in memory.
+const heartbeatSaveInterval = 10 * time.Minute
+
+// heartbeats keeps the last heartbeat from the machine agent on each
+// Machine in memory, so that receiving one does not have to update
+// the Machine.  It is filled from the saved Heartbeats when the
+// Machines are loaded, and forgets Machines when they are deleted.
+type heartbeats struct {
+	sync.Mutex
+	beats map[string]*models.MachineHeartbeat
+}
+
+func newHeartbeats() *heartbeats {
+	return &heartbeats{beats: map[string]*models.MachineHeartbeat{}}
+}
+
+// get returns a copy of the last heartbeat for the Machine with key,
+// or nil if there has not been one.
+func (h *heartbeats) get(key string) *models.MachineHeartbeat {
+	h.Lock()
+	defer h.Unlock()
+	hb, ok := h.beats[key]
+	if !ok {
+		return nil
+	}
+	res := *hb
+	return &res
+}
+
+func (h *heartbeats) set(key string, hb *models.MachineHeartbeat) {
+	h.Lock()
+	defer h.Unlock()
+	res := *hb
+	h.beats[key] = &res
+}
+
+// update forgets the heartbeats of deleted Machines.
+func (h *heartbeats) update(action, key string) {
+	if action != "delete" {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	delete(h.beats, key)
+}
+
+// load replaces the known heartbeats with the ones saved with objs.
+func (h *heartbeats) load(objs []models.Model) {
+	h.Lock()
+	defer h.Unlock()
+	h.beats = map[string]*models.MachineHeartbeat{}
+	for _, obj := range objs {
+		if m := AsMachine(obj); m.Heartbeat != nil {
+			hb := *m.Heartbeat
+			h.beats[m.Key()] = &hb
+		}
+	}
+}
+
+// heartbeatTimeout returns how long the machine agent can go without
+// sending a heartbeat before its running Jobs are failed.  It is 0 if
+// they should never be.
+func (rt *RequestTracker) heartbeatTimeout() time.Duration {
+	v, err := strconv.ParseInt(rt.dt.pref("agentHeartbeatTimeout"), 10, 64)
+	if err != nil {
+		v = defaultAgentHeartbeatTimeout
+	}
+	return time.Duration(v) * time.Second
+}
+
+// SetHeartbeat records hb as the last heartbeat from the machine agent
+// on m and returns it.  It is only kept in memory until ExpireJobs or
+// the next update of m saves it, so no locks are needed beyond the
+// ones used to find m.  The LastSeen index and WithHeartbeat see it
+// right away.
+func (rt *RequestTracker) SetHeartbeat(m *Machine, hb *models.MachineHeartbeat) *models.MachineHeartbeat {
+	hb.LastSeen = time.Now()
+	rt.dt.heartbeats.set(m.Key(), hb)
+	return hb
+}
+
+// lastHeartbeat returns the last heartbeat from the machine agent on
+// n, including one that has only been kept in memory so far.
+func (n *Machine) lastHeartbeat() *models.MachineHeartbeat {
+	if n.beats != nil {
+		if hb := n.beats.get(n.Key()); hb != nil {
+			return hb
+		}
+	}
+	return n.Heartbeat
+}
+
+// WithHeartbeat puts the last heartbeat from the machine agent into m
+// if it is a Machine, so that API responses do not show the one that
+// was last saved.  m must be a copy, not what is in the stores.
+func (p *DataTracker) WithHeartbeat(m models.Model) models.Model {
+	if mm, ok := m.(*models.Machine); ok && p.heartbeats != nil {
+		if hb := p.heartbeats.get(mm.Key()); hb != nil {
+			mm.Heartbeat = hb
+		}
+	}
+	return m
+}
+
+// saveHeartbeats saves the heartbeats kept in memory with the Machines
+// whose saved Heartbeat is more than heartbeatSaveInterval behind.
+func (rt *RequestTracker) saveHeartbeats() {
+	for _, i := range rt.stores("machines").Items() {
+		m := AsMachine(i)
+		hb := rt.dt.heartbeats.get(m.Key())
+		if hb == nil || (m.Heartbeat != nil && hb.LastSeen.Sub(m.Heartbeat.LastSeen) < heartbeatSaveInterval) {
+			continue
+		}
+		nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+		nm.Heartbeat = hb
+		if _, err := rt.Save(nm); err != nil {
+			rt.Errorf("Failed to save the heartbeat of Machine %s: %v", m.Key(), err)
+		}
+	}
+}
+
+// failLostJobs fails the running Jobs of every Machine whose agent has
+// sent heartbeats before, but has not sent one for longer than the
+// agentHeartbeatTimeout preference.  Heartbeats that could not have
+// arrived because dr-provision was not running do not count as missed.
+func (rt *RequestTracker) failLostJobs(now time.Time) {
+	timeout := rt.heartbeatTimeout()
+	if timeout <= 0 {
+		return
+	}
+	for _, i := range rt.stores("machines").Items() {
+		m := AsMachine(i)
+		hb := rt.dt.heartbeats.get(m.Key())
+		if hb == nil {
+			continue
+		}
+		last := hb.LastSeen
+		if last.Before(rt.dt.started) {
+			last = rt.dt.started
+		}
+		if now.Sub(last) <= timeout {
+			continue
+		}
+		ids := []uuid.UUID{m.CurrentJob}
+		for _, id := range m.TaskJobs {
+			ids = append(ids, id)
+		}
+		for _, id := range ids {
+			jo := rt.Find("jobs", id.String())
+			if jo == nil || AsJob(jo).State != "running" {
+				continue
+			}
+			nj := AsJob(toBackend(models.Clone(AsJob(jo).Job), rt))
+			nj.State = "failed"
+			nj.ExitState = "lost"
+			if _, err := rt.Update(nj); err != nil {
+				rt.Errorf("Failed to fail Job %s after losing the agent on Machine %s: %v", nj.Key(), m.Key(), err)
+				continue
+			}
+			rt.Infof("Job %s for Task %s on Machine %s failed, no heartbeat from the agent since %s", nj.Key(), nj.Task, m.Key(), hb.LastSeen)
+			rt.dt.Publish("jobs", "lost", nj.Key(), nj)
+		}
+	}
+}
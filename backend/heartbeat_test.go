@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestHeartbeat(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, jobLockMap["update"]...)
+	beating := &models.Machine{Name: "beating", Uuid: uuid.NewRandom(), Stage: "heartbeat", Runnable: true}
+	silent := &models.Machine{Name: "silent", Uuid: uuid.NewRandom(), Stage: "heartbeat", Runnable: true}
+	tests := []crudTest{
+		{"Create heartbeat task", rt.Create, &models.Task{Name: "heartbeat-task"}, true},
+		{"Create heartbeat stage", rt.Create, &models.Stage{Name: "heartbeat", BootEnv: "local", Tasks: []string{"heartbeat-task"}}, true},
+		{"Create beating machine", rt.Create, beating, true},
+		{"Create silent machine", rt.Create, silent, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	// startJob creates a running Job for the only Task of m.
+	startJob := func(m *models.Machine) string {
+		j := &Job{}
+		Fill(j)
+		j.Uuid = uuid.NewRandom()
+		j.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+		j.Machine = m.Uuid
+		j.Stage = "heartbeat"
+		j.Task = "heartbeat-task"
+		j.State = "running"
+		rt.Do(func(d Stores) {
+			if _, err := rt.Create(j); err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			sm := AsMachine(rt.Find("machines", m.UUID()))
+			sm.CurrentJob = j.Uuid
+			if _, err := rt.Save(sm); err != nil {
+				t.Errorf("Failed to save machine: %v", err)
+			}
+		})
+		return j.Key()
+	}
+	beatingJob := startJob(beating)
+	silentJob := startJob(silent)
+	state := func(id string) (res string) {
+		rt.Do(func(d Stores) {
+			j := AsJob(rt.Find("jobs", id))
+			res = j.State + "/" + j.ExitState
+		})
+		return
+	}
+	// Heartbeats need no locks beyond the ones to find the machine,
+	// and are only kept in memory until ExpireJobs saves them.
+	hbRT := dt.Request(dt.Logger, "machines")
+	hbRT.Do(func(d Stores) {
+		m := AsMachine(hbRT.Find("machines", beating.UUID()))
+		hb := hbRT.SetHeartbeat(m, &models.MachineHeartbeat{Version: "v3.0.2", Uptime: 10, CurrentJob: uuid.Parse(beatingJob)})
+		if hb.LastSeen.IsZero() {
+			t.Errorf("Heartbeat should have been stamped with when it was seen")
+		}
+		if m.Heartbeat != nil {
+			t.Errorf("Heartbeat should not have been saved with the machine yet")
+		}
+		res, err := index.All(index.Sort(m.Indexes()["LastSeen"]),
+			index.Gt(time.Now().Add(-time.Minute).Format(time.RFC3339)))(&d("machines").Index)
+		if err != nil || res.Count() != 1 {
+			t.Errorf("Only the beating machine should have been seen in the last minute: %v", err)
+		}
+	})
+	rt.Do(func(d Stores) {
+		rt.ExpireJobs()
+		m := AsMachine(rt.Find("machines", beating.UUID()))
+		if m.Heartbeat == nil || m.Heartbeat.Version != "v3.0.2" {
+			t.Errorf("ExpireJobs should have saved the first heartbeat, not %v", m.Heartbeat)
+		}
+	})
+	hbRT.Do(func(d Stores) {
+		hbRT.SetHeartbeat(AsMachine(hbRT.Find("machines", beating.UUID())), &models.MachineHeartbeat{Version: "v3.0.3"})
+	})
+	rt.Do(func(d Stores) {
+		rt.ExpireJobs()
+		m := dt.WithHeartbeat(models.Clone(rt.Find("machines", beating.UUID()))).(*models.Machine)
+		if m.Heartbeat == nil || m.Heartbeat.Version != "v3.0.3" {
+			t.Errorf("The machine should show the last heartbeat, not %v", m.Heartbeat)
+		}
+	})
+	if got := state(beatingJob); got != "running/" {
+		t.Errorf("Job should still be running, not %s", got)
+	}
+	// Pretend dr-provision has been up for a while, and that the
+	// last heartbeat was some time ago.
+	dt.started = time.Now().Add(-time.Hour)
+	dt.heartbeats.beats[beating.Key()].LastSeen = time.Now().Add(-time.Hour)
+	rt.Do(func(d Stores) {
+		rt.ExpireJobs()
+	})
+	if got := state(beatingJob); got != "failed/lost" {
+		t.Errorf("Job should have failed once the agent was lost, not %s", got)
+	}
+	if got := state(silentJob); got != "running/" {
+		t.Errorf("Machines that never sent a heartbeat should be left alone, not %s", got)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", beating.UUID()))
+		m.Description = "still beating"
+		if _, err := rt.Update(m); err != nil {
+			t.Errorf("Failed to update machine: %v", err)
+			return
+		}
+		if v := AsMachine(rt.Find("machines", beating.UUID())).Heartbeat.Version; v != "v3.0.3" {
+			t.Errorf("Updating the machine should save the heartbeat in memory, not %s", v)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	s "sort"
+	"strings"
 
 	"github.com/digitalrebar/provision/models"
 )
@@ -49,6 +50,7 @@ type Maker struct {
 	Less     Less      `json:"-"`
 	Tests    TestMaker `json:"-"`
 	Fill     Filler    `json:"-"`
+	contains func(models.Model, string) bool
 }
 
 // Index declares a struct field that can be indexed for a given
@@ -68,6 +70,21 @@ func Make(unique bool, t string, less Less, maker TestMaker, filler Filler) Make
 	return Maker{Unique: unique, Type: t, Less: less, Tests: maker, Fill: filler}
 }
 
+var errContains = errors.New("Only Eq and Ne can be used on this index")
+
+// MakeContains returns a Maker for a field that holds several values,
+// like a list of MAC addresses.  Items stay in key order, and only Eq
+// and Ne can be used with it: they keep the items for which contains
+// does or does not return true for the value being filtered on.
+func MakeContains(t string, contains func(models.Model, string) bool) Maker {
+	res := MakeKey()
+	res.keyOrder = false
+	res.Unique = false
+	res.Type = t
+	res.contains = contains
+	return res
+}
+
 func Create(objs []models.Model) *Index {
 	res := &Index{Maker: MakeKey(), sorted: true, base: true, objs: objs}
 	s.Slice(res.objs, func(j, k int) bool { return res.Less(res.objs[j], res.objs[k]) })
@@ -501,6 +518,9 @@ func Subset(lower, upper Test) Filter {
 
 func Between(lower, upper string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return i, errContains
+		}
 		lRef, err := i.Fill(lower)
 		if err != nil {
 			return i, err
@@ -517,6 +537,9 @@ func Between(lower, upper string) Filter {
 
 func Except(lower, upper string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return i, errContains
+		}
 		lRef, err := i.Fill(lower)
 		if err != nil {
 			return i, err
@@ -538,6 +561,9 @@ func Except(lower, upper string) Filter {
 // current comparators
 func Lt(ref string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return i, errContains
+		}
 		refTest, err := i.Fill(ref)
 		if err != nil {
 			return i, err
@@ -551,6 +577,9 @@ func Lt(ref string) Filter {
 // than or equal to the current comparators.
 func Lte(ref string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return i, errContains
+		}
 		refTest, err := i.Fill(ref)
 		if err != nil {
 			return i, err
@@ -564,6 +593,9 @@ func Lte(ref string) Filter {
 // the current comparators.
 func Eq(ref string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return Select(func(m models.Model) bool { return i.contains(m, ref) })(i)
+		}
 		refTest, err := i.Fill(ref)
 		if err != nil {
 			return i, err
@@ -577,6 +609,9 @@ func Eq(ref string) Filter {
 // than or equal to the current comparators
 func Gte(ref string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return i, errContains
+		}
 		refTest, err := i.Fill(ref)
 		if err != nil {
 			return i, err
@@ -590,6 +625,9 @@ func Gte(ref string) Filter {
 // greater-than the current comparators
 func Gt(ref string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return i, errContains
+		}
 		refTest, err := i.Fill(ref)
 		if err != nil {
 			return i, err
@@ -603,6 +641,9 @@ func Gt(ref string) Filter {
 // to the current comparators.
 func Ne(ref string) Filter {
 	return func(i *Index) (*Index, error) {
+		if i.contains != nil {
+			return Select(func(m models.Model) bool { return !i.contains(m, ref) })(i)
+		}
 		refTest, err := i.Fill(ref)
 		if err != nil {
 			return i, err
@@ -667,3 +708,48 @@ func Reverse() Filter {
 		return res, nil
 	}
 }
+
+// ParseFilter turns the value of a list query parameter into a
+// Filter.  The value can be one of Eq(value), Lt(value), Lte(value),
+// Gt(value), Gte(value), Ne(value), Between(lower,upper), or
+// Except(lower,upper).  A bare value is the same as Eq(value).  It
+// fails if the parentheses or the comma an operator needs are
+// missing.
+func ParseFilter(v string) (Filter, error) {
+	args := strings.SplitN(v, "(", 2)
+	op := args[0]
+	switch op {
+	case "Eq", "Lt", "Lte", "Gt", "Gte", "Ne", "Between", "Except":
+	default:
+		return Eq(v), nil
+	}
+	if len(args) != 2 {
+		return nil, fmt.Errorf("%s: missing (", v)
+	}
+	subargs := strings.SplitN(args[1], ")", 2)
+	if len(subargs) != 2 {
+		return nil, fmt.Errorf("%s: missing )", v)
+	}
+	switch op {
+	case "Eq":
+		return Eq(subargs[0]), nil
+	case "Lt":
+		return Lt(subargs[0]), nil
+	case "Lte":
+		return Lte(subargs[0]), nil
+	case "Gt":
+		return Gt(subargs[0]), nil
+	case "Gte":
+		return Gte(subargs[0]), nil
+	case "Ne":
+		return Ne(subargs[0]), nil
+	}
+	parts := strings.Split(subargs[0], ",")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%s: missing ,", v)
+	}
+	if op == "Between" {
+		return Between(parts[0], parts[1]), nil
+	}
+	return Except(parts[0], parts[1]), nil
+}
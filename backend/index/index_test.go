@@ -3,6 +3,7 @@ package index
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
@@ -47,6 +48,11 @@ func (t testThing) Indexes() map[string]Maker {
 				res, err := strconv.ParseInt(s, 10, 64)
 				return testThing(res), err
 			}),
+		"Digits": MakeContains(
+			"string",
+			func(s models.Model, digit string) bool {
+				return strings.Contains(strconv.FormatInt(int64(s.(testThing)), 10), digit)
+			}),
 	}
 }
 
@@ -228,3 +234,41 @@ func TestIndexes(t *testing.T) {
 	}
 	matchIdx(t, sub, 6)
 }
+
+func TestContainsIndex(t *testing.T) {
+	objs := make([]models.Model, 30)
+	for i := range objs {
+		objs[i] = testThing(len(objs) - i)
+	}
+	indexes := testThing(0).Indexes()
+	idx, err := Sort(indexes["Digits"])(New(objs))
+	if err != nil {
+		t.Errorf("Unexpected error sorting digits: %v", err)
+	}
+	eq, err := Eq("7")(idx)
+	if err != nil {
+		t.Errorf("Got unexpected error running Eq: %v", err)
+	}
+	matchIdx(t, eq, 7, 17, 27)
+	ne, err := Ne("1")(eq)
+	if err != nil {
+		t.Errorf("Got unexpected error running Ne: %v", err)
+	}
+	matchIdx(t, ne, 7, 27)
+	if _, err = Lt("7")(idx); err == nil {
+		t.Errorf("Lt should not be allowed on a contains index")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	for _, v := range []string{"Eq(1)", "Between(1,3)", "Except(1,3)", "1", "Eql", ""} {
+		if _, err := ParseFilter(v); err != nil {
+			t.Errorf("Parsing %q failed: %v", v, err)
+		}
+	}
+	for _, v := range []string{"Eq", "Lt(1", "Between(1)", "Between", "Except(1,3"} {
+		if _, err := ParseFilter(v); err == nil {
+			t.Errorf("Parsing %q should have failed", v)
+		}
+	}
+}
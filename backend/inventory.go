@@ -0,0 +1,75 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// InventoryPath is where the inventory history of a Machine is kept.
+// It lives next to the job logs, one JSON document per line.
+func (n *Machine) InventoryPath(rt *RequestTracker) string {
+	return filepath.Join(rt.dt.LogRoot, n.UUID()+".inventory")
+}
+
+// SetInventory records inv as the current inventory of m, and updates
+// the Fingerprint of m to match.  If the hardware differs from what was
+// last reported, inv is also added to the inventory history of m.
+// Failing to do that is logged, but does not fail the update, which
+// has already been saved by then.  The caller must hold the update
+// locks for machines.
+func (rt *RequestTracker) SetInventory(m *Machine, inv *models.Inventory) (*Machine, error) {
+	if inv.Collected.IsZero() {
+		inv.Collected = time.Now()
+	}
+	nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+	nm.Inventory = inv
+	nm.Fingerprint = inv.Fingerprint()
+	if _, err := rt.Update(nm); err != nil {
+		return nil, err
+	}
+	// Compare after the update so that MAC addresses are in
+	// canonical form.
+	if m.Inventory.SameHardware(nm.Inventory) {
+		return nm, nil
+	}
+	if err := rt.appendInventory(nm); err != nil {
+		rt.Errorf("Failed to add to the inventory history of Machine %s: %v", nm.Key(), err)
+	}
+	return nm, nil
+}
+
+func (rt *RequestTracker) appendInventory(m *Machine) error {
+	f, err := os.OpenFile(m.InventoryPath(rt), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(m.Inventory)
+}
+
+// InventoryHistory returns every distinct inventory that has been
+// reported for m, oldest first.
+func (rt *RequestTracker) InventoryHistory(m *Machine) ([]*models.Inventory, error) {
+	res := []*models.Inventory{}
+	f, err := os.Open(m.InventoryPath(rt))
+	if os.IsNotExist(err) {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		inv := &models.Inventory{}
+		if err := dec.Decode(inv); err != nil {
+			return res, err
+		}
+		res = append(res, inv)
+	}
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestInventory(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "workflows")
+	machine := &models.Machine{Name: "inv", Uuid: uuid.NewRandom()}
+	var m *Machine
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(machine); err != nil {
+			t.Fatalf("Failed to create machine: %v", err)
+		}
+		m = AsMachine(rt.Find("machines", machine.UUID()))
+	})
+	inv := func(serial string, mem uint64, macs ...string) *models.Inventory {
+		res := &models.Inventory{
+			System: models.InventorySystem{Vendor: "Acme", SerialNumber: serial},
+			Memory: mem,
+		}
+		for _, mac := range macs {
+			res.NICs = append(res.NICs, models.InventoryNIC{Name: "eth", MAC: mac})
+		}
+		return res
+	}
+	set := func(i *models.Inventory, pass bool) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			nm, err := rt.SetInventory(m, i)
+			if pass && err != nil {
+				t.Errorf("Failed to set inventory: %v", err)
+			} else if !pass && err == nil {
+				t.Errorf("Setting inventory should have failed")
+			}
+			if err == nil {
+				m = nm
+			}
+		})
+	}
+	set(inv("S1", 1<<30, "not-a-mac"), false)
+	set(inv("S1", 1<<30, "52:54:00:AA:BB:01"), true)
+	if m.Inventory.NICs[0].MAC != "52:54:00:aa:bb:01" || m.Inventory.Collected.IsZero() {
+		t.Errorf("Inventory was not normalized: %#v", m.Inventory)
+	}
+	set(inv("S1", 1<<30, "52:54:00:aa:bb:01"), true)
+	set(inv("S1", 1<<30, "52-54-00-AA-BB-01"), true)
+	set(inv("S1", 2<<30, "52:54:00:aa:bb:01", "52:54:00:aa:bb:02"), true)
+	rt.Do(func(d Stores) {
+		hist, err := rt.InventoryHistory(m)
+		if err != nil {
+			t.Errorf("Failed to read inventory history: %v", err)
+		}
+		if len(hist) != 2 || hist[1].Memory != 2<<30 {
+			t.Errorf("Expected 2 inventories in the history, got %d", len(hist))
+		}
+	})
+	filter := func(idx, val string, expect int) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			maker := m.Indexes()[idx]
+			res, err := index.All(index.Sort(maker), index.Eq(val))(&d("machines").Index)
+			if err != nil {
+				t.Errorf("Failed to filter on %s: %v", idx, err)
+				return
+			}
+			if res.Count() != expect {
+				t.Errorf("Expected %d machines with %s=%s, got %d", expect, idx, val, res.Count())
+			}
+		})
+	}
+	filter("Vendor", "Acme", 1)
+	filter("SerialNumber", "S2", 0)
+	filter("Memory", "2147483648", 1)
+	filter("MAC", "52:54:00:AA:BB:02", 1)
+	filter("MAC", "52:54:00:aa:bb:03", 0)
+}
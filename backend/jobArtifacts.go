@@ -0,0 +1,173 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// defaultJobArtifactMaxSize is used when the jobArtifactMaxSize
+// preference is not set.
+const defaultJobArtifactMaxSize = 100 << 20
+
+// artifactMaxSize returns how many bytes of artifacts a single Job may
+// store.
+func (rt *RequestTracker) artifactMaxSize() int64 {
+	if v, err := strconv.ParseInt(rt.dt.pref("jobArtifactMaxSize"), 10, 64); err == nil {
+		return v
+	}
+	return defaultJobArtifactMaxSize
+}
+
+// ArtifactDir returns the directory the artifacts of j are stored in.
+func (j *Job) ArtifactDir(rt *RequestTracker) string {
+	if j.rt == nil {
+		j.setRT(rt)
+		defer j.clearRT()
+	}
+	return filepath.Join(j.rt.dt.LogRoot, "artifacts", j.Uuid.String())
+}
+
+// Artifact returns the artifact of j called name, if there is one.
+func (j *Job) Artifact(name string) *models.JobArtifact {
+	for i := range j.Artifacts {
+		if j.Artifacts[i].Name == name {
+			return &j.Artifacts[i]
+		}
+	}
+	return nil
+}
+
+// artifactSpace returns how many more bytes of artifacts j can store
+// if its artifact called name is replaced.
+func (rt *RequestTracker) artifactSpace(j *Job, name string) int64 {
+	res := rt.artifactMaxSize()
+	for _, a := range j.Artifacts {
+		if a.Name != name {
+			res -= a.Size
+		}
+	}
+	return res
+}
+
+// validArtifactName returns whether name can be used as the file name
+// of an artifact.  Anything goes except names that would leave the
+// artifact directory of the Job.
+func validArtifactName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// AddJobArtifact stores what it reads from src as the artifact called
+// name of the running Job with the key id, replacing any artifact with
+// the same name.  If sum is not empty, it must match the SHA256
+// checksum of what was read.  The artifacts of a Job cannot add up to
+// more than the jobArtifactMaxSize preference.
+//
+// The upload is written to disk without holding any locks, so rt must
+// not be in the middle of a Do.
+func (rt *RequestTracker) AddJobArtifact(id, name string, src io.Reader, sum string) (*models.JobArtifact, error) {
+	e := &models.Error{Code: http.StatusUnprocessableEntity, Type: ValidationError, Model: "jobs", Key: id}
+	if !validArtifactName(name) {
+		e.Errorf("Invalid Artifact Name `%s`", name)
+		return nil, e
+	}
+	// check finds the Job and makes sure it can still take n more
+	// bytes of artifacts.
+	check := func(n int64) *Job {
+		jo := rt.Find("jobs", id)
+		if jo == nil {
+			e.Code = http.StatusNotFound
+			e.Errorf("Job %s does not exist", id)
+			return nil
+		}
+		j := AsJob(jo)
+		if !j.active() {
+			e.Code = http.StatusConflict
+			e.Errorf("Job %s is %s and cannot take artifacts", id, j.State)
+			return nil
+		}
+		if space := rt.artifactSpace(j, name); n > space {
+			e.Code = http.StatusRequestEntityTooLarge
+			e.Errorf("Artifact %s would go over the %d byte limit for the artifacts of Job %s", name, rt.artifactMaxSize(), id)
+			return nil
+		}
+		return j
+	}
+	var j *Job
+	var space int64
+	rt.Do(func(d Stores) {
+		if j = check(0); j != nil {
+			space = rt.artifactSpace(j, name)
+		}
+	})
+	if j == nil {
+		return nil, e
+	}
+	dir := j.ArtifactDir(rt)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(dir, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(src, space+1))
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	if size > space {
+		e.Code = http.StatusRequestEntityTooLarge
+		e.Errorf("Artifact %s would go over the %d byte limit for the artifacts of Job %s", name, rt.artifactMaxSize(), id)
+		return nil, e
+	}
+	res := &models.JobArtifact{
+		Name:   name,
+		Size:   size,
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+		Time:   time.Now(),
+	}
+	if sum != "" && sum != res.Sha256 {
+		e.Errorf("Artifact %s has checksum %s, not %s", name, res.Sha256, sum)
+		return nil, e
+	}
+	var e2 error
+	rt.Do(func(d Stores) {
+		// Other uploads may have finished in the meantime.
+		if j = check(size); j == nil {
+			e2 = e
+			return
+		}
+		if e2 = os.Rename(tmp.Name(), filepath.Join(dir, name)); e2 != nil {
+			return
+		}
+		nj := AsJob(toBackend(models.Clone(j.Job), rt))
+		if a := nj.Artifact(name); a != nil {
+			*a = *res
+		} else {
+			nj.Artifacts = append(nj.Artifacts, *res)
+		}
+		_, e2 = rt.Update(nj)
+	})
+	if e2 != nil {
+		return nil, e2
+	}
+	return res, nil
+}
+
+func (j *Job) AfterDelete() {
+	if err := os.RemoveAll(j.ArtifactDir(j.rt)); err != nil {
+		j.rt.Errorf("Failed to remove artifacts of Job %s: %v", j.Key(), err)
+	}
+}
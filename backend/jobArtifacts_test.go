@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobArtifacts(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, jobLockMap["update"]...)
+	machine := &models.Machine{Name: "artifacts", Uuid: uuid.NewRandom(), Stage: "artifacts", Runnable: true}
+	tests := []crudTest{
+		{"Create artifacts task", rt.Create, &models.Task{Name: "artifacts-task"}, true},
+		{"Create artifacts stage", rt.Create, &models.Stage{Name: "artifacts", BootEnv: "local", Tasks: []string{"artifacts-task"}}, true},
+		{"Create artifacts machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	prt := dt.Request(dt.Logger, prefLockMap["update"]...)
+	prt.Do(func(d Stores) {
+		if err := dt.SetPrefs(prt, map[string]string{"jobArtifactMaxSize": "16"}); err != nil {
+			t.Errorf("Failed to set jobArtifactMaxSize: %v", err)
+		}
+	})
+	job := &Job{}
+	Fill(job)
+	job.Uuid = uuid.NewRandom()
+	job.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+	job.Machine = machine.Uuid
+	job.Stage = "artifacts"
+	job.Task = "artifacts-task"
+	job.State = "running"
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(job); err != nil {
+			t.Errorf("Failed to create job: %v", err)
+		}
+	})
+	// put stores content as the artifact name and reports whether it
+	// was accepted.
+	put := func(name, content, sum string) bool {
+		_, err := rt.AddJobArtifact(job.Key(), name, strings.NewReader(content), sum)
+		return err == nil
+	}
+	if !put("dmesg.txt", "hello", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824") {
+		t.Errorf("Failed to store artifact with a good checksum")
+	}
+	if put("dmesg2.txt", "hello", "0000") {
+		t.Errorf("Artifact with a bad checksum should be rejected")
+	}
+	if put("../escape", "hello", "") {
+		t.Errorf("Artifact with a bad name should be rejected")
+	}
+	for _, name := range []string{"01-dmesg.log", "_build.txt", "sos report.tar.xz"} {
+		if !validArtifactName(name) {
+			t.Errorf("Artifact name %q should be allowed", name)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		if validArtifactName(name) {
+			t.Errorf("Artifact name %q should be rejected", name)
+		}
+	}
+	if put("big.txt", "this is more than sixteen bytes", "") {
+		t.Errorf("Artifact over the size limit should be rejected")
+	}
+	if !put("dmesg.txt", "hello again", "") {
+		t.Errorf("Replacing an artifact should only count its new size")
+	}
+	var dir string
+	rt.Do(func(d Stores) {
+		j := AsJob(rt.Find("jobs", job.Key()))
+		dir = j.ArtifactDir(rt)
+		if len(j.Artifacts) != 1 || j.Artifacts[0].Size != 11 {
+			t.Errorf("Job should have one 11 byte artifact, not %v", j.Artifacts)
+		}
+		nj := AsJob(toBackend(models.Clone(j.Job), rt))
+		nj.State = "finished"
+		if _, err := rt.Update(nj); err != nil {
+			t.Errorf("Failed to finish job: %v", err)
+		}
+	})
+	if buf, err := ioutil.ReadFile(filepath.Join(dir, "dmesg.txt")); err != nil || string(buf) != "hello again" {
+		t.Errorf("Artifact should have been stored on disk: %q %v", string(buf), err)
+	}
+	if put("late.txt", "late", "") {
+		t.Errorf("Finished Jobs should not take artifacts")
+	}
+	rmTests := []crudTest{
+		{"Remove artifacts job", rt.Remove, job, true},
+	}
+	for _, test := range rmTests {
+		test.Test(t, rt)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Artifacts should be removed with their Job: %v", err)
+	}
+}
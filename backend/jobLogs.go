@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// watchJobLog returns a channel that gets a value whenever the log of
+// the Job with the key id is appended to, and a func to stop watching
+// it.
+func (p *DataTracker) watchJobLog(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	p.logMux.Lock()
+	if p.logWatchers == nil {
+		p.logWatchers = map[string][]chan struct{}{}
+	}
+	p.logWatchers[id] = append(p.logWatchers[id], ch)
+	p.logMux.Unlock()
+	return ch, func() {
+		p.logMux.Lock()
+		defer p.logMux.Unlock()
+		watchers := p.logWatchers[id]
+		for i := range watchers {
+			if watchers[i] == ch {
+				watchers = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(watchers) == 0 {
+			delete(p.logWatchers, id)
+		} else {
+			p.logWatchers[id] = watchers
+		}
+	}
+}
+
+// jobLogAppended tells everyone watching the log of the Job with the
+// key id that it has grown.  Watchers that have not caught up with the
+// last append do not need to hear about this one.
+func (p *DataTracker) jobLogAppended(id string) {
+	p.logMux.Lock()
+	defer p.logMux.Unlock()
+	for _, ch := range p.logWatchers[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// FollowJobLog writes the log of the Job with the key id to dst, and
+// keeps writing whatever is appended to it until the Job is no longer
+// created or running, or until stop gets a value.  If dst is an
+// http.Flusher, it is flushed after every write.
+//
+// rt must have the jobs prefix locked, and must not be in the middle
+// of a Do.
+func (rt *RequestTracker) FollowJobLog(id string, dst io.Writer, stop <-chan bool) error {
+	var j *Job
+	rt.Do(func(d Stores) {
+		if jo := rt.Find("jobs", id); jo != nil {
+			j = AsJob(jo)
+		}
+	})
+	if j == nil {
+		e := &models.Error{Code: http.StatusNotFound, Type: ValidationError, Model: "jobs", Key: id}
+		e.Errorf("Job %s does not exist", id)
+		return e
+	}
+	// Start watching before the first read, so that nothing appended
+	// after it can be missed.
+	changed, done := rt.dt.watchJobLog(id)
+	defer done()
+	src, err := os.Open(j.LogPath(rt))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	copyOut := func() error {
+		if _, err := io.Copy(dst, src); err != nil {
+			return err
+		}
+		if f, ok := dst.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		if err := copyOut(); err != nil {
+			return err
+		}
+		running := false
+		rt.Do(func(d Stores) {
+			if jo := rt.Find("jobs", id); jo != nil {
+				switch AsJob(jo).State {
+				case "created", "running":
+					running = true
+				}
+			}
+		})
+		if !running {
+			// Pick up anything written just before the Job finished.
+			return copyOut()
+		}
+		select {
+		case <-changed:
+		case <-tick.C:
+		case <-stop:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// lockedBuffer lets the test read what FollowJobLog has written while
+// it is still writing.
+type lockedBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.buf.String()
+}
+
+func TestJobLogFollow(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, jobLockMap["update"]...)
+	machine := &models.Machine{Name: "follow", Uuid: uuid.NewRandom(), Stage: "follow", Runnable: true}
+	tests := []crudTest{
+		{"Create follow task", rt.Create, &models.Task{Name: "follow-task"}, true},
+		{"Create follow stage", rt.Create, &models.Stage{Name: "follow", BootEnv: "local", Tasks: []string{"follow-task"}}, true},
+		{"Create follow machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	job := &Job{}
+	Fill(job)
+	job.Uuid = uuid.NewRandom()
+	job.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+	job.Machine = machine.Uuid
+	job.Stage = "follow"
+	job.Task = "follow-task"
+	job.State = "running"
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(job); err != nil {
+			t.Errorf("Failed to create job: %v", err)
+		}
+	})
+	out := &lockedBuffer{}
+	errs := make(chan error)
+	go func() {
+		frt := dt.Request(dt.Logger, "jobs")
+		errs <- frt.FollowJobLog(job.Key(), out, nil)
+	}()
+	if err := job.Log(rt, strings.NewReader("first line\n")); err != nil {
+		t.Errorf("Failed to append to log: %v", err)
+	}
+	for i := 0; i < 50 && !strings.Contains(out.String(), "first line"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "first line") {
+		t.Errorf("Following the log should see appends while the Job runs, got %q", out.String())
+	}
+	if err := job.Log(rt, strings.NewReader("last line\n")); err != nil {
+		t.Errorf("Failed to append to log: %v", err)
+	}
+	rt.Do(func(d Stores) {
+		nj := AsJob(toBackend(models.Clone(AsJob(rt.Find("jobs", job.Key())).Job), rt))
+		nj.State = "finished"
+		if _, err := rt.Update(nj); err != nil {
+			t.Errorf("Failed to finish job: %v", err)
+		}
+	})
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Following the log failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Following the log should stop once the Job finishes")
+	}
+	if !strings.Contains(out.String(), "last line") {
+		t.Errorf("Following the log should see everything written before the Job finished, got %q", out.String())
+	}
+	if err := dt.Request(dt.Logger, "jobs").FollowJobLog(uuid.NewRandom().String(), out, nil); err == nil {
+		t.Errorf("Following the log of a missing Job should fail")
+	}
+}
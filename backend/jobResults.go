@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+)
+
+// resultRank orders the kinds of values JSON decodes to: missing
+// values first, then booleans, numbers, strings, and everything else.
+func resultRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// compareResults returns -1, 0, or 1 as a is less than, equal to, or
+// greater than b.  Lists and objects are compared by their JSON form.
+func compareResults(a, b interface{}) int {
+	ra, rb := resultRank(a), resultRank(b)
+	switch {
+	case ra < rb:
+		return -1
+	case ra > rb:
+		return 1
+	}
+	switch av := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0
+		} else if bv {
+			return -1
+		}
+		return 1
+	case float64:
+		bv := b.(float64)
+		if av < bv {
+			return -1
+		} else if av > bv {
+			return 1
+		}
+		return 0
+	case string:
+		bv := b.(string)
+		if av < bv {
+			return -1
+		} else if av > bv {
+			return 1
+		}
+		return 0
+	}
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	as, bs := string(ab), string(bb)
+	if as < bs {
+		return -1
+	} else if as > bs {
+		return 1
+	}
+	return 0
+}
+
+// ParameterMaker makes an index over the value of key in the Results
+// of Jobs, so that Jobs can be filtered on what their Tasks reported.
+func (j *Job) ParameterMaker(rt *RequestTracker, key string) (index.Maker, error) {
+	fix := AsJob
+	return index.Make(
+		false,
+		"result",
+		func(i, j models.Model) bool {
+			return compareResults(fix(i).Results[key], fix(j).Results[key]) < 0
+		},
+		func(ref models.Model) (gte, gt index.Test) {
+			refVal := fix(ref).Results[key]
+			return func(s models.Model) bool {
+					return compareResults(fix(s).Results[key], refVal) >= 0
+				},
+				func(s models.Model) bool {
+					return compareResults(fix(s).Results[key], refVal) > 0
+				}
+		},
+		func(s string) (models.Model, error) {
+			res := fix(j.New())
+			var obj interface{}
+			if err := json.Unmarshal([]byte(s), &obj); err != nil {
+				// Let bare strings through without quotes.
+				obj = s
+			}
+			res.Results = map[string]interface{}{key: obj}
+			return res, nil
+		}), nil
+}
+
+// SetJobResults merges results into the Results of j, and writes the
+// ones named in the ResultParams of its Task into the Params of its
+// Machine.  Results can only be added while the Job is running.
+func (rt *RequestTracker) SetJobResults(j *Job, results map[string]interface{}) (*Job, error) {
+	if !j.active() {
+		e := &models.Error{Code: http.StatusConflict, Type: "Conflict", Model: j.Prefix(), Key: j.Key()}
+		e.Errorf("Job %s is %s and cannot take results", j.Key(), j.State)
+		return nil, e
+	}
+	nj := AsJob(toBackend(models.Clone(j.Job), rt))
+	if nj.Results == nil {
+		nj.Results = map[string]interface{}{}
+	}
+	for k, v := range results {
+		nj.Results[k] = v
+	}
+	if _, err := rt.Update(nj); err != nil {
+		return nil, err
+	}
+	if to, mo := rt.Find("tasks", j.Task), rt.Find("machines", j.Machine.String()); to != nil && mo != nil {
+		m := AsMachine(mo)
+		params := m.GetParams()
+		changed := false
+		for k, p := range AsTask(to).ResultParams {
+			if v, ok := results[k]; ok {
+				params[p] = v
+				changed = true
+			}
+		}
+		if changed {
+			if err := rt.SetParams(m, params); err != nil {
+				// Put the Job back the way it was, so that the
+				// results are either recorded everywhere or
+				// nowhere.
+				if _, e2 := rt.Update(AsJob(toBackend(models.Clone(j.Job), rt))); e2 != nil {
+					rt.Errorf("Failed to restore the results of Job %s: %v", j.Key(), e2)
+				}
+				return nil, err
+			}
+		}
+	}
+	return nj, nil
+}
@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobResults(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "jobs", "workflows", "rollouts")
+	machine := &models.Machine{Name: "results", Uuid: uuid.NewRandom(), Stage: "results", Runnable: true}
+	tests := []crudTest{
+		{"Create Task with bad ResultParams", rt.Create, &models.Task{Name: "bad", ResultParams: map[string]string{"disk": "bad param"}}, false},
+		{"Create disk-health param", rt.Create, &models.Param{Name: "disk-health", Schema: map[string]interface{}{"type": "string"}}, true},
+		{"Create results task", rt.Create, &models.Task{Name: "results-task", ResultParams: map[string]string{"disk": "disk-health"}}, true},
+		{"Create results stage", rt.Create, &models.Stage{Name: "results", BootEnv: "local", Tasks: []string{"results-task"}}, true},
+		{"Create results machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	job := &Job{}
+	Fill(job)
+	job.Uuid = uuid.NewRandom()
+	job.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+	job.Machine = machine.Uuid
+	job.Stage = "results"
+	job.Task = "results-task"
+	job.State = "running"
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(job); err != nil {
+			t.Errorf("Failed to create job: %v", err)
+			return
+		}
+		j := AsJob(rt.Find("jobs", job.Key()))
+		if _, err := rt.SetJobResults(j, map[string]interface{}{"disk": 5}); err == nil {
+			t.Errorf("Results that are not valid for their Param should be rejected")
+		}
+		if res := AsJob(rt.Find("jobs", job.Key())).Results; len(res) != 0 {
+			t.Errorf("Rejected results should not be left on the Job, not %v", res)
+		}
+		j, err := rt.SetJobResults(j, map[string]interface{}{"disk": "ok"})
+		if err != nil {
+			t.Errorf("Failed to set results: %v", err)
+			return
+		}
+		if j, err = rt.SetJobResults(j, map[string]interface{}{"bench": 1.5}); err != nil {
+			t.Errorf("Failed to add results: %v", err)
+			return
+		}
+		if j.Results["disk"] != "ok" || j.Results["bench"] != 1.5 {
+			t.Errorf("Results should have been merged, not %v", j.Results)
+		}
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		if v, _ := rt.GetParam(m, "disk-health", false); v != "ok" {
+			t.Errorf("disk-health should have been set to ok, not %v", v)
+		}
+		maker, _ := j.ParameterMaker(rt, "bench")
+		filter, _ := index.ParseFilter("Gt(1)")
+		idx, err := index.All(index.Sort(maker), filter)(&rt.stores("jobs").Index)
+		if err != nil || len(idx.Items()) != 1 {
+			t.Errorf("Job should be found by its bench result: %v", err)
+		}
+		nj := AsJob(toBackend(models.Clone(j.Job), rt))
+		nj.State = "finished"
+		if _, err := rt.Update(nj); err != nil {
+			t.Errorf("Failed to finish job: %v", err)
+			return
+		}
+		if _, err := rt.SetJobResults(nj, map[string]interface{}{"late": true}); err == nil {
+			t.Errorf("Finished Jobs should not take results")
+		}
+	})
+	rmTests := []crudTest{
+		{"Remove results job", rt.Remove, job, true},
+	}
+	for _, test := range rmTests {
+		test.Test(t, rt)
+	}
+}
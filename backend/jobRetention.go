@@ -0,0 +1,182 @@
+package backend
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// retentionPref returns the value of the job retention preference
+// name, or 0 if it is not set.
+func (rt *RequestTracker) retentionPref(name string) int64 {
+	v, _ := strconv.ParseInt(rt.dt.pref(name), 10, 64)
+	return v
+}
+
+// ended returns the time j ended, or the time it started if it never
+// recorded an end.
+func (j *Job) ended() time.Time {
+	if j.EndTime.IsZero() {
+		return j.StartTime
+	}
+	return j.EndTime
+}
+
+// JobPruneReport returns the Jobs that the jobRetentionCount,
+// jobRetentionAge, and jobRetentionFailedAge preferences say should be
+// removed.  Jobs that are still active, and Jobs a Machine is still
+// working from, are never removed.  Failed Jobs do not count against
+// jobRetentionCount, and are only removed once they are older than
+// jobRetentionFailedAge, or jobRetentionAge if that is not set.  A
+// preference that is 0 does not remove anything.
+//
+// rt must have the jobs and machines prefixes locked.
+func (rt *RequestTracker) JobPruneReport() []*models.JobPrune {
+	res := []*models.JobPrune{}
+	keep := rt.retentionPref("jobRetentionCount")
+	maxAge := time.Duration(rt.retentionPref("jobRetentionAge")) * time.Second
+	failedAge := time.Duration(rt.retentionPref("jobRetentionFailedAge")) * time.Second
+	if failedAge <= 0 {
+		failedAge = maxAge
+	}
+	if keep <= 0 && maxAge <= 0 && failedAge <= 0 {
+		return res
+	}
+	now := time.Now()
+	byMachine := map[string][]*Job{}
+	for _, i := range rt.d("jobs").Items() {
+		j := AsJob(i)
+		if j.active() {
+			continue
+		}
+		if mo := rt.Find("machines", j.Machine.String()); mo != nil && AsMachine(mo).isTaskJob(j) {
+			continue
+		}
+		byMachine[j.Machine.String()] = append(byMachine[j.Machine.String()], j)
+	}
+	machines := make([]string, 0, len(byMachine))
+	for k := range byMachine {
+		machines = append(machines, k)
+	}
+	sort.Strings(machines)
+	for _, k := range machines {
+		jobs := byMachine[k]
+		// Newest first, so that the ones to keep come first.
+		sort.Slice(jobs, func(a, b int) bool {
+			return jobs[a].ended().After(jobs[b].ended())
+		})
+		var kept int64
+		for _, j := range jobs {
+			reason := ""
+			if j.State == "failed" {
+				if failedAge > 0 && now.Sub(j.ended()) > failedAge {
+					reason = "age"
+				}
+			} else {
+				kept++
+				if keep > 0 && kept > keep {
+					reason = "count"
+				} else if maxAge > 0 && now.Sub(j.ended()) > maxAge {
+					reason = "age"
+				}
+			}
+			if reason == "" {
+				continue
+			}
+			res = append(res, &models.JobPrune{
+				Uuid:    j.Uuid,
+				Machine: j.Machine,
+				Task:    j.Task,
+				State:   j.State,
+				EndTime: j.EndTime,
+				Reason:  reason,
+			})
+		}
+	}
+	return res
+}
+
+// JobArchivePath returns the path the log of the Job with the key id
+// is compressed to when the Job is pruned.
+func (rt *RequestTracker) JobArchivePath(id string) string {
+	return filepath.Join(rt.dt.LogRoot, "archive", id+".log.gz")
+}
+
+// archiveJobLog compresses the log of j into the archive directory
+// under the log root.
+func (rt *RequestTracker) archiveJobLog(j *Job) error {
+	src, err := os.Open(j.LogPath(rt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	dest := rt.JobArchivePath(j.Key())
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), ".archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	zw.Name = j.Key()
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// PruneJobs archives the logs of the Jobs in the JobPruneReport and
+// removes them.  The logs are compressed without holding any locks, so
+// rt must not be in the middle of a Do.  It does nothing unless rt was
+// made with the locks needed to update jobs.
+func (rt *RequestTracker) PruneJobs() {
+	for _, prefix := range jobLockMap["update"] {
+		if !rt.locked(prefix) {
+			return
+		}
+	}
+	var report []*models.JobPrune
+	rt.Do(func(d Stores) {
+		report = rt.JobPruneReport()
+	})
+	for _, p := range report {
+		j := &Job{Job: &models.Job{Uuid: p.Uuid}}
+		if err := rt.archiveJobLog(j); err != nil {
+			rt.Errorf("Failed to archive the log of Job %s: %v", j.Key(), err)
+			continue
+		}
+		rt.Do(func(d Stores) {
+			jo := rt.Find("jobs", p.Uuid.String())
+			if jo == nil {
+				return
+			}
+			j = AsJob(jo)
+			if _, err := rt.Remove(j); err != nil {
+				rt.Errorf("Failed to prune Job %s: %v", j.Key(), err)
+				return
+			}
+			if err := os.Remove(j.LogPath(rt)); err != nil && !os.IsNotExist(err) {
+				rt.Errorf("Failed to remove the log of Job %s: %v", j.Key(), err)
+			}
+			rt.Infof("Pruned Job %s for Task %s on Machine %s by %s", j.Key(), j.Task, j.Machine, p.Reason)
+		})
+	}
+}
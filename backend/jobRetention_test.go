@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobRetention(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, jobLockMap["update"]...)
+	machine := &models.Machine{Name: "prune", Uuid: uuid.NewRandom(), Stage: "prune", Runnable: true}
+	tests := []crudTest{
+		{"Create prune task", rt.Create, &models.Task{Name: "prune-task"}, true},
+		{"Create prune stage", rt.Create, &models.Stage{Name: "prune", BootEnv: "local", Tasks: []string{"prune-task"}}, true},
+		{"Create prune machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	setPrefs := func(prefs map[string]string) {
+		prt := dt.Request(dt.Logger, prefLockMap["update"]...)
+		prt.Do(func(d Stores) {
+			if err := dt.SetPrefs(prt, prefs); err != nil {
+				t.Errorf("Failed to set prefs %v: %v", prefs, err)
+			}
+		})
+	}
+	// addJob makes a Job for the Machine that ended ago in state.
+	addJob := func(state string, ago time.Duration) string {
+		j := &Job{}
+		Fill(j)
+		j.Uuid = uuid.NewRandom()
+		j.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+		j.Machine = machine.Uuid
+		j.Stage = "prune"
+		j.Task = "prune-task"
+		j.State = "running"
+		rt.Do(func(d Stores) {
+			if _, err := rt.Create(j); err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			// Move the stored Job along directly, so that it ends
+			// without driving the Machine through its Stage.
+			sj := AsJob(rt.Find("jobs", j.Key()))
+			sj.State = state
+			if state != "running" {
+				sj.EndTime = time.Now().Add(-ago)
+			}
+		})
+		return j.Key()
+	}
+	newest := addJob("finished", time.Hour)
+	second := addJob("finished", 2*time.Hour)
+	third := addJob("finished", 3*time.Hour)
+	fourth := addJob("cancelled", 4*time.Hour)
+	failed := addJob("failed", 5*time.Hour)
+	running := addJob("running", 0)
+	current := addJob("finished", 10*time.Hour)
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		m.CurrentJob = uuid.Parse(current)
+		if _, err := rt.Save(m); err != nil {
+			t.Errorf("Failed to save machine: %v", err)
+		}
+	})
+	// report returns the Jobs the report says to prune, with why.
+	report := func() map[string]string {
+		res := map[string]string{}
+		rt.Do(func(d Stores) {
+			for _, p := range rt.JobPruneReport() {
+				res[p.Uuid.String()] = p.Reason
+			}
+		})
+		return res
+	}
+	if got := report(); len(got) != 0 {
+		t.Errorf("Nothing should be pruned by default, not %v", got)
+	}
+	setPrefs(map[string]string{"jobRetentionCount": "2"})
+	if got := report(); len(got) != 2 || got[third] != "count" || got[fourth] != "count" {
+		t.Errorf("Only the two oldest finished Jobs should be pruned by count, not %v", got)
+	}
+	setPrefs(map[string]string{"jobRetentionAge": "5400"})
+	if got := report(); got[failed] != "age" {
+		t.Errorf("Failed Jobs should be pruned by jobRetentionAge when jobRetentionFailedAge is not set, not %v", got)
+	}
+	setPrefs(map[string]string{"jobRetentionAge": "5400", "jobRetentionFailedAge": "3600"})
+	got := report()
+	if len(got) != 4 || got[second] != "age" || got[failed] != "age" {
+		t.Errorf("Old finished and failed Jobs should be pruned by age, not %v", got)
+	}
+	for _, id := range []string{newest, running, current} {
+		if _, ok := got[id]; ok {
+			t.Errorf("Job %s should not be pruned", id)
+		}
+	}
+	rt.PruneJobs()
+	rt.Do(func(d Stores) {
+		for id := range got {
+			if rt.Find("jobs", id) != nil {
+				t.Errorf("Job %s should have been pruned", id)
+			}
+		}
+		for _, id := range []string{newest, running, current} {
+			if rt.Find("jobs", id) == nil {
+				t.Errorf("Job %s should have been kept", id)
+			}
+		}
+	})
+	f, err := os.Open(rt.JobArchivePath(second))
+	if err != nil {
+		t.Fatalf("The log of a pruned Job should have been archived: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("The archived log should be compressed: %v", err)
+	}
+	if buf, err := ioutil.ReadAll(zr); err != nil || !strings.Contains(string(buf), "Log for Job: "+second) {
+		t.Errorf("The archived log should hold the log of the Job: %q %v", string(buf), err)
+	}
+	if _, err := os.Stat((&Job{Job: &models.Job{Uuid: uuid.Parse(second)}}).LogPath(rt)); !os.IsNotExist(err) {
+		t.Errorf("The log of a pruned Job should have been removed: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// maxRetryBackoff is as long as the doubling RetryBackoff of a Task
+// grows, unless the RetryBackoff starts out longer.
+const maxRetryBackoff = time.Hour
+
+// jobRetry reports whether the failed Job j should be tried again on m,
+// and when the retry may start.  j is passed in rather than looked up
+// because it may not have been saved yet.
+func (rt *RequestTracker) jobRetry(m *Machine, j *Job) (bool, time.Time) {
+	if j.State != "failed" || m.Stage != j.Stage || !m.isTaskJob(j) {
+		return false, time.Time{}
+	}
+	to := rt.Find("tasks", j.Task)
+	if to == nil {
+		return false, time.Time{}
+	}
+	t := AsTask(to)
+	if j.Retry >= t.Retries {
+		return false, time.Time{}
+	}
+	backoff := time.Duration(t.RetryBackoff) * time.Second
+	limit := backoff
+	if limit < maxRetryBackoff {
+		limit = maxRetryBackoff
+	}
+	for i := 0; i < j.Retry && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return true, j.EndTime.Add(backoff)
+}
+
+// ExpireJobs fails every running Job that has run for longer than the
+// Timeout of its Task or whose machine agent has stopped sending
+// heartbeats, saves heartbeats that have only been kept in memory for
+// a while, and makes Machines that were parked to retry a failed Job
+// runnable again once its RetryAt has passed.  It does nothing unless
+// the locks needed to update jobs are held.
+func (rt *RequestTracker) ExpireJobs() {
+	for _, prefix := range jobLockMap["update"] {
+		if !rt.locked(prefix) {
+			return
+		}
+	}
+	now := time.Now()
+	for _, i := range rt.stores("jobs").Items() {
+		j := AsJob(i)
+		if !j.Current || j.State != "running" {
+			continue
+		}
+		to := rt.Find("tasks", j.Task)
+		if to == nil || AsTask(to).Timeout == 0 {
+			continue
+		}
+		timeout := time.Duration(AsTask(to).Timeout) * time.Second
+		if now.Sub(j.StartTime) < timeout {
+			continue
+		}
+		nj := AsJob(toBackend(models.Clone(j.Job), rt))
+		nj.State = "failed"
+		nj.ExitState = "timeout"
+		if _, err := rt.Update(nj); err != nil {
+			rt.Errorf("Failed to time out Job %s: %v", j.Key(), err)
+			continue
+		}
+		rt.Infof("Job %s for Task %s on Machine %s timed out after %s", j.Key(), j.Task, j.Machine, timeout)
+		rt.dt.Publish("jobs", "timeout", nj.Key(), nj)
+	}
+	rt.failLostJobs(now)
+	rt.saveHeartbeats()
+	for _, i := range rt.stores("jobs").Items() {
+		j := AsJob(i)
+		if j.RetryAt.IsZero() || now.Before(j.RetryAt) {
+			continue
+		}
+		// Whatever happens, this Job has had its chance to retry.
+		nj := AsJob(toBackend(models.Clone(j.Job), rt))
+		nj.RetryAt = time.Time{}
+		if _, err := rt.Update(nj); err != nil {
+			rt.Errorf("Failed to clear the retry time of Job %s: %v", j.Key(), err)
+			continue
+		}
+		mo := rt.Find("machines", j.Machine.String())
+		if mo == nil {
+			continue
+		}
+		m := AsMachine(mo)
+		if m.Runnable {
+			continue
+		}
+		if retry, _ := rt.jobRetry(m, j); !retry {
+			continue
+		}
+		nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+		nm.Runnable = true
+		if _, err := rt.Update(nm); err != nil {
+			rt.Errorf("Failed to make Machine %s runnable to retry Task %s: %v", m.Key(), j.Task, err)
+			continue
+		}
+		rt.Infof("Machine %s will retry Task %s", m.Key(), j.Task)
+	}
+}
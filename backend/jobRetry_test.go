@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobRetry(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "jobs", "workflows", "rollouts")
+	machine := &models.Machine{Name: "retry", Uuid: uuid.NewRandom(), Stage: "retry", Runnable: true}
+	tests := []crudTest{
+		{"Create Task with negative Timeout", rt.Create, &models.Task{Name: "bad", Timeout: -1}, false},
+		{"Create retry task", rt.Create, &models.Task{Name: "retry-task", Timeout: 60, Retries: 1, RetryBackoff: 60}, true},
+		{"Create retry stage", rt.Create, &models.Stage{Name: "retry", BootEnv: "local", Tasks: []string{"retry-task"}}, true},
+		{"Create retry machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var job *Job
+	// startJob creates a running Job for the Machine's only Task, the
+	// way POST /jobs would.
+	startJob := func(retry int) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			m := AsMachine(rt.Find("machines", machine.UUID()))
+			j := &Job{}
+			Fill(j)
+			j.Uuid = uuid.NewRandom()
+			j.Previous = m.CurrentJob
+			if j.Previous == nil {
+				j.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+			}
+			j.Machine = m.Uuid
+			j.Stage = m.Stage
+			j.Task = m.Tasks[0]
+			j.State = "running"
+			j.Retry = retry
+			if _, err := rt.Create(j); err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			m.CurrentTask = 0
+			m.CurrentJob = j.Uuid
+			if _, err := rt.Save(m); err != nil {
+				t.Errorf("Failed to save machine: %v", err)
+			}
+			job = AsJob(rt.Find("jobs", j.Key()))
+		})
+	}
+	// expire runs ExpireJobs after moving the clock back by ago, and
+	// returns whether the Machine is runnable afterwards.
+	expire := func(ago time.Duration) bool {
+		var res bool
+		rt.Do(func(d Stores) {
+			job.StartTime = job.StartTime.Add(-ago)
+			job.EndTime = job.EndTime.Add(-ago)
+			if !job.RetryAt.IsZero() {
+				job.RetryAt = job.RetryAt.Add(-ago)
+			}
+			rt.ExpireJobs()
+			job = AsJob(rt.Find("jobs", job.Key()))
+			res = AsMachine(rt.Find("machines", machine.UUID())).Runnable
+		})
+		return res
+	}
+	startJob(0)
+	if !expire(time.Second) || job.State != "running" {
+		t.Errorf("Job should still be running, not %s", job.State)
+	}
+	if expire(time.Minute) || job.State != "failed" || job.ExitState != "timeout" {
+		t.Errorf("Job should have timed out and be waiting to retry, not %s/%s", job.State, job.ExitState)
+	}
+	if !expire(time.Minute) {
+		t.Errorf("Machine should be runnable once the backoff has passed")
+	}
+	if !job.RetryAt.IsZero() {
+		t.Errorf("Job should not wait to retry once the Machine is runnable, not until %s", job.RetryAt)
+	}
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		m.Runnable = false
+		if _, err := rt.Save(m); err != nil {
+			t.Errorf("Failed to save machine: %v", err)
+		}
+	})
+	if expire(time.Hour) {
+		t.Errorf("Machine stopped by hand should not be made runnable to retry")
+	}
+	first := job.Uuid
+	startJob(1)
+	if !uuid.Equal(job.Previous, first) {
+		t.Errorf("Retry should follow the Job that failed, not %s", job.Previous)
+	}
+	if expire(time.Minute) || job.State != "failed" {
+		t.Errorf("Retry should have timed out, not %s", job.State)
+	}
+	if expire(time.Hour) {
+		t.Errorf("Machine should not be runnable once its retries are used up")
+	}
+}
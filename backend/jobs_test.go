@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+type cancelRecorder struct {
+	events []*models.Event
+}
+
+func (c *cancelRecorder) Publish(e *models.Event) error {
+	if e.Action == "cancel" {
+		c.events = append(c.events, e)
+	}
+	return nil
+}
+
+func (c *cancelRecorder) Reserve() error { return nil }
+func (c *cancelRecorder) Release()       {}
+func (c *cancelRecorder) Unload()        {}
+
+func TestCancelJob(t *testing.T) {
+	dt := mkDT(nil)
+	rec := &cancelRecorder{}
+	dt.publishers.Add(rec)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "jobs", "workflows", "rollouts")
+	machine := &models.Machine{Name: "cancel", Uuid: uuid.NewRandom(), Stage: "cancel", Runnable: true}
+	tests := []crudTest{
+		{"Create cancel task", rt.Create, &models.Task{Name: "cancel-task"}, true},
+		{"Create cancel stage", rt.Create, &models.Stage{Name: "cancel", BootEnv: "local", Tasks: []string{"cancel-task"}}, true},
+		{"Create cancel machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	job := &Job{}
+	Fill(job)
+	job.Uuid = uuid.NewRandom()
+	job.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+	job.Machine = machine.Uuid
+	job.Stage = "cancel"
+	job.Task = "cancel-task"
+	job.State = "running"
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(job); err != nil {
+			t.Errorf("Failed to create job: %v", err)
+			return
+		}
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		m.CurrentTask = 0
+		m.CurrentJob = job.Uuid
+		if _, err := rt.Save(m); err != nil {
+			t.Errorf("Failed to save machine: %v", err)
+			return
+		}
+		j, err := rt.CancelJob(AsJob(rt.Find("jobs", job.Key())))
+		if err != nil {
+			t.Errorf("Failed to cancel job: %v", err)
+			return
+		}
+		if j.State != "cancelled" || j.EndTime.IsZero() {
+			t.Errorf("Job should be cancelled with an EndTime, not %s at %s", j.State, j.EndTime)
+		}
+		if AsMachine(rt.Find("machines", machine.UUID())).Runnable {
+			t.Errorf("Machine should not be runnable after its job was cancelled")
+		}
+		if _, err := rt.CancelJob(j); err == nil {
+			t.Errorf("Cancelling a cancelled job should fail")
+		}
+		// The machine agent only has the token made for its Machine,
+		// and it must be allowed to see the cancellation.
+		rd := newRenderData(rt, AsMachine(rt.Find("machines", machine.UUID())), nil)
+		claim, err := dt.GetToken(rd.GenerateInfiniteToken())
+		if err != nil {
+			t.Errorf("Failed to get the machine token: %v", err)
+			return
+		}
+		if len(rec.events) != 1 {
+			t.Errorf("Expected 1 cancel event, got %d", len(rec.events))
+			return
+		}
+		e := rec.events[0]
+		if !claim.Match(e.Type, e.Action, e.Key) {
+			t.Errorf("Machine token should be allowed to see %s.%s.%s", e.Type, e.Action, e.Key)
+		}
+		if cj, ok := e.Object.(*Job); !ok || !uuid.Equal(cj.Uuid, job.Uuid) {
+			t.Errorf("Cancel event should carry job %s, not %v", job.Uuid, e.Object)
+		}
+	})
+	rmTests := []crudTest{
+		{"Remove cancelled job", rt.Remove, job, true},
+	}
+	for _, test := range rmTests {
+		test.Test(t, rt)
+	}
+}
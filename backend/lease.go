@@ -10,6 +10,7 @@ import (
 	"github.com/digitalrebar/provision/backend/index"
 	"github.com/digitalrebar/provision/models"
 	"github.com/digitalrebar/store"
+	"github.com/pborman/uuid"
 )
 
 // Lease models a DHCP Lease
@@ -100,6 +101,28 @@ func (l *Lease) Indexes() map[string]index.Maker {
 			lease.Strategy = s
 			return lease, nil
 		})
+	res["Machine"] = index.Make(
+		false,
+		"UUID string",
+		func(i, j models.Model) bool { return fix(i).Machine.String() < fix(j).Machine.String() },
+		func(ref models.Model) (gte, gt index.Test) {
+			refMachine := fix(ref).Machine.String()
+			return func(s models.Model) bool {
+					return fix(s).Machine.String() >= refMachine
+				},
+				func(s models.Model) bool {
+					return fix(s).Machine.String() > refMachine
+				}
+		},
+		func(s string) (models.Model, error) {
+			id := uuid.Parse(s)
+			if id == nil {
+				return nil, fmt.Errorf("Invalid UUID: %s", s)
+			}
+			lease := fix(l.New())
+			lease.Machine = id
+			return lease, nil
+		})
 	res["State"] = index.Make(
 		false,
 		"string",
@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"github.com/digitalrebar/provision/models"
+)
+
+// stateStage returns the Stage that the lifecycle/stages parameter of
+// n says a Machine entering state should be moved to, if any.
+func (n *Machine) stateStage(state string) string {
+	for _, prefix := range []string{"profiles", "stages", "params"} {
+		if !n.rt.locked(prefix) {
+			return ""
+		}
+	}
+	val, ok := n.rt.GetParam(n, "lifecycle/stages", true)
+	if !ok {
+		return ""
+	}
+	stages, ok := val.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	stage, _ := stages[state].(string)
+	return stage
+}
+
+// changeState records that n is moving to a new lifecycle State, and
+// moves it to the Stage for that State unless a Stage was picked as
+// part of the same change.
+func (n *Machine) changeState(from string, pickedStage bool) {
+	n.oldState = from
+	n.stateChanged = true
+	if pickedStage {
+		return
+	}
+	if stage := n.stateStage(n.State); stage != "" {
+		n.Stage = stage
+	}
+}
+
+// publishState sends a "state" event for n if its lifecycle State
+// changed.
+func (n *Machine) publishState() {
+	if !n.stateChanged {
+		return
+	}
+	n.stateChanged = false
+	n.rt.Infof("Machine %s moved from State %s to %s", n.Key(), n.oldState, n.State)
+	n.rt.dt.Publish("machines", "state", n.Key(), &models.MachineStateChange{
+		Machine: n.Uuid,
+		Name:    n.Name,
+		From:    n.oldState,
+		To:      n.State,
+		Stage:   n.Stage,
+	})
+	n.oldState = n.State
+}
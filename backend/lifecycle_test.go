@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+type stateRecorder struct {
+	changes []*models.MachineStateChange
+}
+
+func (s *stateRecorder) Publish(e *models.Event) error {
+	if e.Type == "machines" && e.Action == "state" {
+		s.changes = append(s.changes, e.Object.(*models.MachineStateChange))
+	}
+	return nil
+}
+
+func (s *stateRecorder) Reserve() error { return nil }
+func (s *stateRecorder) Release()       {}
+func (s *stateRecorder) Unload()        {}
+
+func TestMachineLifecycle(t *testing.T) {
+	dt := mkDT(nil)
+	rec := &stateRecorder{}
+	dt.publishers.Add(rec)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "workflows")
+	machine := &models.Machine{
+		Name:   "life",
+		Uuid:   uuid.NewRandom(),
+		Params: map[string]interface{}{"lifecycle/stages": map[string]interface{}{"retired": "wipe"}},
+	}
+	createTests := []crudTest{
+		{"Create wipe Stage", rt.Create, &models.Stage{Name: "wipe", BootEnv: "local"}, true},
+		{"Create with bad State", rt.Create, &models.Machine{Name: "bad", Uuid: uuid.NewRandom(), State: "bogus"}, false},
+		{"Create Machine", rt.Create, machine, true},
+	}
+	for _, test := range createTests {
+		test.Test(t, rt)
+	}
+	if machine.State != models.MachineDiscovered {
+		t.Errorf("New machines should be discovered, not %s", machine.State)
+	}
+	move := func(state string, force, pass bool) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			m := AsMachine(rt.Find("machines", machine.UUID()))
+			nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+			nm.State = state
+			if force {
+				nm.ForceChange()
+			}
+			_, err := rt.Update(nm)
+			if pass && err != nil {
+				t.Errorf("Moving to %s failed: %v", state, err)
+			} else if !pass && err == nil {
+				t.Errorf("Moving to %s should have failed", state)
+			}
+		})
+	}
+	move(models.MachineInUse, false, false)
+	move("bogus", true, false)
+	move(models.MachineProvisioning, false, true)
+	move(models.MachineRetired, false, true)
+	move(models.MachineInUse, false, false)
+	move(models.MachineInUse, true, true)
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		if m.Stage != "wipe" {
+			t.Errorf("Retiring the machine should have moved it to the wipe Stage, not %s", m.Stage)
+		}
+		maker := m.Indexes()["State"]
+		res, err := index.All(index.Sort(maker), index.Eq(models.MachineInUse))(&d("machines").Index)
+		if err != nil || res.Count() != 1 {
+			t.Errorf("Expected 1 in-use machine: %v", err)
+		}
+	})
+	expect := []string{"", models.MachineDiscovered, models.MachineProvisioning, models.MachineRetired, models.MachineInUse}
+	if len(rec.changes) != len(expect)-1 {
+		t.Fatalf("Expected %d state events, got %d", len(expect)-1, len(rec.changes))
+	}
+	for i, c := range rec.changes {
+		if c.From != expect[i] || c.To != expect[i+1] || !uuid.Equal(c.Machine, machine.Uuid) {
+			t.Errorf("Event %d: expected %s -> %s, got %s -> %s", i, expect[i], expect[i+1], c.From, c.To)
+		}
+	}
+	if rec.changes[2].Stage != "wipe" {
+		t.Errorf("Retired event should report the wipe Stage, not %s", rec.changes[2].Stage)
+	}
+}
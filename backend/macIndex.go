@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"net"
+	"sync"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// macOwner is what the macIndex knows about a Machine.
+type macOwner struct {
+	name string
+	// MACs the Machine lists in its Interfaces, then the ones it only
+	// has in its Inventory.
+	intfs, inv []string
+}
+
+// macIndex maps hardware addresses to the Machines that have them, so
+// that they can be found without scanning every Machine.  It is kept
+// up to date from the change events for Machines.
+type macIndex struct {
+	sync.Mutex
+	owners map[string]*macOwner
+	// For each MAC, the UUIDs of the Machines that have it, mapped to
+	// whether it is in their Interfaces.
+	macs map[string]map[string]bool
+}
+
+func newMacIndex() *macIndex {
+	return &macIndex{
+		owners: map[string]*macOwner{},
+		macs:   map[string]map[string]bool{},
+	}
+}
+
+func canonicalMAC(mac string) string {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return hw.String()
+	}
+	return mac
+}
+
+// interfaceMACs returns the MACs of the Interfaces of m, and the ones
+// it only has in its Inventory.
+func interfaceMACs(m *models.Machine) (intfs, inv []string) {
+	for _, intf := range m.Interfaces {
+		intfs = append(intfs, canonicalMAC(intf.MAC))
+	}
+	if m.Inventory != nil {
+		for _, nic := range m.Inventory.NICs {
+			inv = append(inv, canonicalMAC(nic.MAC))
+		}
+	}
+	return
+}
+
+// machineMACs returns all the MACs of m.
+func machineMACs(m *models.Machine) []string {
+	intfs, inv := interfaceMACs(m)
+	return append(intfs, inv...)
+}
+
+// set records the MACs of m, replacing what was known about it.
+func (x *macIndex) set(m *models.Machine) {
+	x.Lock()
+	defer x.Unlock()
+	x.remove(m.Key())
+	o := &macOwner{name: m.Name}
+	o.intfs, o.inv = interfaceMACs(m)
+	for _, mac := range o.inv {
+		x.add(mac, m.Key(), false)
+	}
+	for _, mac := range o.intfs {
+		x.add(mac, m.Key(), true)
+	}
+	x.owners[m.Key()] = o
+}
+
+// add notes that the Machine with UUID key has mac.  The index must be
+// locked.
+func (x *macIndex) add(mac, key string, intf bool) {
+	if x.macs[mac] == nil {
+		x.macs[mac] = map[string]bool{}
+	}
+	x.macs[mac][key] = x.macs[mac][key] || intf
+}
+
+// remove forgets the Machine with UUID key.  The index must be locked.
+func (x *macIndex) remove(key string) {
+	o, ok := x.owners[key]
+	if !ok {
+		return
+	}
+	for _, macs := range [][]string{o.intfs, o.inv} {
+		for _, mac := range macs {
+			delete(x.macs[mac], key)
+			if len(x.macs[mac]) == 0 {
+				delete(x.macs, mac)
+			}
+		}
+	}
+	delete(x.owners, key)
+}
+
+// update follows action being taken on the Machine with UUID key,
+// which is now ref.  Events that do not carry the Machine itself,
+// such as state changes, are ignored.
+func (x *macIndex) update(action, key string, ref interface{}) {
+	if action == "delete" {
+		x.Lock()
+		defer x.Unlock()
+		x.remove(key)
+		return
+	}
+	if m, ok := ref.(*Machine); ok {
+		x.set(m.Machine)
+	}
+}
+
+// owner returns the UUID and Name of the Machine that has mac.  A
+// Machine that lists mac in its Interfaces wins over one that only has
+// it in its Inventory, and among those the lowest UUID wins, so the
+// answer does not change from one call to the next.
+func (x *macIndex) owner(mac string) (uuid, name string, found bool) {
+	x.Lock()
+	defer x.Unlock()
+	best := false
+	for key, intf := range x.macs[canonicalMAC(mac)] {
+		if !found || (intf && !best) || (intf == best && key < uuid) {
+			uuid, best, found = key, intf, true
+		}
+	}
+	if found {
+		name = x.owners[uuid].name
+	}
+	return
+}
+
+// MachineOwningMAC returns the UUID and Name of the Machine that has
+// mac in its Interfaces or Inventory.  It does not need any locks.
+func (p *DataTracker) MachineOwningMAC(mac string) (uuid, name string, found bool) {
+	return p.macIndex.owner(mac)
+}
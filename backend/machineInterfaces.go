@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"net/http"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+// MachineForMAC returns the Machine that owns mac, or nil if no Machine
+// does.  A Machine that lists mac in its Interfaces wins over one that
+// only has it in its Inventory.  The caller must hold the machines
+// lock.
+func (rt *RequestTracker) MachineForMAC(mac string) *Machine {
+	key, _, found := rt.dt.MachineOwningMAC(mac)
+	if !found {
+		return nil
+	}
+	if m := rt.Find("machines", key); m != nil {
+		return AsMachine(m)
+	}
+	return nil
+}
+
+// ReserveInterfaces makes sure that every Interface of m that has an
+// Address has a matching MAC Reservation, creating the ones that are
+// missing.  The ones it creates are linked to m, so they go away when
+// the Interface changes or m is deleted.  It returns the Reservations
+// for m, and fails if an address is already reserved for something
+// else.  The caller must hold the
+// machines, reservations, and subnets locks.
+func (rt *RequestTracker) ReserveInterfaces(m *Machine) ([]*models.Reservation, error) {
+	e := &models.Error{
+		Code:  http.StatusConflict,
+		Type:  "Conflict",
+		Model: m.Prefix(),
+		Key:   m.Key(),
+	}
+	res := []*models.Reservation{}
+	for _, intf := range m.Interfaces {
+		if intf.Address == nil {
+			continue
+		}
+		if found := rt.Find("reservations", models.Hexaddr(intf.Address)); found != nil {
+			r := AsReservation(found)
+			if r.Strategy != "MAC" || r.Token != intf.MAC {
+				e.Errorf("Address %s of interface %s is reserved for %s:%s", intf.Address, intf.Name, r.Strategy, r.Token)
+				continue
+			}
+			res = append(res, r.Reservation)
+			continue
+		}
+		r := &models.Reservation{
+			Addr:     intf.Address,
+			Token:    intf.MAC,
+			Strategy: "MAC",
+			Machine:  m.Uuid,
+		}
+		if _, err := rt.Create(r); err != nil {
+			e.AddError(err)
+			continue
+		}
+		res = append(res, r)
+	}
+	return res, e.HasError()
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"net"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestMachineInterfaces(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "workflows", "subnets", "reservations")
+	intf := func(name, mac, addr, subnet string) models.MachineInterface {
+		return models.MachineInterface{Name: name, MAC: mac, Address: net.ParseIP(addr), Subnet: subnet}
+	}
+	m1 := &models.Machine{Name: "nic1", Uuid: uuid.NewRandom(), Interfaces: []models.MachineInterface{
+		intf("eth0", "52:54:00:CC:00:01", "192.168.124.10", "data"),
+		intf("bmc", "52:54:00:cc:00:02", "", ""),
+	}}
+	createTests := []crudTest{
+		{"Create Subnet", rt.Create, &models.Subnet{Name: "data", Subnet: "192.168.124.0/24", ActiveStart: net.ParseIP("192.168.124.80"), ActiveEnd: net.ParseIP("192.168.124.254"), ActiveLeaseTime: 60, ReservedLeaseTime: 7200, Strategy: "MAC"}, true},
+		{"Create with bad MAC", rt.Create, &models.Machine{Name: "bad1", Uuid: uuid.NewRandom(), Interfaces: []models.MachineInterface{intf("eth0", "fred", "", "")}}, false},
+		{"Create with duplicate name", rt.Create, &models.Machine{Name: "bad2", Uuid: uuid.NewRandom(), Interfaces: []models.MachineInterface{intf("eth0", "52:54:00:cc:00:09", "", ""), intf("eth0", "52:54:00:cc:00:0a", "", "")}}, false},
+		{"Create with missing Subnet", rt.Create, &models.Machine{Name: "bad3", Uuid: uuid.NewRandom(), Interfaces: []models.MachineInterface{intf("eth0", "52:54:00:cc:00:09", "192.168.124.11", "fred")}}, false},
+		{"Create with address outside Subnet", rt.Create, &models.Machine{Name: "bad4", Uuid: uuid.NewRandom(), Interfaces: []models.MachineInterface{intf("eth0", "52:54:00:cc:00:09", "10.0.0.1", "data")}}, false},
+		{"Create with interfaces", rt.Create, m1, true},
+		{"Create with MAC of another machine", rt.Create, &models.Machine{Name: "bad5", Uuid: uuid.NewRandom(), Interfaces: []models.MachineInterface{intf("eth1", "52-54-00-cc-00-02", "", "")}}, false},
+		{"Delete Subnet in use", rt.Remove, &models.Subnet{Name: "data"}, false},
+	}
+	for _, test := range createTests {
+		test.Test(t, rt)
+	}
+	if m1.Interfaces[0].MAC != "52:54:00:cc:00:01" {
+		t.Errorf("Interface MAC was not normalized: %s", m1.Interfaces[0].MAC)
+	}
+	rt.Do(func(d Stores) {
+		if m := rt.MachineForMAC("52:54:00:CC:00:02"); m == nil || m.Name != "nic1" {
+			t.Errorf("Expected MAC to belong to nic1, got %v", m)
+		}
+		if m := rt.MachineForMAC("52:54:00:cc:00:03"); m != nil {
+			t.Errorf("Expected MAC to belong to no machine, got %s", m.Name)
+		}
+		m := AsMachine(rt.Find("machines", m1.UUID()))
+		for i := 0; i < 2; i++ {
+			res, err := rt.ReserveInterfaces(m)
+			if err != nil {
+				t.Errorf("Failed to reserve interfaces: %v", err)
+			}
+			if len(res) != 1 || res[0].Token != "52:54:00:cc:00:01" {
+				t.Errorf("Expected 1 reservation for eth0, got %v", res)
+			} else if !uuid.Equal(res[0].Machine, m1.Uuid) {
+				t.Errorf("Expected the reservation for eth0 to be linked to nic1, got %s", res[0].Machine)
+			}
+		}
+		if _, err := rt.Remove(&models.Reservation{Addr: net.ParseIP("192.168.124.10")}); err != nil {
+			t.Errorf("Failed to remove reservation: %v", err)
+		}
+		if _, err := rt.Create(&models.Reservation{Addr: net.ParseIP("192.168.124.10"), Token: "52:54:00:cc:00:ff", Strategy: "MAC"}); err != nil {
+			t.Errorf("Failed to create reservation: %v", err)
+		}
+		if _, err := rt.ReserveInterfaces(m); err == nil {
+			t.Errorf("Reserving an address reserved for another MAC should have failed")
+		}
+	})
+	dt.Publish("machines", "state", m1.UUID(), &models.MachineStateChange{})
+	if key, name, found := dt.MachineOwningMAC("52:54:00:cc:00:01"); !found || key != m1.UUID() || name != "nic1" {
+		t.Errorf("Expected MAC to still belong to nic1 after a state event, got %s (%s)", key, name)
+	}
+	drt := dt.Request(dt.Logger, machineLockMap["delete"]...)
+	drt.Do(func(d Stores) {
+		if _, err := drt.Remove(m1); err != nil {
+			t.Errorf("Failed to remove machine: %v", err)
+		}
+	})
+	if _, _, found := dt.MachineOwningMAC("52:54:00:cc:00:01"); found {
+		t.Errorf("Expected MAC to belong to no machine after removing nic1")
+	}
+}
+
+func TestMacIndexOwner(t *testing.T) {
+	const mac = "52:54:00:cc:00:10"
+	x := newMacIndex()
+	inv := &models.Inventory{NICs: []models.InventoryNIC{{Name: "eth0", MAC: mac}}}
+	x.set(&models.Machine{Name: "inv-b", Uuid: uuid.Parse("00000000-0000-0000-0000-00000000000b"), Inventory: inv})
+	x.set(&models.Machine{Name: "inv-a", Uuid: uuid.Parse("00000000-0000-0000-0000-00000000000a"), Inventory: inv})
+	for i := 0; i < 10; i++ {
+		if _, name, _ := x.owner(mac); name != "inv-a" {
+			t.Fatalf("Expected the lowest UUID to own the MAC, got %s", name)
+		}
+	}
+	intfs := []models.MachineInterface{{Name: "eth0", MAC: mac}}
+	x.set(&models.Machine{Name: "intf-d", Uuid: uuid.Parse("00000000-0000-0000-0000-00000000000d"), Interfaces: intfs})
+	x.set(&models.Machine{Name: "intf-c", Uuid: uuid.Parse("00000000-0000-0000-0000-00000000000c"), Interfaces: intfs})
+	for i := 0; i < 10; i++ {
+		if _, name, _ := x.owner(mac); name != "intf-c" {
+			t.Fatalf("Expected the lowest UUID with the MAC in its Interfaces to own it, got %s", name)
+		}
+	}
+}
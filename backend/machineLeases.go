@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"strconv"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// reservesAddresses returns whether the reserveMachineAddresses
+// preference is turned on.
+func (rt *RequestTracker) reservesAddresses() bool {
+	res, _ := strconv.ParseBool(rt.dt.pref("reserveMachineAddresses"))
+	return res
+}
+
+// linkMachine points l at the Machine that owns its Token.
+func (l *Lease) linkMachine(rt *RequestTracker) {
+	l.Machine = nil
+	if l.Strategy != "MAC" {
+		return
+	}
+	if key, _, found := rt.dt.MachineOwningMAC(l.Token); found {
+		l.Machine = uuid.Parse(key)
+	}
+}
+
+// addressMAC returns the MAC that the Address of n should be reserved
+// for.  That is the MAC holding the Lease for the Address if it
+// belongs to n, or else the MAC of the Interface that has the Address.
+func (n *Machine) addressMAC() string {
+	if found := n.rt.Find("leases", models.Hexaddr(n.Address)); found != nil {
+		l := AsLease(found)
+		if l.Strategy == "MAC" && n.HasMAC(l.Token) {
+			return l.Token
+		}
+	}
+	for _, intf := range n.Interfaces {
+		if intf.Address.Equal(n.Address) {
+			return intf.MAC
+		}
+	}
+	return ""
+}
+
+// syncLeases points every Lease for one of the MACs of n at n, and
+// unlinks the ones that n no longer owns.  If deleted is true, all of
+// them are unlinked.
+func (n *Machine) syncLeases(deleted bool) {
+	for _, key := range n.rt.dt.addressIndex.leasesFor(n.Machine, true) {
+		i := n.rt.Find("leases", key)
+		if i == nil {
+			continue
+		}
+		l := AsLease(i)
+		owned := !deleted && l.Strategy == "MAC" && n.HasMAC(l.Token)
+		if owned == uuid.Equal(l.Machine, n.Uuid) {
+			continue
+		}
+		if owned {
+			l.Machine = n.Uuid
+		} else {
+			l.Machine = nil
+		}
+		n.rt.Save(l)
+	}
+}
+
+// syncReservations keeps the Reservation made for the Address of n in
+// step with it when the reserveMachineAddresses preference is on.
+// Reservations made for n that no longer match its Address or one of
+// its Interfaces are removed, as are all of them if deleted is true.
+func (n *Machine) syncReservations(deleted bool) {
+	mac := ""
+	if !deleted && n.rt.reservesAddresses() && n.Address != nil && !n.Address.IsUnspecified() {
+		mac = n.addressMAC()
+	}
+	for _, key := range n.rt.dt.addressIndex.reservationsFor(n.Machine, false) {
+		i := n.rt.Find("reservations", key)
+		if i == nil {
+			continue
+		}
+		r := AsReservation(i)
+		if mac != "" && r.Token == mac && r.Addr.Equal(n.Address) {
+			mac = ""
+			continue
+		}
+		if !deleted && n.reservedByInterface(r) {
+			continue
+		}
+		n.rt.Remove(r)
+	}
+	if mac == "" {
+		return
+	}
+	if found := n.rt.Find("reservations", models.Hexaddr(n.Address)); found != nil {
+		r := AsReservation(found)
+		if r.Strategy != "MAC" || r.Token != mac {
+			n.rt.Warnf("Not reserving %s for Machine %s, it is reserved for %s:%s", n.Address, n.Name, r.Strategy, r.Token)
+		}
+		return
+	}
+	r := &models.Reservation{
+		Addr:     n.Address,
+		Token:    mac,
+		Strategy: "MAC",
+		Machine:  n.Uuid,
+	}
+	if _, err := n.rt.Create(r); err != nil {
+		n.rt.Warnf("Failed to reserve %s for Machine %s: %v", n.Address, n.Name, err)
+	}
+}
+
+// reservedByInterface returns whether r reserves the Address of one of
+// the Interfaces of n for its MAC.
+func (n *Machine) reservedByInterface(r *Reservation) bool {
+	for _, intf := range n.Interfaces {
+		if intf.Address != nil && r.Token == intf.MAC && r.Addr.Equal(intf.Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncAddressing brings the Leases and Reservations that refer to n up
+// to date.  It does nothing unless the leases and reservations locks
+// are held.
+func (n *Machine) syncAddressing(deleted bool) {
+	if !n.rt.locked("leases") || !n.rt.locked("reservations") {
+		return
+	}
+	n.syncLeases(deleted)
+	n.syncReservations(deleted)
+}
+
+// MachineLeases returns the Leases handed out to the MACs of m.  The
+// caller must hold the leases lock.
+func (rt *RequestTracker) MachineLeases(m *Machine) []*models.Lease {
+	res := []*models.Lease{}
+	for _, key := range rt.dt.addressIndex.leasesFor(m.Machine, true) {
+		i := rt.Find("leases", key)
+		if i == nil {
+			continue
+		}
+		l := AsLease(i)
+		if l.Strategy == "MAC" && m.HasMAC(l.Token) {
+			res = append(res, l.Lease)
+		}
+	}
+	return res
+}
+
+// MachineReservations returns the Reservations for the MACs of m, and
+// the ones that were made for it.  The caller must hold the
+// reservations lock.
+func (rt *RequestTracker) MachineReservations(m *Machine) []*models.Reservation {
+	res := []*models.Reservation{}
+	for _, key := range rt.dt.addressIndex.reservationsFor(m.Machine, true) {
+		i := rt.Find("reservations", key)
+		if i == nil {
+			continue
+		}
+		r := AsReservation(i)
+		if uuid.Equal(r.Machine, m.Uuid) || (r.Strategy == "MAC" && m.HasMAC(r.Token)) {
+			res = append(res, r.Reservation)
+		}
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestMachineLeases(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "workflows", "subnets", "reservations", "leases", "preferences", "jobs")
+	addr := func(s string) net.IP { return net.ParseIP(s).To4() }
+	machine := &models.Machine{
+		Name:       "leased",
+		Uuid:       uuid.NewRandom(),
+		Address:    addr("192.168.124.80"),
+		Interfaces: []models.MachineInterface{{Name: "eth0", MAC: "52:54:00:dd:00:01"}},
+	}
+	createTests := []crudTest{
+		{"Create Subnet", rt.Create, &models.Subnet{Name: "data", Subnet: "192.168.124.0/24", ActiveStart: addr("192.168.124.80"), ActiveEnd: addr("192.168.124.254"), ActiveLeaseTime: 60, ReservedLeaseTime: 7200, Strategy: "MAC"}, true},
+		{"Create Lease", rt.Create, &models.Lease{Addr: addr("192.168.124.80"), Token: "52:54:00:dd:00:01", Strategy: "MAC", ExpireTime: time.Now().Add(time.Hour)}, true},
+		{"Create other Lease", rt.Create, &models.Lease{Addr: addr("192.168.124.90"), Token: "52:54:00:dd:00:02", Strategy: "MAC", ExpireTime: time.Now().Add(time.Hour)}, true},
+	}
+	for _, test := range createTests {
+		test.Test(t, rt)
+	}
+	check := func(leaseAddr string, owner uuid.UUID, reserved ...string) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			l := AsLease(rt.Find("leases", models.Hexaddr(addr(leaseAddr))))
+			if !uuid.Equal(l.Machine, owner) {
+				t.Errorf("Expected Lease %s to belong to %v, not %v", leaseAddr, owner, l.Machine)
+			}
+			res := []string{}
+			for _, i := range d("reservations").Items() {
+				if r := AsReservation(i); uuid.Equal(r.Machine, machine.Uuid) {
+					res = append(res, r.Addr.String())
+				}
+			}
+			if len(res) != len(reserved) || (len(res) == 1 && res[0] != reserved[0]) {
+				t.Errorf("Expected reservations %v, got %v", reserved, res)
+			}
+		})
+	}
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{"reserveMachineAddresses": "maybe"}); err == nil {
+			t.Errorf("Setting reserveMachineAddresses to maybe should have failed")
+		}
+		if err := dt.SetPrefs(rt, map[string]string{"reserveMachineAddresses": "true"}); err != nil {
+			t.Errorf("Failed to set reserveMachineAddresses: %v", err)
+		}
+		if _, err := rt.Create(machine); err != nil {
+			t.Fatalf("Failed to create machine: %v", err)
+		}
+	})
+	check("192.168.124.80", machine.Uuid, "192.168.124.80")
+	check("192.168.124.90", nil, "192.168.124.80")
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		if len(rt.MachineLeases(m)) != 1 || len(rt.MachineReservations(m)) != 1 {
+			t.Errorf("Expected 1 lease and 1 reservation for the machine")
+		}
+		nm := models.Clone(m.Machine).(*models.Machine)
+		nm.Address = addr("192.168.124.91")
+		nm.Interfaces = append(nm.Interfaces, models.MachineInterface{Name: "eth1", MAC: "52:54:00:dd:00:02", Address: addr("192.168.124.91")})
+		if _, err := rt.Update(nm); err != nil {
+			t.Errorf("Failed to update machine: %v", err)
+		}
+	})
+	check("192.168.124.80", machine.Uuid, "192.168.124.91")
+	check("192.168.124.90", machine.Uuid, "192.168.124.91")
+	rt.Do(func(d Stores) {
+		if _, err := rt.Remove(machine); err != nil {
+			t.Errorf("Failed to remove machine: %v", err)
+		}
+	})
+	check("192.168.124.80", nil)
+	check("192.168.124.90", nil)
+}
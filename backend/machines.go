@@ -7,9 +7,13 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"os"
 	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/digitalrebar/provision/backend/index"
 	"github.com/digitalrebar/provision/models"
@@ -27,6 +31,15 @@ type Machine struct {
 	oldBootEnv string
 	// used during AfterSave() and AfterRemove() to handle boot environment changes.
 	oldStage string
+	// used during AfterSave() to announce lifecycle State changes.
+	oldState     string
+	stateChanged bool
+	// set while OnLoad runs, when everything in the Machine came from
+	// the backing store.
+	loading bool
+	// the heartbeats kept in memory for the Machines in the stores,
+	// so that the LastSeen index sees ones that are not saved yet.
+	beats *heartbeats
 }
 
 func (obj *Machine) SetReadOnly(b bool) {
@@ -109,6 +122,60 @@ func (n *Machine) Indexes() map[string]index.Maker {
 			m.BootEnv = s
 			return m, nil
 		})
+	res["Workflow"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Workflow < fix(j).Workflow },
+		func(ref models.Model) (gte, gt index.Test) {
+			refWorkflow := fix(ref).Workflow
+			return func(s models.Model) bool {
+					return fix(s).Workflow >= refWorkflow
+				},
+				func(s models.Model) bool {
+					return fix(s).Workflow > refWorkflow
+				}
+		},
+		func(s string) (models.Model, error) {
+			m := fix(n.New())
+			m.Workflow = s
+			return m, nil
+		})
+	res["State"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).State < fix(j).State },
+		func(ref models.Model) (gte, gt index.Test) {
+			refState := fix(ref).State
+			return func(s models.Model) bool {
+					return fix(s).State >= refState
+				},
+				func(s models.Model) bool {
+					return fix(s).State > refState
+				}
+		},
+		func(s string) (models.Model, error) {
+			m := fix(n.New())
+			m.State = s
+			return m, nil
+		})
+	res["Pool"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Pool < fix(j).Pool },
+		func(ref models.Model) (gte, gt index.Test) {
+			refPool := fix(ref).Pool
+			return func(s models.Model) bool {
+					return fix(s).Pool >= refPool
+				},
+				func(s models.Model) bool {
+					return fix(s).Pool > refPool
+				}
+		},
+		func(s string) (models.Model, error) {
+			m := fix(n.New())
+			m.Pool = s
+			return m, nil
+		})
 	res["Address"] = index.Make(
 		false,
 		"IP Address",
@@ -169,6 +236,106 @@ func (n *Machine) Indexes() map[string]index.Maker {
 			}
 			return res, nil
 		})
+	lastSeen := func(m models.Model) time.Time {
+		if h := fix(m).lastHeartbeat(); h != nil {
+			return h.LastSeen
+		}
+		return time.Time{}
+	}
+	res["LastSeen"] = index.Make(
+		false,
+		"dateTime",
+		func(i, j models.Model) bool {
+			return lastSeen(i).Before(lastSeen(j))
+		},
+		func(ref models.Model) (gte, gt index.Test) {
+			refTime := lastSeen(ref)
+			return func(s models.Model) bool {
+					cmpTime := lastSeen(s)
+					return refTime.Equal(cmpTime) || cmpTime.After(refTime)
+				},
+				func(s models.Model) bool {
+					return lastSeen(s).After(refTime)
+				}
+		},
+		func(s string) (models.Model, error) {
+			parsedTime, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, err
+			}
+			m := fix(n.New())
+			m.Heartbeat = &models.MachineHeartbeat{LastSeen: parsedTime}
+			return m, nil
+		})
+	inv := func(m models.Model) *models.Inventory {
+		if i := fix(m).Inventory; i != nil {
+			return i
+		}
+		return &models.Inventory{}
+	}
+	res["Vendor"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return inv(i).System.Vendor < inv(j).System.Vendor },
+		func(ref models.Model) (gte, gt index.Test) {
+			refVendor := inv(ref).System.Vendor
+			return func(s models.Model) bool {
+					return inv(s).System.Vendor >= refVendor
+				},
+				func(s models.Model) bool {
+					return inv(s).System.Vendor > refVendor
+				}
+		},
+		func(s string) (models.Model, error) {
+			m := fix(n.New())
+			m.Inventory = &models.Inventory{System: models.InventorySystem{Vendor: s}}
+			return m, nil
+		})
+	res["SerialNumber"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return inv(i).System.SerialNumber < inv(j).System.SerialNumber },
+		func(ref models.Model) (gte, gt index.Test) {
+			refSerial := inv(ref).System.SerialNumber
+			return func(s models.Model) bool {
+					return inv(s).System.SerialNumber >= refSerial
+				},
+				func(s models.Model) bool {
+					return inv(s).System.SerialNumber > refSerial
+				}
+		},
+		func(s string) (models.Model, error) {
+			m := fix(n.New())
+			m.Inventory = &models.Inventory{System: models.InventorySystem{SerialNumber: s}}
+			return m, nil
+		})
+	res["Memory"] = index.Make(
+		false,
+		"integer",
+		func(i, j models.Model) bool { return inv(i).Memory < inv(j).Memory },
+		func(ref models.Model) (gte, gt index.Test) {
+			refMemory := inv(ref).Memory
+			return func(s models.Model) bool {
+					return inv(s).Memory >= refMemory
+				},
+				func(s models.Model) bool {
+					return inv(s).Memory > refMemory
+				}
+		},
+		func(s string) (models.Model, error) {
+			mem, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid memory size: %s", s)
+			}
+			m := fix(n.New())
+			m.Inventory = &models.Inventory{Memory: mem}
+			return m, nil
+		})
+	res["MAC"] = index.MakeContains(
+		"MAC Address",
+		func(m models.Model, mac string) bool {
+			return fix(m).HasMAC(mac)
+		})
 	return res
 }
 
@@ -296,6 +463,35 @@ func (n *Machine) ParameterMaker(rt *RequestTracker, parameter string) (index.Ma
 
 }
 
+// MachineFilters turns filter, which is in the same form as the query
+// parameters of a Machine list, into the Filters to pass to
+// index.All.  Keys that are not Machine indexes are treated as Params.
+func (rt *RequestTracker) MachineFilters(filter map[string]string) ([]index.Filter, error) {
+	ref := &Machine{Machine: &models.Machine{}}
+	indexes := ref.Indexes()
+	keys := make([]string, 0, len(filter))
+	for k := range filter {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := []index.Filter{}
+	for _, k := range keys {
+		maker, ok := indexes[k]
+		if !ok {
+			var err error
+			if maker, err = ref.ParameterMaker(rt, k); err != nil {
+				return nil, err
+			}
+		}
+		f, err := index.ParseFilter(filter[k])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, index.Sort(maker), f)
+	}
+	return append(res, index.Native()), nil
+}
+
 // HexAddress returns Address in raw hexadecimal format, suitable for
 // pxelinux and elilo usage.
 func (n *Machine) HexAddress() string {
@@ -334,9 +530,32 @@ func (n *Machine) New() store.KeySaver {
 	return res
 }
 
+// applyWorkflow places the machine in the first Stage of its
+// Workflow.  It needs the workflows lock to do that, and adds an
+// error to e when it does not have it.
+func (n *Machine) applyWorkflow(e models.ErrorAdder) {
+	if n.Workflow == "" {
+		return
+	}
+	if !n.rt.locked("workflows") {
+		e.Errorf("Workflow %s cannot be applied without the workflows lock", n.Workflow)
+		return
+	}
+	if wo := n.rt.Find("workflows", n.Workflow); wo != nil {
+		if wf := AsWorkflow(wo); len(wf.Stages) > 0 {
+			n.Stage = wf.Stages[0].Stage
+		}
+	}
+}
+
 func (n *Machine) OnCreate() error {
 	n.oldStage = "none"
 	n.oldBootEnv = "local"
+	if n.State == "" {
+		n.State = models.MachineDiscovered
+	}
+	n.applyWorkflow(n)
+	n.changeState("", n.Stage != "")
 	if n.Stage == "" {
 		n.Stage = n.rt.dt.pref("defaultStage")
 	}
@@ -360,6 +579,46 @@ func (n *Machine) OnCreate() error {
 	return n.MakeError(422, ValidationError, n)
 }
 
+// validateInterfaces makes sure that no other Machine claims the MACs
+// of our Interfaces, and that their addresses fit their Subnets.
+func (n *Machine) validateInterfaces() {
+	if len(n.Interfaces) == 0 {
+		return
+	}
+	for _, mine := range n.Interfaces {
+		key, _, found := n.rt.dt.MachineOwningMAC(mine.MAC)
+		if !found || key == n.UUID() {
+			continue
+		}
+		o := n.rt.Find("machines", key)
+		if o == nil {
+			continue
+		}
+		other := AsMachine(o)
+		for _, intf := range other.Interfaces {
+			if intf.MAC == mine.MAC {
+				n.Errorf("MAC %s already belongs to interface %s of Machine %s", intf.MAC, intf.Name, other.Name)
+			}
+		}
+	}
+	if !n.rt.locked("subnets") {
+		return
+	}
+	for _, intf := range n.Interfaces {
+		if intf.Subnet == "" {
+			continue
+		}
+		so := n.rt.Find("subnets", intf.Subnet)
+		if so == nil {
+			n.Errorf("Interface %s wants Subnet %s, which does not exist", intf.Name, intf.Subnet)
+			continue
+		}
+		if intf.Address != nil && !AsSubnet(so).InSubnetRange(intf.Address) {
+			n.Errorf("Interface %s address %s is not usable in Subnet %s", intf.Name, intf.Address, intf.Subnet)
+		}
+	}
+}
+
 func (n *Machine) Validate() {
 	if n.Uuid == nil {
 		n.Errorf("Machine %#v was not assigned a uuid!", n)
@@ -367,6 +626,7 @@ func (n *Machine) Validate() {
 	n.Machine.Validate()
 	validateMaybeZeroIP4(n, n.Address)
 	n.AddError(index.CheckUnique(n, n.rt.stores("machines").Items()))
+	n.validateInterfaces()
 	n.SetValid()
 	objs := n.rt.stores
 	tasks := objs("tasks")
@@ -429,6 +689,7 @@ func (n *Machine) Validate() {
 					}
 					n.Tasks = make([]string, len(stage.Tasks))
 					copy(n.Tasks, stage.Tasks)
+					n.TaskJobs = nil
 					if len(n.Tasks) > 0 {
 						n.CurrentTask = -1
 					} else {
@@ -466,6 +727,15 @@ func (n *Machine) Validate() {
 			n.Errorf("Task %s (at %d) does not exist", taskName, i)
 		}
 	}
+	if n.Workflow != "" && n.rt.locked("workflows") {
+		if workflows := objs("workflows"); workflows != nil {
+			if wo := workflows.Find(n.Workflow); wo == nil {
+				n.Errorf("Workflow %s does not exist", n.Workflow)
+			} else if !AsWorkflow(wo).Available {
+				n.Errorf("Workflow %s is not available", n.Workflow)
+			}
+		}
+	}
 	n.SetAvailable()
 }
 
@@ -474,6 +744,7 @@ func (n *Machine) BeforeSave() error {
 	if n.Secret == "" {
 		n.Secret = randString(16)
 	}
+	n.beats = n.rt.dt.heartbeats
 	if n.oldStage == "" && n.Stage != "" {
 		n.oldStage = n.Stage
 	}
@@ -481,10 +752,26 @@ func (n *Machine) BeforeSave() error {
 	if n.oldBootEnv == "" && n.BootEnv != "" {
 		n.oldBootEnv = n.BootEnv
 	}
+	var old map[string]interface{}
+	if n.loading {
+		old = n.Params
+	} else if o := n.rt.Find("machines", n.Key()); o != nil {
+		old = AsMachine(o).Params
+	}
+	unredactParams(old, n.Params, n)
 	n.Validate()
 	if !n.Useable() {
 		return n.MakeError(422, ValidationError, n)
 	}
+	errCount := len(n.Errors)
+	n.rt.validateParams(old, n.Params, n)
+	if len(n.Errors) == errCount {
+		n.rt.sealParams(old, n.Params, n)
+	}
+	if len(n.Errors) != errCount {
+		n.SetInvalid()
+		return n.MakeError(422, ValidationError, n)
+	}
 	if !n.Available {
 		n.Runnable = false
 	}
@@ -515,13 +802,19 @@ func (n *Machine) BeforeSave() error {
 }
 func (n *Machine) AfterSave() {
 	n.oldStage = n.Stage
+	n.syncAddressing(false)
+	n.publishState()
 }
 
 func (n *Machine) OnLoad() error {
 	if n.Stage == "" {
 		n.Stage = "none"
 	}
-	defer func() { n.rt = nil }()
+	if n.State == "" {
+		n.State = models.MachineDiscovered
+	}
+	n.loading = true
+	defer func() { n.rt, n.loading = nil, false }()
 
 	// This mustSave part is just to keep us from resaving all the machines on startup.
 	mustSave := false
@@ -550,6 +843,12 @@ func (n *Machine) OnChange(oldThing store.KeySaver) error {
 	oldm := AsMachine(oldThing)
 	n.oldBootEnv = oldm.BootEnv
 	n.oldStage = oldm.Stage
+	// Heartbeats only come from the agent, and the last one may not
+	// have been saved yet.
+	n.Heartbeat = oldm.Heartbeat
+	if hb := n.rt.dt.heartbeats.get(n.Key()); hb != nil {
+		n.Heartbeat = hb
+	}
 
 	// If we are changing stages and we aren't done running tasks,
 	// Fail unless the users marks a force
@@ -557,12 +856,27 @@ func (n *Machine) OnChange(oldThing store.KeySaver) error {
 	if n.Stage == "" {
 		n.Stage = "none"
 	}
+	// Changing Workflows starts the machine over at the beginning
+	// of the new one.
 	e := &models.Error{
 		Code:  http.StatusUnprocessableEntity,
 		Type:  ValidationError,
 		Model: n.Prefix(),
 		Key:   n.Key(),
 	}
+	if n.Workflow != oldm.Workflow {
+		n.applyWorkflow(e)
+	}
+	if n.State == "" {
+		n.State = oldm.State
+	}
+	if n.State != oldm.State {
+		if !models.MachineStateAllowed(oldm.State, n.State) && !n.ChangeForced() {
+			e.Errorf("Can not change State from %s to %s unless forced", oldm.State, n.State)
+		} else {
+			n.changeState(oldm.State, n.Stage != oldm.Stage)
+		}
+	}
 	if n.oldStage != n.Stage && oldm.CurrentTask != len(oldm.Tasks) && !n.ChangeForced() {
 		e.Errorf("Can not change stages with pending tasks unless forced")
 	}
@@ -604,6 +918,15 @@ func (n *Machine) AfterDelete() {
 		job.Current = false
 		n.rt.Save(job)
 	}
+	for _, id := range n.TaskJobs {
+		if j := n.rt.stores("jobs").Find(id.String()); j != nil && AsJob(j).Current {
+			job := AsJob(j)
+			job.Current = false
+			n.rt.Save(job)
+		}
+	}
+	os.Remove(n.InventoryPath(n.rt))
+	n.syncAddressing(true)
 }
 
 func AsMachine(o models.Model) *Machine {
@@ -620,10 +943,10 @@ func AsMachines(o []models.Model) []*Machine {
 
 var machineLockMap = map[string][]string{
 	"get":     []string{"stages", "bootenvs", "machines", "profiles", "params"},
-	"create":  []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params"},
-	"update":  []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params"},
-	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params"},
-	"delete":  []string{"stages", "bootenvs", "machines", "jobs", "tasks"},
+	"create":  []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations"},
+	"update":  []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations"},
+	"patch":   []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations"},
+	"delete":  []string{"stages", "bootenvs", "machines", "jobs", "tasks", "leases", "reservations"},
 	"actions": []string{"stages", "bootenvs", "machines", "profiles", "params"},
 }
 
@@ -3,6 +3,7 @@ package backend
 import (
 	"encoding/json"
 	"net"
+	"reflect"
 	"testing"
 
 	"github.com/VictorLowther/jsonpatch2"
@@ -100,3 +101,80 @@ func TestMachineCrud(t *testing.T) {
 		}
 	})
 }
+
+func TestMachineExplainParams(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "templates", "machines", "tasks", "bootenvs", "profiles", "params", "jobs")
+	mUUID := uuid.NewRandom()
+	rt.Do(func(d Stores) {
+		for _, obj := range []models.Model{
+			&models.Param{Name: "d", Schema: map[string]interface{}{"type": "string", "default": "default"}},
+			&models.Param{Name: "e", Schema: map[string]interface{}{"type": "string", "default": "default"}},
+			&models.Profile{Name: "p", Params: map[string]interface{}{"a": "profile", "b": "profile"}},
+			&models.Profile{Name: "sp", Params: map[string]interface{}{"b": "stage", "c": "stage"}},
+			&models.Stage{Name: "st", Profiles: []string{"sp"}},
+			&models.Machine{
+				Uuid:     mUUID,
+				Name:     "explained",
+				BootEnv:  "local",
+				Stage:    "st",
+				Profiles: []string{"p"},
+				Params:   map[string]interface{}{"a": "machine"},
+			},
+		} {
+			if ok, err := rt.Create(obj); !ok {
+				t.Fatalf("Failed to create %s %s: %v", obj.Prefix(), obj.Key(), err)
+			}
+		}
+		global := rt.Find("profiles", dt.GlobalProfileName).(models.Paramer)
+		if err := rt.SetParam(global, "d", "global"); err != nil {
+			t.Fatalf("Failed to set global param: %v", err)
+		}
+		machine := AsMachine(rt.Find("machines", mUUID.String()))
+		res := rt.ExplainParams(machine)
+		expect := map[string][]string{
+			"a": {"machine", "profile"},
+			"b": {"profile", "stage"},
+			"c": {"stage"},
+			"d": {"global", "default"},
+			"e": {"default"},
+		}
+		for k, sources := range expect {
+			e, ok := res[k]
+			if !ok {
+				t.Errorf("Missing explanation for %s", k)
+				continue
+			}
+			got := []string{e.Source.Source}
+			for _, s := range e.Shadowed {
+				got = append(got, s.Source)
+			}
+			if len(got) != len(sources) {
+				t.Errorf("%s: expected sources %v, got %v", k, sources, got)
+				continue
+			}
+			for i := range got {
+				if got[i] != sources[i] {
+					t.Errorf("%s: expected sources %v, got %v", k, sources, got)
+					break
+				}
+			}
+			if e.Value != e.Source.Value {
+				t.Errorf("%s: effective value %v does not match winning source %v", k, e.Value, e.Source.Value)
+			}
+		}
+		if res["c"].Source.Name != "st" || res["c"].Source.Profile != "sp" {
+			t.Errorf("Stage source should name stage st and profile sp, not %#v", res["c"].Source)
+		}
+		// The explanation has to agree with the aggregated params.
+		params := rt.GetParams(machine, true)
+		for k, e := range res {
+			if !reflect.DeepEqual(params[k], e.Value) {
+				t.Errorf("%s: aggregated value %v does not match explained value %v", k, params[k], e.Value)
+			}
+		}
+		if len(params) != len(res) {
+			t.Errorf("Aggregated params %v and explanation %v should have the same keys", params, res)
+		}
+	})
+}
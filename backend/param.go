@@ -24,6 +24,9 @@ type Param struct {
 	*models.Param
 	validate
 	validator *gojsonschema.Schema
+	// set when the Param has just been marked Secure, so that
+	// AfterSave seals the values it already has.
+	sealExisting bool
 }
 
 func (obj *Param) SetReadOnly(b bool) {
@@ -99,6 +102,23 @@ func (p *Param) BeforeSave() error {
 	// However, I don't feel like writing that code for now, so ignore the problem.
 }
 
+func (p *Param) OnCreate() error {
+	p.sealExisting = p.Secure
+	return nil
+}
+
+func (p *Param) OnChange(oldThing store.KeySaver) error {
+	p.sealExisting = p.Secure && !AsParam(oldThing).Secure
+	return nil
+}
+
+func (p *Param) AfterSave() {
+	if p.sealExisting {
+		p.sealExisting = false
+		p.rt.sealExisting(p.Name)
+	}
+}
+
 func (p *Param) OnLoad() error {
 	defer func() { p.rt = nil }()
 	return p.BeforeSave()
@@ -128,11 +148,14 @@ func (p *Param) ValidateValue(val interface{}) error {
 	return e
 }
 
+// Marking a Param Secure seals the values Machines and Profiles
+// already have for it, so creating and changing Params needs the
+// locks to save both.
 var paramLockMap = map[string][]string{
 	"get":    []string{"params"},
-	"create": []string{"params", "profiles"},
-	"update": []string{"params", "profiles"},
-	"patch":  []string{"params", "profiles"},
+	"create": []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations"},
+	"update": []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations"},
+	"patch":  []string{"stages", "bootenvs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations"},
 	"delete": []string{"params", "profiles"},
 }
 
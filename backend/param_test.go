@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
 )
 
 func TestParamsCrud(t *testing.T) {
@@ -41,3 +42,63 @@ func TestParamsCrud(t *testing.T) {
 		}
 	})
 }
+
+func TestParamSchemaEnforcement(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "profiles", "params", "machines", "plugins")
+	rt.Do(func(d Stores) {
+		if ok, err := rt.Create(&models.Param{
+			Name:   "count",
+			Schema: map[string]interface{}{"type": "integer"},
+		}); !ok {
+			t.Fatalf("Failed to create param: %v", err)
+		}
+		if ok, err := rt.Create(&models.Profile{Name: "enforced"}); !ok {
+			t.Fatalf("Failed to create profile: %v", err)
+		}
+		prof := AsProfile(rt.Find("profiles", "enforced"))
+		if err := rt.SetParam(prof, "count", 3); err != nil {
+			t.Errorf("Setting a valid value failed: %v", err)
+		}
+		err := rt.SetParam(prof, "count", "three")
+		if err == nil {
+			t.Fatalf("Setting an invalid value should have failed")
+		}
+		if me, ok := err.(*models.Error); !ok || me.Code != 422 {
+			t.Errorf("Expected a 422 models.Error, got %#v", err)
+		}
+		if err := rt.AddParam(prof, "undefined", "anything"); err != nil {
+			t.Errorf("Params without a definition should not be checked: %v", err)
+		}
+		if v := prof.Params["count"]; v != 3 {
+			t.Errorf("Failed update changed the value to %v", v)
+		}
+		if res := rt.ParamReport(); len(res) != 0 {
+			t.Errorf("Expected an empty report, got %v", res)
+		}
+		// Sneak a bad value in behind the back of SetParams
+		prof.Params["count"] = "three"
+		res := rt.ParamReport()
+		if len(res) != 1 || res[0].Key != "enforced" || res[0].Param != "count" {
+			t.Errorf("Expected a report for enforced/count, got %v", res)
+		}
+	})
+	// Saving a whole Machine checks its changed params too.
+	mrt := dt.Request(dt.Logger, machineLockMap["update"]...)
+	mrt.Do(func(d Stores) {
+		m := &models.Machine{Name: "enforced", Uuid: uuid.NewRandom(), Params: map[string]interface{}{"count": "three"}}
+		if ok, _ := mrt.Create(m); ok {
+			t.Errorf("Creating a Machine with an invalid param value should have failed")
+		}
+		m.Params["count"] = 3
+		if ok, err := mrt.Create(m); !ok {
+			t.Fatalf("Failed to create machine: %v", err)
+		}
+		sm := AsMachine(mrt.Find("machines", m.UUID()))
+		nm := AsMachine(toBackend(models.Clone(sm.Machine), mrt))
+		nm.Params["count"] = "three"
+		if _, err := mrt.Update(nm); err == nil {
+			t.Errorf("Updating a Machine with an invalid param value should have failed")
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package backend
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+)
+
+// DefaultClaimDuration is how long a claim lasts when the claim does
+// not say.
+const DefaultClaimDuration = time.Hour
+
+// cleanupStage returns the Stage that the pool/cleanup-stage parameter
+// of n says it should pass through when it is released back to its
+// Pool, if any.
+func (n *Machine) cleanupStage() string {
+	for _, prefix := range []string{"profiles", "stages", "params"} {
+		if !n.rt.locked(prefix) {
+			return ""
+		}
+	}
+	val, _ := n.rt.GetParam(n, "pool/cleanup-stage", true)
+	stage, _ := val.(string)
+	return stage
+}
+
+// poolFree returns whether m can be claimed from its Pool.
+func poolFree(m *Machine) bool {
+	return m.Pool != "" && m.Claim == nil && m.State == models.MachineReady && m.Available
+}
+
+// ClaimMachines claims claim.Count ready Machines from pool that pass
+// filters for claim.Owner.  Either all of them are claimed or none
+// are.  The caller must hold the locks needed to update machines.
+func (rt *RequestTracker) ClaimMachines(pool string, claim *models.PoolClaim, filters ...index.Filter) ([]*models.Machine, error) {
+	e := &models.Error{
+		Code:  http.StatusBadRequest,
+		Type:  "CLAIM",
+		Model: "pools",
+		Key:   pool,
+	}
+	count, duration := claim.Count, time.Duration(claim.Duration)*time.Second
+	if claim.Owner == "" {
+		e.Errorf("Owner is required")
+	}
+	if count == 0 {
+		count = 1
+	} else if count < 0 {
+		e.Errorf("Count must be positive, not %d", count)
+	}
+	if duration == 0 {
+		duration = DefaultClaimDuration
+	} else if duration < 0 {
+		e.Errorf("Duration must be positive, not %d", claim.Duration)
+	}
+	if err := e.HasError(); err != nil {
+		return nil, err
+	}
+	rt.ExpireClaims()
+	idx, err := index.All(filters...)(&rt.stores("machines").Index)
+	if err != nil {
+		e.AddError(err)
+		return nil, e
+	}
+	picked := []*Machine{}
+	for _, i := range idx.Items() {
+		if m := AsMachine(i); m.Pool == pool && poolFree(m) {
+			picked = append(picked, m)
+			if len(picked) == count {
+				break
+			}
+		}
+	}
+	if len(picked) < count {
+		e.Code = http.StatusConflict
+		e.Type = "Conflict"
+		e.Errorf("Pool %s has %d matching Machines free, %d wanted", pool, len(picked), count)
+		return nil, e
+	}
+	now := time.Now()
+	res := make([]*models.Machine, 0, count)
+	for i, m := range picked {
+		nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+		nm.Claim = &models.MachineClaim{
+			Owner:   claim.Owner,
+			Claimed: now,
+			Expires: now.Add(duration),
+		}
+		nm.State = models.MachineInUse
+		if _, err := rt.Update(nm); err != nil {
+			// Put back the ones we already claimed.
+			for _, done := range picked[:i] {
+				undo := AsMachine(toBackend(models.Clone(done.Machine), rt))
+				undo.ForceChange()
+				if _, e2 := rt.Update(undo); e2 != nil {
+					rt.Errorf("Failed to unclaim Machine %s: %v", undo.Key(), e2)
+				}
+			}
+			e.AddError(err)
+			return nil, e
+		}
+		rt.Infof("Machine %s claimed from Pool %s by %s until %s", nm.Key(), pool, claim.Owner, nm.Claim.Expires)
+		res = append(res, nm.Machine)
+	}
+	return res, nil
+}
+
+// releaseMachine gives m back to its Pool.  If m is in use, it is sent
+// through its cleanup Stage when it has one, and is otherwise ready to
+// be claimed again right away.
+func (rt *RequestTracker) releaseMachine(m *Machine) (*Machine, error) {
+	nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+	nm.Claim = nil
+	if nm.State == models.MachineInUse {
+		if stage := nm.cleanupStage(); stage != "" {
+			nm.Stage = stage
+			nm.State = models.MachineProvisioning
+			nm.Runnable = true
+			nm.ForceChange()
+		} else {
+			nm.State = models.MachineReady
+		}
+	}
+	if _, err := rt.Update(nm); err != nil {
+		return nil, err
+	}
+	rt.Infof("Machine %s released back to Pool %s by %s", nm.Key(), nm.Pool, m.Claim.Owner)
+	return nm, nil
+}
+
+// ReleaseMachines releases the Machines in release.Machines, or all of
+// the ones claimed by release.Owner if it is empty, back to pool.  The
+// caller must hold the locks needed to update machines.
+func (rt *RequestTracker) ReleaseMachines(pool string, release *models.PoolRelease) ([]*models.Machine, error) {
+	e := &models.Error{
+		Code:  http.StatusBadRequest,
+		Type:  "RELEASE",
+		Model: "pools",
+		Key:   pool,
+	}
+	if release.Owner == "" {
+		e.Errorf("Owner is required")
+		return nil, e
+	}
+	picked := []*Machine{}
+	if len(release.Machines) == 0 {
+		for _, i := range rt.stores("machines").Items() {
+			if m := AsMachine(i); m.Pool == pool && m.Claim != nil && m.Claim.Owner == release.Owner {
+				picked = append(picked, m)
+			}
+		}
+	} else {
+		e.Code = http.StatusConflict
+		e.Type = "Conflict"
+		for _, id := range release.Machines {
+			found := rt.Find("machines", id.String())
+			if found == nil {
+				e.Errorf("Machine %s does not exist", id)
+				continue
+			}
+			m := AsMachine(found)
+			if m.Pool != pool || m.Claim == nil || m.Claim.Owner != release.Owner {
+				e.Errorf("Machine %s is not claimed from Pool %s by %s", id, pool, release.Owner)
+				continue
+			}
+			picked = append(picked, m)
+		}
+		if err := e.HasError(); err != nil {
+			return nil, err
+		}
+	}
+	res := make([]*models.Machine, 0, len(picked))
+	for _, m := range picked {
+		nm, err := rt.releaseMachine(m)
+		if err != nil {
+			e.AddError(err)
+			continue
+		}
+		res = append(res, nm.Machine)
+	}
+	return res, e.HasError()
+}
+
+// ExpireClaims releases every Machine whose claim has run out.  It
+// does nothing unless the locks needed to update machines are held.
+func (rt *RequestTracker) ExpireClaims() {
+	for _, prefix := range machineLockMap["update"] {
+		if !rt.locked(prefix) {
+			return
+		}
+	}
+	for _, i := range rt.stores("machines").Items() {
+		m := AsMachine(i)
+		if !m.Claim.Expired() {
+			continue
+		}
+		rt.Infof("Claim on Machine %s by %s expired at %s", m.Key(), m.Claim.Owner, m.Claim.Expires)
+		if _, err := rt.releaseMachine(m); err != nil {
+			rt.Errorf("Failed to release Machine %s: %v", m.Key(), err)
+		}
+	}
+}
+
+// FinishPoolCleanup makes m ready to be claimed again once the last
+// Task of its cleanup Stage has finished.  It returns true if m was
+// changed.
+func (rt *RequestTracker) FinishPoolCleanup(m *Machine) (bool, error) {
+	if m.Pool == "" || m.Claim != nil || m.State != models.MachineProvisioning {
+		return false, nil
+	}
+	if stage := m.cleanupStage(); stage == "" || stage != m.Stage {
+		return false, nil
+	}
+	nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+	nm.State = models.MachineReady
+	if _, err := rt.Update(nm); err != nil {
+		return false, err
+	}
+	rt.Infof("Machine %s finished cleaning up and is back in Pool %s", m.Key(), m.Pool)
+	return true, nil
+}
+
+func addToPool(res map[string]*models.PoolStatus, m *Machine, withMachines bool) {
+	p, ok := res[m.Pool]
+	if !ok {
+		p = &models.PoolStatus{Name: m.Pool}
+		res[m.Pool] = p
+	}
+	p.Total++
+	switch {
+	case poolFree(m):
+		p.Free++
+	case m.Claim != nil:
+		p.Claimed++
+	default:
+		p.Busy++
+	}
+	if withMachines {
+		p.Machines = append(p.Machines, m.Machine)
+	}
+}
+
+// Pools summarizes every Pool that has Machines in it, sorted by name.
+// The caller must hold the machines lock.
+func (rt *RequestTracker) Pools() []*models.PoolStatus {
+	pools := map[string]*models.PoolStatus{}
+	for _, i := range rt.stores("machines").Items() {
+		if m := AsMachine(i); m.Pool != "" {
+			addToPool(pools, m, false)
+		}
+	}
+	res := make([]*models.PoolStatus, 0, len(pools))
+	for _, p := range pools {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Pool summarizes the Machines in pool, or returns nil if it has none.
+// The caller must hold the machines lock.
+func (rt *RequestTracker) Pool(pool string) *models.PoolStatus {
+	pools := map[string]*models.PoolStatus{}
+	for _, i := range rt.stores("machines").Items() {
+		if m := AsMachine(i); m.Pool == pool && pool != "" {
+			addToPool(pools, m, true)
+		}
+	}
+	return pools[pool]
+}
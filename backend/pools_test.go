@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestMachinePools(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, machineLockMap["update"]...)
+	mkMachine := func(name, pool, state string) *models.Machine {
+		return &models.Machine{Name: name, Uuid: uuid.NewRandom(), Pool: pool, State: state}
+	}
+	m1 := mkMachine("m1", "ci", models.MachineReady)
+	m1.Params = map[string]interface{}{"pool/cleanup-stage": "scrub"}
+	m2 := mkMachine("m2", "ci", models.MachineReady)
+	m3 := mkMachine("m3", "ci", models.MachineDiscovered)
+	m4 := mkMachine("m4", "lab", models.MachineReady)
+	createTests := []crudTest{
+		{"Create scrub Stage", rt.Create, &models.Stage{Name: "scrub", BootEnv: "local"}, true},
+		{"Create claimed Machine without a Pool", rt.Create, &models.Machine{Name: "bad", Uuid: uuid.NewRandom(), Claim: &models.MachineClaim{Owner: "me"}}, false},
+		{"Create m1", rt.Create, m1, true},
+		{"Create m2", rt.Create, m2, true},
+		{"Create m3", rt.Create, m3, true},
+		{"Create m4", rt.Create, m4, true},
+	}
+	for _, test := range createTests {
+		test.Test(t, rt)
+	}
+	find := func(m *models.Machine) *Machine {
+		return AsMachine(rt.Find("machines", m.UUID()))
+	}
+	rt.Do(func(d Stores) {
+		if _, err := rt.ClaimMachines("ci", &models.PoolClaim{Count: 1}); err == nil {
+			t.Errorf("Claiming without an Owner should have failed")
+		}
+		if _, err := rt.ClaimMachines("ci", &models.PoolClaim{Owner: "ci-1", Count: 3}); err == nil {
+			t.Errorf("Claiming 3 Machines from ci should have failed")
+		} else if be, ok := err.(*models.Error); !ok || be.Code != 409 {
+			t.Errorf("Expected a 409, got %v", err)
+		}
+		if find(m1).Claim != nil || find(m2).Claim != nil {
+			t.Errorf("A failed claim should not claim any Machines")
+		}
+		byName := find(m2).Indexes()["Name"]
+		res, err := rt.ClaimMachines("ci", &models.PoolClaim{Owner: "ci-2"}, index.Sort(byName), index.Eq("m2"))
+		if err != nil || len(res) != 1 || res[0].Name != "m2" {
+			t.Errorf("Expected to claim m2, got %v: %v", res, err)
+		}
+		res, err = rt.ClaimMachines("ci", &models.PoolClaim{Owner: "ci-1", Duration: 60})
+		if err != nil || len(res) != 1 || res[0].Name != "m1" {
+			t.Errorf("Expected to claim m1, got %v: %v", res, err)
+		}
+		if c := find(m1).Claim; c == nil || c.Owner != "ci-1" || c.Expires.Sub(c.Claimed) != time.Minute {
+			t.Errorf("m1 has the wrong claim: %v", c)
+		}
+		if find(m1).State != models.MachineInUse {
+			t.Errorf("Claimed Machines should be in-use, not %s", find(m1).State)
+		}
+		if _, err := rt.ClaimMachines("ci", &models.PoolClaim{Owner: "ci-1"}); err == nil {
+			t.Errorf("ci should have no free Machines")
+		}
+		p := rt.Pool("ci")
+		if p == nil || p.Total != 3 || p.Free != 0 || p.Claimed != 2 || p.Busy != 1 {
+			t.Errorf("Unexpected ci Pool status: %v", p)
+		}
+		if pools := rt.Pools(); len(pools) != 2 || pools[0].Name != "ci" || pools[1].Free != 1 {
+			t.Errorf("Unexpected Pools: %v", pools)
+		}
+		if _, err := rt.ReleaseMachines("ci", &models.PoolRelease{Owner: "ci-2", Machines: []uuid.UUID{m1.Uuid}}); err == nil {
+			t.Errorf("Releasing m1 as ci-2 should have failed")
+		}
+		res, err = rt.ReleaseMachines("ci", &models.PoolRelease{Owner: "ci-1"})
+		if err != nil || len(res) != 1 {
+			t.Errorf("Expected to release m1: %v", err)
+		}
+		if m := find(m1); m.Claim != nil || m.Stage != "scrub" || m.State != models.MachineProvisioning {
+			t.Errorf("m1 should be cleaning up in scrub, not %s/%s", m.Stage, m.State)
+		}
+		if moved, err := rt.FinishPoolCleanup(find(m2)); moved || err != nil {
+			t.Errorf("m2 is not cleaning up: %v", err)
+		}
+		if moved, err := rt.FinishPoolCleanup(find(m1)); !moved || err != nil {
+			t.Errorf("m1 should have finished cleaning up: %v", err)
+		}
+		if find(m1).State != models.MachineReady {
+			t.Errorf("m1 should be ready, not %s", find(m1).State)
+		}
+		nm := AsMachine(toBackend(models.Clone(find(m2).Machine), rt))
+		nm.Claim.Expires = time.Now().Add(-time.Second)
+		if _, err := rt.Update(nm); err != nil {
+			t.Errorf("Failed to update m2: %v", err)
+		}
+		rt.ExpireClaims()
+		if m := find(m2); m.Claim != nil || m.State != models.MachineReady {
+			t.Errorf("m2 should have been released when its claim expired")
+		}
+		if p := rt.Pool("ci"); p.Free != 2 || p.Claimed != 0 {
+			t.Errorf("Unexpected ci Pool status: %v", p)
+		}
+		if rt.Pool("none") != nil {
+			t.Errorf("Pool none should not exist")
+		}
+	})
+}
@@ -17,6 +17,9 @@ import (
 type Profile struct {
 	*models.Profile
 	validate
+	// set while OnLoad runs, when everything in the Profile came from
+	// the backing store.
+	loading bool
 }
 
 func (obj *Profile) SetReadOnly(b bool) {
@@ -102,6 +105,10 @@ func (p *Profile) Validate() {
 	p.SetValid()
 	params := p.rt.stores("params")
 	for k, v := range p.Params {
+		if IsSealed(v) {
+			// Sealed values were validated before they were sealed.
+			continue
+		}
 		if pIdx := params.Find(k); pIdx != nil {
 			param := AsParam(pIdx)
 			if err := param.ValidateValue(v); err != nil {
@@ -113,15 +120,29 @@ func (p *Profile) Validate() {
 }
 
 func (p *Profile) BeforeSave() error {
+	var old map[string]interface{}
+	if p.loading {
+		old = p.Params
+	} else if o := p.rt.Find("profiles", p.Name); o != nil {
+		old = AsProfile(o).Params
+	}
+	unredactParams(old, p.Params, p)
 	p.Validate()
 	if !p.Useable() {
 		return p.MakeError(422, ValidationError, p)
 	}
+	errCount := len(p.Errors)
+	p.rt.sealParams(old, p.Params, p)
+	if len(p.Errors) != errCount {
+		p.SetInvalid()
+		return p.MakeError(422, ValidationError, p)
+	}
 	return nil
 }
 
 func (p *Profile) OnLoad() error {
-	defer func() { p.rt = nil }()
+	p.loading = true
+	defer func() { p.rt, p.loading = nil, false }()
 	return p.BeforeSave()
 }
 
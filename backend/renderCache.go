@@ -0,0 +1,241 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// renderCacheSize is the maximum number of rendered files we will
+// hold on to.  When the cache is full, expired entries are dropped,
+// and if that does not free up space the whole cache is flushed.
+const renderCacheSize = 4096
+
+type renderCacheEntry struct {
+	buf     []byte
+	machine string
+	expires time.Time
+}
+
+// renderCache holds the output of dynamically rendered files, keyed
+// by the template, the path, the object rendered, the Machine (if any)
+// and the address the file was requested from, along with a
+// generation that changes whenever anything else a render can read
+// changes.  Since the key changes whenever any of the inputs change, a
+// stale entry can never be handed out, and a cache hit does not need
+// any of the store locks.  Change events are used to move the
+// generation along and to throw away entries that can no longer be
+// reached.
+type renderCache struct {
+	sync.Mutex
+	entries      map[string]*renderCacheEntry
+	hits, misses int
+	// generation is bumped whenever a Template, Task, Stage, BootEnv,
+	// Profile, Param, or preference changes.
+	generation uint64
+	// machines holds the renderDigest of every Machine the cache has
+	// seen, by Machine UUID.
+	machines map[string]string
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{
+		entries:  map[string]*renderCacheEntry{},
+		machines: map[string]string{},
+	}
+}
+
+// renderDigest hashes the fields of a Machine that templates use.
+// Fields that change as the Machine runs its Tasks are left out, so
+// that running a Task does not throw away everything rendered for the
+// Machine.
+func renderDigest(m *models.Machine) string {
+	buf, _ := json.Marshal(struct {
+		Meta                            map[string]string
+		Name, Description, Stage, State string
+		Pool, Workflow, BootEnv, Secret string
+		OS                              string
+		Uuid                            uuid.UUID
+		Address                         net.IP
+		Profiles                        []string
+		Params                          map[string]interface{}
+		Inventory                       *models.Inventory
+		Interfaces                      []models.MachineInterface
+	}{
+		Meta:        m.Meta,
+		Name:        m.Name,
+		Description: m.Description,
+		Stage:       m.Stage,
+		State:       m.State,
+		Pool:        m.Pool,
+		Workflow:    m.Workflow,
+		BootEnv:     m.BootEnv,
+		Secret:      m.Secret,
+		OS:          m.OS,
+		Uuid:        m.Uuid,
+		Address:     m.Address,
+		Profiles:    m.Profiles,
+		Params:      m.Params,
+		Inventory:   m.Inventory,
+		Interfaces:  m.Interfaces,
+	})
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// key returns the cache key for rendering tmpl at path for target.
+// machine is the UUID of the Machine being rendered for, if any, and
+// local is the address of dr-provision the request came in on.  It
+// returns false if the cache has not seen machine yet, in which case
+// the caller must noteMachine it with the store locks held first.
+func (c *renderCache) key(tmpl, path, target, machine, local string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	digest := ""
+	if machine != "" {
+		var ok bool
+		if digest, ok = c.machines[machine]; !ok {
+			return "", false
+		}
+	}
+	buf, _ := json.Marshal(struct {
+		Tmpl, Path, Target, Machine, Local string
+		Generation                         uint64
+	}{tmpl, path, target, digest, local, c.generation})
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// lookup returns what was rendered for the inputs key takes, if it
+// is still in the cache.  It does not need any store locks.
+func (c *renderCache) lookup(tmpl, path, target, machine, local string) ([]byte, bool) {
+	if k, ok := c.key(tmpl, path, target, machine, local); ok {
+		return c.get(k)
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.misses++
+	return nil, false
+}
+
+// noteMachine records the renderDigest of m.  It must be called with
+// the machines lock held.
+func (c *renderCache) noteMachine(m *models.Machine) {
+	c.Lock()
+	defer c.Unlock()
+	c.setMachine(m.Key(), renderDigest(m))
+}
+
+// setMachine records digest for the Machine with UUID key, throwing
+// away whatever was rendered for an older version of it.  The cache
+// must be locked.
+func (c *renderCache) setMachine(key, digest string) {
+	if old, ok := c.machines[key]; ok && old == digest {
+		return
+	}
+	c.dropMachine(key)
+	if digest != "" {
+		c.machines[key] = digest
+	}
+}
+
+func (c *renderCache) dropMachine(key string) {
+	delete(c.machines, key)
+	for k, ent := range c.entries {
+		if ent.machine == key {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *renderCache) get(key string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+	ent, ok := c.entries[key]
+	if ok && !ent.expires.IsZero() && time.Now().After(ent.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	return ent.buf, true
+}
+
+// put adds a rendered file to the cache.  If ttl is not zero, the
+// entry will expire after that long.
+func (c *renderCache) put(key, machine string, buf []byte, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.entries) >= renderCacheSize {
+		now := time.Now()
+		for k, ent := range c.entries {
+			if !ent.expires.IsZero() && now.After(ent.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= renderCacheSize {
+			c.entries = map[string]*renderCacheEntry{}
+		}
+	}
+	ent := &renderCacheEntry{buf: buf, machine: machine}
+	if ttl > 0 {
+		ent.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = ent
+}
+
+// invalidate moves the cache along after action was taken on
+// prefix:key, which is now ref.  A change to a Machine only affects the
+// renders for that Machine, and only if it changed a field templates
+// use.  Jobs, Leases, Users, and Plugins are never seen while
+// rendering, and change too often to throw the cache away for.  A
+// change to anything else can affect everything.
+func (c *renderCache) invalidate(prefix, action, key string, ref interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	switch prefix {
+	case "machines":
+		m, ok := ref.(*Machine)
+		if action == "delete" || !ok {
+			c.dropMachine(key)
+			return
+		}
+		c.setMachine(key, renderDigest(m.Machine))
+	case "jobs", "leases", "users", "plugins":
+	default:
+		c.flush()
+	}
+}
+
+// reset forgets everything, including the Machines the cache has
+// seen.  It is used when all the stores are replaced.
+func (c *renderCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.flush()
+	c.machines = map[string]string{}
+}
+
+// flush throws away every rendered file.  The cache must be locked.
+func (c *renderCache) flush() {
+	c.generation++
+	c.entries = map[string]*renderCacheEntry{}
+}
+
+// RenderCacheStats returns the number of hits and misses of the
+// render cache, along with the number of rendered files it holds.
+func (p *DataTracker) RenderCacheStats() (hits, misses, entries int) {
+	c := p.renderCache
+	c.Lock()
+	defer c.Unlock()
+	return c.hits, c.misses, len(c.entries)
+}
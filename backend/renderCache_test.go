@@ -0,0 +1,117 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRenderCache(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "machines", "profiles", "params", "tasks", "preferences")
+	env := &models.BootEnv{
+		Name: "cached",
+		Templates: []models.TemplateInfo{
+			{
+				Name: "ipxe",
+				Path: "machines/{{.Machine.UUID}}/cached",
+				ID:   "cached",
+			},
+		},
+	}
+	objs := []crudTest{
+		{"Create cached template", rt.Create, &models.Template{ID: "cached", Contents: `{{.Machine.Name}} {{.Param "foo"}}`}, true},
+		{"Create cached bootenv", rt.Create, env, true},
+	}
+	for _, obj := range objs {
+		obj.Test(t, rt)
+	}
+	machine := &Machine{}
+	Fill(machine)
+	machine.Uuid = uuid.NewRandom()
+	machine.Name = "cached"
+	machine.Address = net.ParseIP("192.168.124.12")
+	machine.BootEnv = "cached"
+	machine.Params = map[string]interface{}{"foo": "bar"}
+	rt.Do(func(d Stores) {
+		if created, err := rt.Create(machine); !created {
+			t.Fatalf("Failed to create new test machine: %v", err)
+		}
+	})
+	genLoc := path.Join("/", "machines", machine.UUID(), "cached")
+	fetch := func(expect string, hits, misses int) {
+		t.Helper()
+		out, err := dt.FS.Open(genLoc, nil)
+		if err != nil || out == nil {
+			t.Errorf("Failed to get template for %s: %v", genLoc, err)
+			return
+		}
+		buf, _ := ioutil.ReadAll(out)
+		if string(buf) != expect {
+			t.Errorf("Expected %q, got %q", expect, string(buf))
+		}
+		h, m, _ := dt.RenderCacheStats()
+		if h != hits || m != misses {
+			t.Errorf("Expected %d hits and %d misses, got %d and %d", hits, misses, h, m)
+		}
+	}
+	fetch("cached bar", 0, 1)
+	fetch("cached bar", 1, 1)
+	rt.Do(func(d Stores) {
+		rt.SetParam(machine, "foo", "baz")
+	})
+	fetch("cached baz", 1, 2)
+	fetch("cached baz", 2, 2)
+	crudTest{"Update cached template", rt.Update, &models.Template{ID: "cached", Contents: `{{.Machine.Name | upper}}`}, true}.Test(t, rt)
+	if _, _, entries := dt.RenderCacheStats(); entries != 0 {
+		t.Errorf("Updating a template should have flushed the cache, but it has %d entries", entries)
+	}
+	fetch("CACHED", 2, 3)
+	// Running Tasks changes fields templates do not use.
+	rt.Do(func(d Stores) {
+		nm := AsMachine(toBackend(models.Clone(machine.Machine), rt))
+		nm.Runnable = !nm.Runnable
+		nm.CurrentTask = -1
+		if _, err := rt.Update(nm); err != nil {
+			t.Errorf("Failed to update machine: %v", err)
+		}
+	})
+	fetch("CACHED", 3, 3)
+	rt.Do(func(d Stores) {
+		if err := dt.SetPrefs(rt, map[string]string{"knownTokenTimeout": "600"}); err != nil {
+			t.Errorf("Failed to set prefs: %v", err)
+		}
+	})
+	fetch("CACHED", 3, 4)
+	c := newRenderCache()
+	c.put("expires", "", []byte("expires"), time.Nanosecond)
+	c.put("forever", "", []byte("forever"), 0)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.get("expires"); ok {
+		t.Errorf("Cache entry should have expired")
+	}
+	if _, ok := c.get("forever"); !ok {
+		t.Errorf("Cache entry should not have expired")
+	}
+	for _, prefix := range []string{"jobs", "workflows", "subnets", "reservations"} {
+		c.put("entry", "", []byte("entry"), 0)
+		c.invalidate(prefix, "update", "key", nil)
+		_, ok := c.get("entry")
+		if prefix == "jobs" && !ok {
+			t.Errorf("Changing %s should not have flushed the cache", prefix)
+		} else if prefix != "jobs" && ok {
+			t.Errorf("Changing %s should have flushed the cache", prefix)
+		}
+	}
+	rd := &RenderData{}
+	rd.limitCache(time.Hour)
+	rd.limitCache(2 * time.Hour)
+	if rd.cacheFor != time.Hour {
+		t.Errorf("limitCache should keep the shortest duration, got %v", rd.cacheFor)
+	}
+}
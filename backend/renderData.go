@@ -86,13 +86,24 @@ func newRenderedTemplate(r *RenderData,
 		keys = append(keys, r.Machine.Key())
 	}
 	targetPrefix := r.target.Prefix()
+	target := targetPrefix + ":" + r.target.Key()
+	machine := ""
+	if r.Machine != nil {
+		machine = r.Machine.Key()
+	}
 	dt := r.rt.dt
 	return renderer{
 		path: path,
 		name: tmplKey,
 		write: func(remoteIP net.IP) (io.Reader, error) {
+			l := r.rt.Logger.Switch("bootenv")
+			local := dt.LocalIP(remoteIP)
+			if cached, ok := dt.renderCache.lookup(tmplKey, path, target, machine, local); ok {
+				l.Debugf("Using cached content for %s", path)
+				return bytes.NewReader(cached), nil
+			}
 			var err error
-			rt := dt.Request(r.rt.Logger.Switch("bootenv"),
+			rt := dt.Request(l,
 				"templates",
 				"tasks",
 				"stages",
@@ -102,11 +113,15 @@ func newRenderedTemplate(r *RenderData,
 				"params",
 				"preferences")
 			rd := &RenderData{rt: rt}
+			buf := bytes.Buffer{}
+			// Look up the objects, render, and store the result all in
+			// one go, so that the cache key matches what was rendered.
 			rd.rt.Do(func(d Stores) {
 				for i, prefix := range prefixes {
 					item := rd.rt.Find(prefix, keys[i])
 					if item == nil {
 						err = fmt.Errorf("%s:%s has vanished", prefix, keys[i])
+						return
 					}
 					switch obj := item.(type) {
 					case *Task:
@@ -117,29 +132,27 @@ func newRenderedTemplate(r *RenderData,
 						rd.Env = &rBootEnv{BootEnv: obj, renderData: rd}
 					case *Machine:
 						rd.Machine = &rMachine{Machine: obj, renderData: rd}
+						dt.renderCache.noteMachine(obj.Machine)
 					default:
 						rd.rt.Panicf("%s:%s is neither Renderable nor a machine", item.Prefix(), item.Key())
 					}
 				}
-			})
-			if err != nil {
-				return nil, err
-			}
-			switch targetPrefix {
-			case "tasks":
-				rd.target = renderable(rd.Task.Task)
-			case "stages":
-				rd.target = renderable(rd.Stage.Stage)
-			case "bootenvs":
-				rd.target = renderable(rd.Env.BootEnv)
-			}
-			rd.remoteIP = remoteIP
-			rd.tmplKey = tmplKey
-			rd.tmplPath = path
-			buf := bytes.Buffer{}
-			tmpl := rd.target.templates().Lookup(tmplKey)
-			rd.rt.Do(func(d Stores) {
-				err = tmpl.Execute(&buf, rd)
+				switch targetPrefix {
+				case "tasks":
+					rd.target = renderable(rd.Task.Task)
+				case "stages":
+					rd.target = renderable(rd.Stage.Stage)
+				case "bootenvs":
+					rd.target = renderable(rd.Env.BootEnv)
+				}
+				rd.remoteIP = remoteIP
+				rd.tmplKey = tmplKey
+				rd.tmplPath = path
+				cacheKey, _ := dt.renderCache.key(tmplKey, path, target, machine, local)
+				err = rd.target.templates().Lookup(tmplKey).Execute(&buf, rd)
+				if err == nil {
+					dt.renderCache.put(cacheKey, machine, buf.Bytes(), rd.cacheFor)
+				}
 			})
 			if err != nil {
 				return nil, err
@@ -356,6 +369,17 @@ type RenderData struct {
 	target            renderable
 	tmplKey, tmplPath string
 	remoteIP          net.IP
+	// cacheFor is how long the output of this render may be cached
+	// for.  Zero means until one of its inputs changes.
+	cacheFor time.Duration
+}
+
+// limitCache makes sure the output of this render will not be
+// cached for longer than d.
+func (r *RenderData) limitCache(d time.Duration) {
+	if r.cacheFor == 0 || d < r.cacheFor {
+		r.cacheFor = d
+	}
 }
 
 func (r *RenderData) fetchRepos(test func(*Repo) bool) (res []*Repo) {
@@ -499,9 +523,11 @@ func (r *RenderData) GenerateToken() string {
 			mttl, _ := strconv.Atoi(sttl)
 			ttl = time.Second * time.Duration(mttl)
 		}
+		r.limitCache(ttl / 2)
 		t, _ = NewClaim("general", grantor, ttl).
 			Add("machines", "post", "*").
 			Add("machines", "get", "*").
+			Add("machines", "whoami", "*").
 			AddSecrets("", grantorSecret, "").
 			Seal(r.rt.dt.tokenManager)
 	} else {
@@ -510,6 +536,7 @@ func (r *RenderData) GenerateToken() string {
 			mttl, _ := strconv.Atoi(sttl)
 			ttl = time.Second * time.Duration(mttl)
 		}
+		r.limitCache(ttl / 2)
 		t, _ = NewClaim(r.Machine.Key(), grantor, ttl).
 			Add("machines", "*", r.Machine.Key()).
 			Add("stages", "get", "*").
@@ -519,6 +546,8 @@ func (r *RenderData) GenerateToken() string {
 			Add("jobs", "update", r.Machine.Key()).
 			Add("jobs", "actions", r.Machine.Key()).
 			Add("jobs", "log", r.Machine.Key()).
+			Add("jobs", "results", r.Machine.Key()).
+			Add("jobs", "artifacts", r.Machine.Key()).
 			Add("tasks", "get", "*").
 			Add("info", "get", "*").
 			Add("events", "post", "*").
@@ -552,6 +581,8 @@ func (r *RenderData) GenerateInfiniteToken() string {
 		Add("jobs", "update", r.Machine.Key()).
 		Add("jobs", "actions", r.Machine.Key()).
 		Add("jobs", "log", r.Machine.Key()).
+		Add("jobs", "results", r.Machine.Key()).
+		Add("jobs", "artifacts", r.Machine.Key()).
 		Add("tasks", "get", "*").
 		Add("info", "get", "*").
 		Add("events", "post", "*").
@@ -562,6 +593,12 @@ func (r *RenderData) GenerateInfiniteToken() string {
 	return t
 }
 
+// JobSigningKey returns the public key that the actions of Jobs are
+// signed with, for templates to pin in the machine agent.
+func (r *RenderData) JobSigningKey() (string, error) {
+	return r.rt.dt.JobSigningPublicKey()
+}
+
 func (r *RenderData) GenerateProfileToken(profile string, duration int) string {
 	if r.Machine == nil {
 		// Don't allow profile tokens.
@@ -588,6 +625,7 @@ func (r *RenderData) GenerateProfileToken(profile string, duration int) string {
 		duration = 2000000000
 	}
 	ttl := time.Second * time.Duration(duration)
+	r.limitCache(ttl / 2)
 
 	t, _ := NewClaim(r.Machine.Key(), grantor, ttl).
 		Add("profiles", "get", profile).
@@ -637,18 +675,19 @@ func (r *RenderData) ParseUrl(segment, rawUrl string) (string, error) {
 	return "", fmt.Errorf("No idea how to get URL part %s from %s", segment, rawUrl)
 }
 
-// Param is a helper function for extracting a parameter from Machine.Params
+// Param is a helper function for extracting a parameter from Machine.Params.
+// Values of secure params are unsealed here, and only here.
 func (r *RenderData) Param(key string) (interface{}, error) {
 	if r.Machine != nil {
 		v, ok := r.rt.GetParam(r.Machine, key, true)
 		if ok {
-			return v, nil
+			return r.rt.dt.unsealValue(v)
 		}
 	}
 	if o := r.rt.Find("profiles", r.rt.dt.GlobalProfileName); o != nil {
 		p := AsProfile(o)
 		if v, ok := r.rt.GetParam(p, key, true); ok {
-			return v, nil
+			return r.rt.dt.unsealValue(v)
 		}
 	}
 	return nil, fmt.Errorf("No such machine parameter %s", key)
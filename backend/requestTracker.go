@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/digitalrebar/logger"
@@ -15,9 +18,10 @@ import (
 
 type RequestTracker struct {
 	logger.Logger
-	dt    *DataTracker
-	locks []string
-	d     Stores
+	dt        *DataTracker
+	locks     []string
+	d         Stores
+	allLocked bool
 }
 
 func (p *DataTracker) Request(l logger.Logger, locks ...string) *RequestTracker {
@@ -42,10 +46,27 @@ func (rt *RequestTracker) Do(thunk func(Stores)) {
 func (rt *RequestTracker) AllLocked(thunk func(Stores)) {
 	d, unlocker := rt.dt.lockAll()
 	rt.d = d
-	defer unlocker()
+	rt.allLocked = true
+	defer func() {
+		rt.allLocked = false
+		unlocker()
+	}()
 	thunk(d)
 }
 
+// locked returns whether the stores for prefix can be used by this request.
+func (rt *RequestTracker) locked(prefix string) bool {
+	if rt.allLocked {
+		return true
+	}
+	for _, l := range rt.locks {
+		if l == prefix {
+			return true
+		}
+	}
+	return false
+}
+
 func (rt *RequestTracker) backend(m models.Model) store.Store {
 	return rt.dt.getBackend(m)
 }
@@ -256,51 +277,213 @@ func (rt *RequestTracker) Save(obj models.Model) (saved bool, err error) {
 	return saved, err
 }
 
-func (rt *RequestTracker) GetParams(obj models.Paramer, aggregate bool) map[string]interface{} {
-	res := obj.GetParams()
-	if !aggregate {
-		return res
+// paramLayer is one source of parameters for an object.
+type paramLayer struct {
+	models.ParamSource
+	params map[string]interface{}
+}
+
+// paramLayers returns the sources of parameters for obj in order of
+// precedence: obj itself, the Profiles of a Machine, the Profiles of
+// its Stage, and finally the global Profile.
+func (rt *RequestTracker) paramLayers(obj models.Paramer) []*paramLayer {
+	res := []*paramLayer{}
+	add := func(source, name, profile string, p models.Paramer) {
+		res = append(res, &paramLayer{
+			ParamSource: models.ParamSource{Source: source, Name: name, Profile: profile},
+			params:      p.GetParams(),
+		})
 	}
-	subObjs := []models.Paramer{}
 	var profiles []string
-	var stage string
+	var stage, source string
 	switch ref := obj.(type) {
 	case *rMachine:
-		profiles, stage = ref.Profiles, ref.Stage
+		profiles, stage, source = ref.Profiles, ref.Stage, "machine"
 	case *models.Machine:
-		profiles, stage = ref.Profiles, ref.Stage
+		profiles, stage, source = ref.Profiles, ref.Stage, "machine"
 	case *Machine:
-		profiles, stage = ref.Profiles, ref.Stage
+		profiles, stage, source = ref.Profiles, ref.Stage, "machine"
+	case *models.Profile, *Profile:
+		source = "profile"
+		if obj.Key() == rt.dt.GlobalProfileName {
+			source = "global"
+		}
+	default:
+		source = strings.TrimSuffix(obj.Prefix(), "s")
 	}
+	add(source, obj.Key(), "", obj)
 	for _, pn := range profiles {
 		if pobj := rt.Find("profiles", pn); pobj != nil {
-			subObjs = append(subObjs, pobj.(models.Paramer))
+			add("profile", pn, "", pobj.(models.Paramer))
 		}
 	}
-	if sobj := rt.Find("stages", stage); sobj != nil {
-		for _, pn := range AsStage(sobj).Profiles {
-			if pobj := rt.Find("profiles", pn); pobj != nil {
-				subObjs = append(subObjs, pobj.(models.Paramer))
+	if stage != "" {
+		if sobj := rt.Find("stages", stage); sobj != nil {
+			for _, pn := range AsStage(sobj).Profiles {
+				if pobj := rt.Find("profiles", pn); pobj != nil {
+					add("stage", stage, pn, pobj.(models.Paramer))
+				}
 			}
 		}
 	}
-	if pobj := rt.Find("profiles", rt.dt.GlobalProfileName); pobj != nil {
-		subObjs = append(subObjs, pobj.(models.Paramer))
+	if source != "global" {
+		if pobj := rt.Find("profiles", rt.dt.GlobalProfileName); pobj != nil {
+			add("global", rt.dt.GlobalProfileName, "", pobj.(models.Paramer))
+		}
+	}
+	return res
+}
+
+// GetParams returns the params of obj.  If aggregate is true, the
+// params of its Profiles, its Stage, the global Profile, and, with
+// the params lock held, the default values of Params are merged in
+// the order ExplainParams reports them.
+func (rt *RequestTracker) GetParams(obj models.Paramer, aggregate bool) map[string]interface{} {
+	res := obj.GetParams()
+	if !aggregate {
+		return res
 	}
-	for _, sub := range subObjs {
-		subp := sub.GetParams()
-		for k, v := range subp {
+	for _, layer := range rt.paramLayers(obj)[1:] {
+		for k, v := range layer.params {
 			if _, ok := res[k]; !ok {
 				res[k] = v
 			}
 		}
 	}
+	if rt.locked("params") {
+		for _, pobj := range rt.d("params").Items() {
+			param := AsParam(pobj)
+			if _, ok := res[param.Name]; ok {
+				continue
+			}
+			if dv, ok := param.DefaultValue(); ok {
+				res[param.Name] = dv
+			}
+		}
+	}
 	return res
 }
 
+// ExplainParams returns, for every parameter visible to obj, its
+// effective value, the layer that value came from, and the values
+// from lower layers that it shadows.  Param default values are the
+// lowest layer.
+func (rt *RequestTracker) ExplainParams(obj models.Paramer) map[string]*models.ParamExplanation {
+	res := map[string]*models.ParamExplanation{}
+	add := func(k string, src models.ParamSource, v interface{}) {
+		src.Value = v
+		if e, ok := res[k]; ok {
+			e.Shadowed = append(e.Shadowed, &src)
+			return
+		}
+		res[k] = &models.ParamExplanation{Value: v, Source: &src, Shadowed: []*models.ParamSource{}}
+	}
+	for _, layer := range rt.paramLayers(obj) {
+		for k, v := range layer.params {
+			add(k, layer.ParamSource, v)
+		}
+	}
+	if rt.locked("params") {
+		for _, pobj := range rt.d("params").Items() {
+			param := AsParam(pobj)
+			if dv, ok := param.DefaultValue(); ok {
+				add(param.Name, models.ParamSource{Source: "default", Name: param.Name}, dv)
+			}
+		}
+	}
+	return res
+}
+
+// ParamErrors returns the reasons val is not a valid value for the
+// Param named key.  Values for undefined Params are always valid, and
+// sealed values are checked once unsealed.  Nothing can be checked
+// without the params lock, so every value is invalid then.
+func (rt *RequestTracker) ParamErrors(key string, val interface{}) []string {
+	if IsSealed(val) {
+		// Check what was sealed, so that a sealed value cannot be
+		// used to get around the schema.
+		pv, err := rt.dt.unsealValue(val)
+		if err != nil {
+			return []string{err.Error()}
+		}
+		val = pv
+	}
+	if !rt.locked("params") {
+		return []string{"cannot be checked without the params lock"}
+	}
+	pobj := rt.Find("params", key)
+	if pobj == nil {
+		return nil
+	}
+	switch err := AsParam(pobj).ValidateValue(val).(type) {
+	case nil:
+		return nil
+	case *models.Error:
+		return err.Messages
+	default:
+		return []string{err.Error()}
+	}
+}
+
+// ParamReport revalidates every param value on every Machine,
+// Profile, and Plugin against the schema of its Param, and returns the
+// ones that fail.
+func (rt *RequestTracker) ParamReport() []*models.ParamError {
+	res := []*models.ParamError{}
+	for _, prefix := range []string{"machines", "profiles", "plugins"} {
+		for _, obj := range rt.d(prefix).Items() {
+			pobj := obj.(models.Paramer)
+			params := pobj.GetParams()
+			keys := make([]string, 0, len(params))
+			for k := range params {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if msgs := rt.ParamErrors(k, params[k]); len(msgs) > 0 {
+					res = append(res, &models.ParamError{
+						Model:  prefix,
+						Key:    pobj.Key(),
+						Param:  k,
+						Errors: msgs,
+					})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// validateParams checks the values in params that differ from old
+// against the schemas of their Params.  Values that are not changing
+// are left alone, so an existing bad value does not block unrelated
+// updates.
+func (rt *RequestTracker) validateParams(old, params map[string]interface{}, e models.ErrorAdder) {
+	for k, v := range params {
+		if ov, ok := old[k]; ok && reflect.DeepEqual(ov, v) {
+			continue
+		}
+		for _, msg := range rt.ParamErrors(k, v) {
+			e.Errorf("Key '%s': %s", k, msg)
+		}
+	}
+}
+
 func (rt *RequestTracker) SetParams(obj models.Paramer, values map[string]interface{}) error {
-	obj.SetParams(values)
 	e := &models.Error{Code: 422, Type: ValidationError, Model: obj.Prefix(), Key: obj.Key()}
+	old := obj.GetParams()
+	unredactParams(old, values, e)
+	rt.validateParams(old, values, e)
+	if e.ContainsError() {
+		return e
+	}
+	// obj is what is in the stores, so by the time BeforeSave runs it
+	// can no longer tell which values changed.  Seal them here.
+	rt.sealParams(old, values, e)
+	if e.ContainsError() {
+		return e
+	}
+	obj.SetParams(values)
 	_, e2 := rt.Save(obj)
 	e.AddError(e2)
 	return e.HasError()
@@ -308,14 +491,7 @@ func (rt *RequestTracker) SetParams(obj models.Paramer, values map[string]interf
 
 func (rt *RequestTracker) GetParam(obj models.Paramer, key string, aggregate bool) (interface{}, bool) {
 	v, ok := rt.GetParams(obj, aggregate)[key]
-	if ok || !aggregate {
-		return v, ok
-	}
-	if pobj := rt.Find("params", key); pobj != nil {
-		rt.Tracef("Param %s not defined, falling back to default value")
-		return AsParam(pobj).DefaultValue()
-	}
-	return nil, false
+	return v, ok
 }
 
 func (rt *RequestTracker) SetParam(obj models.Paramer, key string, val interface{}) error {
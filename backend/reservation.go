@@ -8,6 +8,7 @@ import (
 	"github.com/digitalrebar/provision/backend/index"
 	"github.com/digitalrebar/provision/models"
 	"github.com/digitalrebar/store"
+	"github.com/pborman/uuid"
 )
 
 // Reservation tracks persistent DHCP IP address reservations.
@@ -63,6 +64,28 @@ func (l *Reservation) Indexes() map[string]index.Maker {
 			res.Addr = addr
 			return res, nil
 		})
+	res["Machine"] = index.Make(
+		false,
+		"UUID string",
+		func(i, j models.Model) bool { return fix(i).Machine.String() < fix(j).Machine.String() },
+		func(ref models.Model) (gte, gt index.Test) {
+			refMachine := fix(ref).Machine.String()
+			return func(s models.Model) bool {
+					return fix(s).Machine.String() >= refMachine
+				},
+				func(s models.Model) bool {
+					return fix(s).Machine.String() > refMachine
+				}
+		},
+		func(s string) (models.Model, error) {
+			id := uuid.Parse(s)
+			if id == nil {
+				return nil, fmt.Errorf("Invalid UUID: %s", s)
+			}
+			res := fix(l.New())
+			res.Machine = id
+			return res, nil
+		})
 	res["Token"] = index.Make(
 		false,
 		"string",
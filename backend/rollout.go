@@ -0,0 +1,389 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/store"
+	"github.com/pborman/uuid"
+)
+
+// Rollout moves the Machines that match a filter to a Stage a few at a
+// time, and pauses when too many of them fail.
+//
+// swagger:model
+type Rollout struct {
+	*models.Rollout
+	validate
+	// advance is set when the Rollout should start more Machines the
+	// next time it is saved.
+	advance bool
+}
+
+func (obj *Rollout) SetReadOnly(b bool) {
+	obj.ReadOnly = b
+}
+
+func (obj *Rollout) SaveClean() store.KeySaver {
+	mod := *obj.Rollout
+	mod.ClearValidation()
+	return toBackend(&mod, obj.rt)
+}
+
+func (r *Rollout) Indexes() map[string]index.Maker {
+	fix := AsRollout
+	res := index.MakeBaseIndexes(r)
+	res["Name"] = index.Make(
+		true,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Name < fix(j).Name },
+		func(ref models.Model) (gte, gt index.Test) {
+			refName := fix(ref).Name
+			return func(s models.Model) bool {
+					return fix(s).Name >= refName
+				},
+				func(s models.Model) bool {
+					return fix(s).Name > refName
+				}
+		},
+		func(s string) (models.Model, error) {
+			ro := fix(r.New())
+			ro.Name = s
+			return ro, nil
+		})
+	res["Stage"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Stage < fix(j).Stage },
+		func(ref models.Model) (gte, gt index.Test) {
+			refStage := fix(ref).Stage
+			return func(s models.Model) bool {
+					return fix(s).Stage >= refStage
+				},
+				func(s models.Model) bool {
+					return fix(s).Stage > refStage
+				}
+		},
+		func(s string) (models.Model, error) {
+			ro := fix(r.New())
+			ro.Stage = s
+			return ro, nil
+		})
+	res["State"] = index.Make(
+		false,
+		"string",
+		func(i, j models.Model) bool { return fix(i).State < fix(j).State },
+		func(ref models.Model) (gte, gt index.Test) {
+			refState := fix(ref).State
+			return func(s models.Model) bool {
+					return fix(s).State >= refState
+				},
+				func(s models.Model) bool {
+					return fix(s).State > refState
+				}
+		},
+		func(s string) (models.Model, error) {
+			ro := fix(r.New())
+			ro.State = s
+			return ro, nil
+		})
+	return res
+}
+
+func (r *Rollout) New() store.KeySaver {
+	res := &Rollout{Rollout: &models.Rollout{}}
+	if r.Rollout != nil && r.ChangeForced() {
+		res.ForceChange()
+	}
+	res.Filter = map[string]string{}
+	res.Machines = []models.RolloutMachine{}
+	res.rt = r.rt
+	return res
+}
+
+// OnCreate picks the Machines the Rollout will move.  The filter is
+// only evaluated here, so Machines that match it later are left alone.
+func (r *Rollout) OnCreate() error {
+	if r.State == "" {
+		r.State = models.RolloutRunning
+	}
+	if r.Concurrency == 0 {
+		r.Concurrency = 1
+	}
+	r.Failures = 0
+	r.Reason = ""
+	r.Machines = []models.RolloutMachine{}
+	if len(r.Filter) == 0 {
+		// Validate will complain about this.
+		return nil
+	}
+	filters, err := r.rt.MachineFilters(r.Filter)
+	if err != nil {
+		r.Errorf("Invalid Filter: %v", err)
+		return r.MakeError(http.StatusUnprocessableEntity, ValidationError, r)
+	}
+	idx, err := index.All(filters...)(&r.rt.stores("machines").Index)
+	if err != nil {
+		r.Errorf("Invalid Filter: %v", err)
+		return r.MakeError(http.StatusUnprocessableEntity, ValidationError, r)
+	}
+	for _, i := range idx.Items() {
+		m := AsMachine(i)
+		r.Machines = append(r.Machines, models.RolloutMachine{
+			Machine: m.Uuid,
+			Name:    m.Name,
+			Status:  models.RolloutPending,
+		})
+	}
+	if len(r.Machines) == 0 {
+		r.Errorf("Filter does not match any Machines")
+		return r.MakeError(http.StatusUnprocessableEntity, ValidationError, r)
+	}
+	r.advance = true
+	return nil
+}
+
+// OnChange only allows the Rollout to be paused, resumed, or aborted,
+// and its Description, Concurrency, and MaxFailures to be changed.
+// The Machines and their progress are kept from the stored Rollout.
+func (r *Rollout) OnChange(oldThing store.KeySaver) error {
+	old := AsRollout(oldThing)
+	e := &models.Error{
+		Code:  http.StatusUnprocessableEntity,
+		Type:  ValidationError,
+		Model: r.Prefix(),
+		Key:   r.Key(),
+	}
+	if r.Stage != old.Stage {
+		e.Errorf("Can not change Stage from %s to %s", old.Stage, r.Stage)
+	}
+	if len(r.Filter) != len(old.Filter) {
+		e.Errorf("Can not change Filter")
+	} else {
+		for k, v := range old.Filter {
+			if nv, ok := r.Filter[k]; !ok || nv != v {
+				e.Errorf("Can not change Filter")
+				break
+			}
+		}
+	}
+	r.Machines = make([]models.RolloutMachine, len(old.Machines))
+	copy(r.Machines, old.Machines)
+	r.Failures = old.Failures
+	if r.State == "" {
+		r.State = old.State
+	}
+	if r.State == old.State {
+		r.Reason = old.Reason
+		r.advance = r.State == models.RolloutRunning && r.Concurrency > old.Concurrency
+		return e.HasError()
+	}
+	switch {
+	case old.State == models.RolloutComplete || old.State == models.RolloutAborted:
+		e.Errorf("Can not change State of a Rollout that is %s", old.State)
+	case r.State == models.RolloutComplete:
+		e.Errorf("Can not mark a Rollout as complete")
+	case r.State == models.RolloutRunning:
+		// Resuming starts the failure budget over.
+		r.Failures = 0
+		r.Reason = ""
+		r.advance = true
+	default:
+		r.Reason = ""
+	}
+	return e.HasError()
+}
+
+func (r *Rollout) Validate() {
+	r.Rollout.Validate()
+	r.AddError(index.CheckUnique(r, r.rt.stores("rollouts").Items()))
+	if !r.SetValid() {
+		return
+	}
+	if r.rt.Find("stages", r.Stage) == nil {
+		r.Errorf("Stage %s does not exist", r.Stage)
+	}
+	r.SetAvailable()
+}
+
+func (r *Rollout) OnLoad() error {
+	defer func() { r.rt = nil }()
+	return r.BeforeSave()
+}
+
+func (r *Rollout) BeforeSave() error {
+	if r.Filter == nil {
+		r.Filter = map[string]string{}
+	}
+	if r.Machines == nil {
+		r.Machines = []models.RolloutMachine{}
+	}
+	r.Validate()
+	if !r.Validated {
+		return r.MakeError(422, ValidationError, r)
+	}
+	if r.advance {
+		r.advance = false
+		r.step()
+	}
+	return nil
+}
+
+func AsRollout(o models.Model) *Rollout {
+	return o.(*Rollout)
+}
+
+func AsRollouts(o []models.Model) []*Rollout {
+	res := make([]*Rollout, len(o))
+	for i := range o {
+		res[i] = AsRollout(o[i])
+	}
+	return res
+}
+
+var rolloutLockMap = map[string][]string{
+	"get":     []string{"rollouts"},
+	"create":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations", "rollouts"},
+	"update":  []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations", "rollouts"},
+	"patch":   []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations", "rollouts"},
+	"delete":  []string{"rollouts"},
+	"actions": []string{"stages", "bootenvs", "jobs", "machines", "tasks", "profiles", "templates", "params", "workflows", "subnets", "leases", "reservations", "rollouts"},
+}
+
+func (r *Rollout) Locks(action string) []string {
+	return rolloutLockMap[action]
+}
+
+func (r *Rollout) find(id uuid.UUID) int {
+	for i := range r.Machines {
+		if uuid.Equal(r.Machines[i].Machine, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Rollout) fail(rm *models.RolloutMachine, reason string) {
+	rm.Status = models.RolloutFailed
+	rm.Reason = reason
+	r.Failures++
+	r.rt.Infof("Rollout %s: Machine %s failed: %s", r.Name, rm.Name, reason)
+}
+
+// overBudget pauses the Rollout if too many Machines have failed.
+func (r *Rollout) overBudget() bool {
+	if r.Failures <= r.MaxFailures {
+		return false
+	}
+	r.State = models.RolloutPaused
+	r.Reason = fmt.Sprintf("%d Machines failed, more than the %d allowed", r.Failures, r.MaxFailures)
+	r.rt.Infof("Rollout %s paused: %s", r.Name, r.Reason)
+	return true
+}
+
+// start moves the Machine rm refers to into the Stage of the Rollout.
+func (r *Rollout) start(rm *models.RolloutMachine) error {
+	mo := r.rt.Find("machines", rm.Machine.String())
+	if mo == nil {
+		return fmt.Errorf("Machine was deleted")
+	}
+	m := AsMachine(mo)
+	if m.Stage == r.Stage {
+		rm.Status = models.RolloutSucceeded
+		return nil
+	}
+	nm := AsMachine(toBackend(models.Clone(m.Machine), r.rt))
+	nm.Stage = r.Stage
+	nm.Runnable = true
+	if _, err := r.rt.Update(nm); err != nil {
+		return err
+	}
+	rm.Status = models.RolloutActive
+	r.rt.Infof("Rollout %s moved Machine %s to Stage %s", r.Name, m.Key(), r.Stage)
+	return nil
+}
+
+// step checks on the active Machines, then starts pending ones until
+// Concurrency of them are active.  It pauses the Rollout when too many
+// Machines have failed, and marks it complete when none are left.
+func (r *Rollout) step() {
+	if r.State != models.RolloutRunning {
+		return
+	}
+	active := 0
+	for i := range r.Machines {
+		rm := &r.Machines[i]
+		if rm.Status != models.RolloutActive {
+			continue
+		}
+		mo := r.rt.Find("machines", rm.Machine.String())
+		switch {
+		case mo == nil:
+			r.fail(rm, "Machine was deleted")
+		case AsMachine(mo).Stage != r.Stage:
+			r.fail(rm, fmt.Sprintf("Machine was moved to Stage %s", AsMachine(mo).Stage))
+		default:
+			active++
+		}
+	}
+	if r.overBudget() {
+		return
+	}
+	for i := range r.Machines {
+		if active >= r.Concurrency {
+			break
+		}
+		rm := &r.Machines[i]
+		if rm.Status != models.RolloutPending {
+			continue
+		}
+		if err := r.start(rm); err != nil {
+			r.fail(rm, err.Error())
+			if r.overBudget() {
+				return
+			}
+			continue
+		}
+		if rm.Status == models.RolloutActive {
+			active++
+		}
+	}
+	if active == 0 && r.Count(models.RolloutPending) == 0 {
+		r.State = models.RolloutComplete
+		r.rt.Infof("Rollout %s complete: %d of %d Machines succeeded",
+			r.Name, r.Count(models.RolloutSucceeded), len(r.Machines))
+	}
+}
+
+// RolloutResult records that m has finished the Tasks in its Stage, or
+// failed one of them, for every running Rollout that moved it there.
+// Each of those Rollouts then starts more Machines or pauses.  It does
+// nothing unless the rollouts lock is held.
+func (rt *RequestTracker) RolloutResult(m *Machine, success bool, reason string) error {
+	if !rt.locked("rollouts") {
+		return nil
+	}
+	for _, i := range rt.stores("rollouts").Items() {
+		r := AsRollout(i)
+		if r.State != models.RolloutRunning || r.Stage != m.Stage {
+			continue
+		}
+		idx := r.find(m.Uuid)
+		if idx == -1 || r.Machines[idx].Status != models.RolloutActive {
+			continue
+		}
+		nr := AsRollout(toBackend(models.Clone(r.Rollout), rt))
+		if success {
+			nr.Machines[idx].Status = models.RolloutSucceeded
+		} else {
+			nr.fail(&nr.Machines[idx], reason)
+		}
+		nr.advance = true
+		if _, err := rt.Save(nr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
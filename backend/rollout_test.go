@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestRollout(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, rolloutLockMap["update"]...)
+	machines := []*models.Machine{
+		{Name: "ro1", Uuid: uuid.NewRandom()},
+		{Name: "ro2", Uuid: uuid.NewRandom()},
+		{Name: "ro3", Uuid: uuid.NewRandom()},
+	}
+	filter := map[string]string{"Name": "Between(ro1,ro3)"}
+	tests := []crudTest{
+		{"Create ro task", rt.Create, &models.Task{Name: "ro-task"}, true},
+		{"Create ro stage", rt.Create, &models.Stage{Name: "ro", BootEnv: "local", Tasks: []string{"ro-task"}}, true},
+		{"Create ro1", rt.Create, machines[0], true},
+		{"Create ro2", rt.Create, machines[1], true},
+		{"Create ro3", rt.Create, machines[2], true},
+		{"Create Rollout with no Filter", rt.Create, &models.Rollout{Name: "nofilter", Stage: "ro"}, false},
+		{"Create Rollout that matches nothing", rt.Create, &models.Rollout{Name: "nothing", Stage: "ro", Filter: map[string]string{"Name": "Eq(nope)"}}, false},
+		{"Create Rollout with missing Stage", rt.Create, &models.Rollout{Name: "nostage", Stage: "nope", Filter: filter}, false},
+		{"Create Rollout", rt.Create, &models.Rollout{Name: "ro", Stage: "ro", Filter: filter}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	// check verifies the State of the Rollout and the Status of each
+	// of its Machines, and returns the Rollout.
+	check := func(state string, statuses ...string) *Rollout {
+		t.Helper()
+		var r *Rollout
+		rt.Do(func(d Stores) {
+			r = AsRollout(rt.Find("rollouts", "ro"))
+		})
+		if r.State != state {
+			t.Errorf("Rollout should be %s, not %s (%s)", state, r.State, r.Reason)
+		}
+		for i, rm := range r.Machines {
+			if rm.Status != statuses[i] {
+				t.Errorf("Machine %s should be %s, not %s", rm.Name, statuses[i], rm.Status)
+			}
+		}
+		return r
+	}
+	check(models.RolloutRunning, models.RolloutActive, models.RolloutPending, models.RolloutPending)
+	// runJob creates a Job for the only Task of machine and moves it to state.
+	runJob := func(machine *models.Machine, state string) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			m := AsMachine(rt.Find("machines", machine.UUID()))
+			if m.Stage != "ro" {
+				t.Errorf("Machine %s should be in Stage ro, not %s", m.Name, m.Stage)
+				return
+			}
+			job := &Job{}
+			Fill(job)
+			job.Uuid = uuid.NewRandom()
+			job.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+			job.Machine = m.Uuid
+			job.Stage = m.Stage
+			job.Task = m.Tasks[0]
+			job.State = "created"
+			if _, err := rt.Create(job); err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			m.CurrentTask = 0
+			m.CurrentJob = job.Uuid
+			if _, err := rt.Save(m); err != nil {
+				t.Errorf("Failed to save machine: %v", err)
+				return
+			}
+			job = AsJob(rt.Find("jobs", job.Key()))
+			nj := AsJob(job.New())
+			nj.Job = models.Clone(job.Job).(*models.Job)
+			nj.State = state
+			if _, err := rt.Update(nj); err != nil {
+				t.Errorf("Failed to move job to %s: %v", state, err)
+			}
+		})
+	}
+	runJob(machines[0], "finished")
+	check(models.RolloutRunning, models.RolloutSucceeded, models.RolloutActive, models.RolloutPending)
+	runJob(machines[1], "failed")
+	r := check(models.RolloutPaused, models.RolloutSucceeded, models.RolloutFailed, models.RolloutPending)
+	if r.Failures != 1 || r.Reason == "" {
+		t.Errorf("Paused Rollout should have 1 failure and a Reason, not %d %q", r.Failures, r.Reason)
+	}
+	changed := models.Clone(r.Rollout).(*models.Rollout)
+	changed.Stage = "none"
+	resumed := models.Clone(r.Rollout).(*models.Rollout)
+	resumed.State = models.RolloutRunning
+	tests = []crudTest{
+		{"Change Rollout Stage", rt.Update, changed, false},
+		{"Resume Rollout", rt.Update, resumed, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	r = check(models.RolloutRunning, models.RolloutSucceeded, models.RolloutFailed, models.RolloutActive)
+	if r.Failures != 0 {
+		t.Errorf("Resumed Rollout should have no failures, not %d", r.Failures)
+	}
+	runJob(machines[2], "finished")
+	r = check(models.RolloutComplete, models.RolloutSucceeded, models.RolloutFailed, models.RolloutSucceeded)
+	aborted := models.Clone(r.Rollout).(*models.Rollout)
+	aborted.State = models.RolloutAborted
+	tests = []crudTest{
+		{"Abort complete Rollout", rt.Update, aborted, false},
+		{"Remove Rollout", rt.Remove, &models.Rollout{Name: "ro"}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+}
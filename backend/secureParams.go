@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+const (
+	// SecureParamPrefix marks a param value that has been sealed
+	// with the secureParamSecret preference.  Values of Params marked
+	// Secure are stored in this form on Machines and Profiles.
+	SecureParamPrefix = "drp-secure:"
+	// SecureParamRedacted is what the API hands back in place of a
+	// sealed value when the caller is not allowed to see it.  Sending
+	// it back unchanged leaves the sealed value alone.
+	SecureParamRedacted = "*** redacted ***"
+)
+
+// IsSealed returns whether the passed param value has been sealed.
+func IsSealed(val interface{}) bool {
+	s, ok := val.(string)
+	return ok && strings.HasPrefix(s, SecureParamPrefix)
+}
+
+func (dt *DataTracker) secureParamKey() ([]byte, error) {
+	key := dt.pref("secureParamSecret")
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secureParamSecret is not set")
+	}
+	return []byte(key), nil
+}
+
+// sealValue encrypts val with the secureParamSecret.  Values that are
+// already sealed are returned unchanged.
+func (dt *DataTracker) sealValue(val interface{}) (interface{}, error) {
+	if IsSealed(val) {
+		return val, nil
+	}
+	key, err := dt.secureParamKey()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	res, err := encrypt(key, string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return SecureParamPrefix + res, nil
+}
+
+// unsealValue decrypts a value sealed by sealValue.  Values that are
+// not sealed are returned unchanged.
+func (dt *DataTracker) unsealValue(val interface{}) (interface{}, error) {
+	if !IsSealed(val) {
+		return val, nil
+	}
+	key, err := dt.secureParamKey()
+	if err != nil {
+		return nil, err
+	}
+	buf, err := decrypt(key, strings.TrimPrefix(val.(string), SecureParamPrefix))
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal([]byte(buf), &res); err != nil {
+		return nil, fmt.Errorf("Unable to unseal param value: %v", err)
+	}
+	return res, nil
+}
+
+// RedactParams returns a copy of params with every sealed value
+// replaced.  If reveal returns true for a key, the value is replaced
+// by its plaintext, otherwise it is replaced by SecureParamRedacted.
+func (dt *DataTracker) RedactParams(params map[string]interface{}, reveal func(string) bool) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+	res := map[string]interface{}{}
+	for k, v := range params {
+		if !IsSealed(v) {
+			res[k] = v
+			continue
+		}
+		res[k] = SecureParamRedacted
+		if reveal != nil && reveal(k) {
+			if pv, err := dt.unsealValue(v); err == nil {
+				res[k] = pv
+			}
+		}
+	}
+	return res
+}
+
+// Redact applies RedactParams to the params of m if it has any.
+// m should be a copy of whatever is in the stores.
+func (dt *DataTracker) Redact(m models.Model, reveal func(string) bool) models.Model {
+	if p, ok := m.(models.Paramer); ok {
+		p.SetParams(dt.RedactParams(p.GetParams(), reveal))
+	}
+	return m
+}
+
+func (rt *RequestTracker) secureParam(key string) bool {
+	if !rt.locked("params") {
+		return false
+	}
+	if p := rt.Find("params", key); p != nil {
+		return AsParam(p).Secure
+	}
+	return false
+}
+
+// unredactParams puts back the sealed values from old wherever params
+// still holds the redaction placeholder for them.
+func unredactParams(old, params map[string]interface{}, e models.ErrorAdder) {
+	for k, v := range params {
+		if s, ok := v.(string); !ok || s != SecureParamRedacted {
+			continue
+		}
+		if ov, ok := old[k]; ok && IsSealed(ov) {
+			params[k] = ov
+		} else {
+			e.Errorf("Key '%s': cannot be set to the redacted placeholder", k)
+		}
+	}
+}
+
+// sealExisting seals the values that Machines and Profiles already
+// have for the Param key, which has just been marked Secure.
+func (rt *RequestTracker) sealExisting(key string) {
+	for _, locks := range [][]string{machineLockMap["update"], profileLockMap["update"]} {
+		for _, lock := range locks {
+			if !rt.locked(lock) {
+				rt.Errorf("Unable to seal the values of Param %s without the %s lock", key, lock)
+				return
+			}
+		}
+	}
+	for _, prefix := range []string{"machines", "profiles"} {
+		for _, obj := range rt.stores(prefix).Items() {
+			params := obj.(models.Paramer).GetParams()
+			v, ok := params[key]
+			if !ok || IsSealed(v) {
+				continue
+			}
+			sv, err := rt.dt.sealValue(v)
+			if err != nil {
+				rt.Errorf("Unable to seal Param %s on %s %s: %v", key, prefix, obj.Key(), err)
+				continue
+			}
+			params[key] = sv
+			nobj := toBackend(models.Clone(obj), rt)
+			nobj.(models.Paramer).SetParams(params)
+			if _, err := rt.Save(nobj); err != nil {
+				rt.Errorf("Unable to seal Param %s on %s %s: %v", key, prefix, obj.Key(), err)
+			}
+		}
+	}
+}
+
+// sealParams seals, in place, the values in params that belong to
+// Params marked Secure.  Values that are the same as in old were
+// already checked when they were saved and are left alone.  Anything
+// else needs the params lock to tell whether it must be sealed, and
+// the save fails rather than storing a secure value in the clear.
+func (rt *RequestTracker) sealParams(old, params map[string]interface{}, e models.ErrorAdder) {
+	changed := []string{}
+	for k, v := range params {
+		if IsSealed(v) {
+			continue
+		}
+		if ov, ok := old[k]; ok && reflect.DeepEqual(ov, v) {
+			continue
+		}
+		changed = append(changed, k)
+	}
+	if len(changed) == 0 {
+		return
+	}
+	if !rt.locked("params") {
+		e.Errorf("Params %v cannot be changed without the params lock", changed)
+		return
+	}
+	for _, k := range changed {
+		if !rt.secureParam(k) {
+			continue
+		}
+		sv, err := rt.dt.sealValue(params[k])
+		if err != nil {
+			e.Errorf("Key '%s': unable to seal value: %v", k, err)
+			continue
+		}
+		params[k] = sv
+	}
+}
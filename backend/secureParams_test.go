@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestSecureParams(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "profiles", "params", "preferences")
+	secret := map[string]interface{}{"user": "root", "password": "hunter2"}
+	rt.Do(func(d Stores) {
+		if ok, err := rt.Create(&models.Param{
+			Name:   "secret",
+			Secure: true,
+			Schema: map[string]interface{}{"type": "object"},
+		}); !ok {
+			t.Fatalf("Failed to create secure param: %v", err)
+		}
+		if ok, err := rt.Create(&models.Profile{
+			Name:   "secure",
+			Params: map[string]interface{}{"secret": secret, "plain": "visible"},
+		}); !ok {
+			t.Fatalf("Failed to create profile: %v", err)
+		}
+		prof := AsProfile(rt.Find("profiles", "secure"))
+		sealed := prof.Params["secret"]
+		if !IsSealed(sealed) {
+			t.Fatalf("Secure param was not sealed: %v", sealed)
+		}
+		if prof.Params["plain"] != "visible" {
+			t.Errorf("Normal param should not be sealed: %v", prof.Params["plain"])
+		}
+		val, err := dt.unsealValue(sealed)
+		if err != nil || !reflect.DeepEqual(val, secret) {
+			t.Errorf("Unsealed value should be %v, got %v (%v)", secret, val, err)
+		}
+		redacted := dt.RedactParams(prof.Params, nil)
+		if redacted["secret"] != SecureParamRedacted || redacted["plain"] != "visible" {
+			t.Errorf("Unexpected redacted params: %v", redacted)
+		}
+		revealed := dt.RedactParams(prof.Params, func(k string) bool { return k == "secret" })
+		if !reflect.DeepEqual(revealed["secret"], secret) {
+			t.Errorf("Revealed value should be %v, got %v", secret, revealed["secret"])
+		}
+		// Handing the placeholder back must not clobber the sealed value.
+		if err := rt.SetParams(prof, redacted); err != nil {
+			t.Errorf("Setting params with the redacted placeholder failed: %v", err)
+		} else if prof.Params["secret"] != sealed {
+			t.Errorf("Placeholder replaced the sealed value: %v", prof.Params["secret"])
+		}
+		if err := rt.SetParam(prof, "plain", SecureParamRedacted); err == nil {
+			t.Errorf("Setting a param without a sealed value to the placeholder should fail")
+		}
+		if err := dt.SetPrefs(rt, map[string]string{"secureParamSecret": randString(32)}); err == nil {
+			t.Errorf("Changing secureParamSecret should fail")
+		}
+	})
+	// Without the params lock there is no telling whether a new value
+	// must be sealed, so the save has to fail.
+	mrt := dt.Request(dt.Logger, machineLockMap["create"]...)
+	m := &models.Machine{Name: "secure", Uuid: uuid.NewRandom(), Params: map[string]interface{}{"secret": secret}}
+	mrt.Do(func(d Stores) {
+		if ok, err := mrt.Create(m); !ok {
+			t.Errorf("Failed to create machine: %v", err)
+		}
+	})
+	nrt := dt.Request(dt.Logger, stageLockMap["update"]...)
+	nrt.Do(func(d Stores) {
+		sm := AsMachine(nrt.Find("machines", m.UUID()))
+		nm := AsMachine(toBackend(models.Clone(sm.Machine), nrt))
+		nm.Params["secret"] = map[string]interface{}{"user": "root", "password": "plaintext"}
+		if _, err := nrt.Update(nm); err == nil {
+			t.Errorf("Changing a param without the params lock should fail")
+		}
+		if !IsSealed(AsMachine(nrt.Find("machines", m.UUID())).Params["secret"]) {
+			t.Errorf("Secure param should still be sealed")
+		}
+		nm = AsMachine(toBackend(models.Clone(sm.Machine), nrt))
+		nm.Description = "unchanged params"
+		if _, err := nrt.Update(nm); err != nil {
+			t.Errorf("Saving unchanged params without the params lock should work: %v", err)
+		}
+	})
+}
+
+func TestSecureParamsSetParam(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, paramLockMap["update"]...)
+	m := &models.Machine{Name: "setparam", Uuid: uuid.NewRandom(), Params: map[string]interface{}{"old-secret": "was plain"}}
+	tests := []crudTest{
+		{"Create secure param", rt.Create, &models.Param{Name: "secret", Secure: true, Schema: map[string]interface{}{"type": "string"}}, true},
+		{"Create old-secret param", rt.Create, &models.Param{Name: "old-secret", Schema: map[string]interface{}{"type": "string"}}, true},
+		{"Create setparam machine", rt.Create, m, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		sm := AsMachine(rt.Find("machines", m.UUID()))
+		if err := rt.SetParam(sm, "secret", "hunter2"); err != nil {
+			t.Errorf("Failed to set secure param: %v", err)
+			return
+		}
+		sealed := AsMachine(rt.Find("machines", m.UUID())).Params["secret"]
+		if !IsSealed(sealed) {
+			t.Errorf("Secure param set through SetParam was stored in the clear: %v", sealed)
+		}
+		// A sealed value is checked against the schema once unsealed,
+		// and one that cannot be unsealed is refused.
+		wrong, _ := dt.sealValue(5)
+		for _, v := range []interface{}{wrong, SecureParamPrefix + "forged"} {
+			if err := rt.SetParam(sm, "secret", v); err == nil {
+				t.Errorf("Sealed value %v should have been refused", v)
+			}
+		}
+		if AsMachine(rt.Find("machines", m.UUID())).Params["secret"] != sealed {
+			t.Errorf("Refused values should not have been saved")
+		}
+		// Values that were set before the Param was marked Secure
+		// are sealed when it is.
+		p := AsParam(toBackend(models.Clone(AsParam(rt.Find("params", "old-secret")).Param), rt))
+		p.Secure = true
+		if _, err := rt.Update(p); err != nil {
+			t.Errorf("Failed to mark old-secret Secure: %v", err)
+			return
+		}
+		v := AsMachine(rt.Find("machines", m.UUID())).Params["old-secret"]
+		if pv, err := dt.unsealValue(v); !IsSealed(v) || err != nil || pv != "was plain" {
+			t.Errorf("old-secret should have been sealed once it was Secure, not %v", v)
+		}
+	})
+}
@@ -246,6 +246,11 @@ func (s *Stage) BeforeDelete() error {
 		}
 		e.Errorf("Stage %s in use by Machine %s", s.Name, machine.Name)
 	}
+	for _, i := range s.rt.stores("workflows").Items() {
+		if wf := AsWorkflow(i); wf.HasStage(s.Name) {
+			e.Errorf("Stage %s in use by Workflow %s", s.Name, wf.Name)
+		}
+	}
 	return e.HasError()
 }
 
@@ -290,7 +295,7 @@ var stageLockMap = map[string][]string{
 	"create": []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles"},
 	"update": []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles"},
 	"patch":  []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles"},
-	"delete": []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles"},
+	"delete": []string{"stages", "bootenvs", "machines", "tasks", "templates", "profiles", "workflows"},
 }
 
 func (s *Stage) Locks(action string) []string {
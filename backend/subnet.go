@@ -619,9 +619,25 @@ var subnetLockMap = map[string][]string{
 	"create": []string{"subnets"},
 	"update": []string{"subnets"},
 	"patch":  []string{"subnets"},
-	"delete": []string{"subnets"},
+	"delete": []string{"subnets", "machines"},
 }
 
 func (s *Subnet) Locks(action string) []string {
 	return subnetLockMap[action]
 }
+
+func (s *Subnet) BeforeDelete() error {
+	e := &models.Error{Code: 409, Type: StillInUseError, Model: s.Prefix(), Key: s.Key()}
+	if !s.rt.locked("machines") {
+		return nil
+	}
+	for _, i := range s.rt.stores("machines").Items() {
+		m := AsMachine(i)
+		for _, intf := range m.Interfaces {
+			if intf.Subnet == s.Name {
+				e.Errorf("Subnet %s in use by interface %s of Machine %s", s.Name, intf.Name, m.Name)
+			}
+		}
+	}
+	return e.HasError()
+}
@@ -84,6 +84,7 @@ func (t *Task) genRoot(common *template.Template, e models.ErrorAdder) *template
 
 func (t *Task) Validate() {
 	t.Task.Validate()
+	t.validateConditions()
 	t.tmplMux.Lock()
 	defer t.tmplMux.Unlock()
 	t.rt.dt.tmplMux.Lock()
@@ -117,6 +118,24 @@ func (t *Task) Validate() {
 	return
 }
 
+// validateConditions makes sure that the Conditions of t can be turned
+// into Machine filters, so that mistakes are found when the Task is
+// saved instead of when a Job is created for it.  Conditions on Params
+// can only be checked when the params lock is held.
+func (t *Task) validateConditions() {
+	if len(t.Conditions) == 0 || !t.rt.locked("params") {
+		return
+	}
+	filters, err := t.rt.MachineFilters(t.Conditions)
+	if err == nil {
+		// The values are only parsed when the filters are run.
+		_, err = index.All(filters...)(index.Create([]models.Model{}))
+	}
+	if err != nil {
+		t.Errorf("Invalid Conditions: %v", err)
+	}
+}
+
 func (t *Task) OnLoad() error {
 	defer func() { t.rt = nil }()
 	return t.BeforeSave()
@@ -170,9 +189,9 @@ func (t *Task) Render(rt *RequestTracker, m *Machine, e *models.Error) renderers
 
 var taskLockMap = map[string][]string{
 	"get":    []string{"templates", "tasks"},
-	"create": []string{"stages", "templates", "tasks", "bootenvs"},
-	"update": []string{"stages", "templates", "tasks", "bootenvs"},
-	"patch":  []string{"stages", "templates", "tasks", "bootenvs"},
+	"create": []string{"stages", "templates", "tasks", "bootenvs", "params"},
+	"update": []string{"stages", "templates", "tasks", "bootenvs", "params"},
+	"patch":  []string{"stages", "templates", "tasks", "bootenvs", "params"},
 	"delete": []string{"stages", "tasks", "machines"},
 }
 
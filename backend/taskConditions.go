@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+// TaskRuns reports whether all of the Conditions of task hold for m.
+// Conditions on Params use the aggregated value of the Param, the same
+// as templates and list filters do.
+func (rt *RequestTracker) TaskRuns(m *Machine, task string) (bool, error) {
+	to := rt.Find("tasks", task)
+	if to == nil || len(AsTask(to).Conditions) == 0 {
+		return true, nil
+	}
+	filters, err := rt.MachineFilters(AsTask(to).Conditions)
+	if err != nil {
+		return false, fmt.Errorf("Invalid Conditions for Task %s: %v", task, err)
+	}
+	idx, err := index.All(filters...)(index.Create([]models.Model{m}))
+	if err != nil {
+		return false, fmt.Errorf("Invalid Conditions for Task %s: %v", task, err)
+	}
+	return len(idx.Items()) == 1, nil
+}
+
+// SkipTask records a skipped Job for task on m and makes it the
+// current Job, so the Job history shows that the Task was passed over.
+// For Stages without TaskDeps, CurrentTask must already be the index
+// of task.
+func (rt *RequestTracker) SkipTask(m *Machine, task string) error {
+	j := AsJob(toBackend(&models.Job{
+		Uuid:     uuid.NewRandom(),
+		Previous: m.CurrentJob,
+		Machine:  m.Uuid,
+		Stage:    m.Stage,
+		Task:     task,
+		State:    "skipped",
+	}, rt))
+	if j.Previous == nil {
+		j.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+	}
+	// The machine has to point at the Job before it is created, as
+	// skipping the last Task of the Stage finishes the Stage.
+	oldJob, oldTaskJob, deps := m.CurrentJob, m.TaskJobs[task], rt.TaskDeps(m)
+	m.CurrentJob = j.Uuid
+	if deps != nil {
+		if m.TaskJobs == nil {
+			m.TaskJobs = map[string]uuid.UUID{}
+		}
+		m.TaskJobs[task] = j.Uuid
+	}
+	if _, err := rt.Save(m); err != nil {
+		return err
+	}
+	if _, err := rt.Create(j); err != nil {
+		m.CurrentJob = oldJob
+		if oldTaskJob == nil {
+			delete(m.TaskJobs, task)
+		} else {
+			m.TaskJobs[task] = oldTaskJob
+		}
+		rt.Save(m)
+		return err
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Task %s skipped because its Conditions do not hold\n", task)
+	if err := j.Log(rt, buf); err != nil {
+		rt.Errorf("Failed to log skipped Job %s: %v", j.Key(), err)
+	}
+	rt.Infof("Skipped Task %s on Machine %s", task, m.Key())
+	return nil
+}
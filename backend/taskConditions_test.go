@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestTaskConditions(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "jobs", "workflows", "rollouts")
+	machine := &models.Machine{Name: "cond", Uuid: uuid.NewRandom(), Stage: "cond", Runnable: true}
+	tests := []crudTest{
+		{"Create cond-run task", rt.Create, &models.Task{Name: "cond-run", Conditions: map[string]string{"Name": "Eq(cond)"}}, true},
+		{"Create cond-skip task", rt.Create, &models.Task{Name: "cond-skip", Conditions: map[string]string{"Name": "Ne(cond)"}}, true},
+		{"Create task with Conditions on a missing Param", rt.Create, &models.Task{Name: "cond-bad", Conditions: map[string]string{"no-such-param": "Eq(true)"}}, false},
+		{"Create task with a broken Condition", rt.Create, &models.Task{Name: "cond-bad", Conditions: map[string]string{"Name": "Between(cond)"}}, false},
+		{"Create cond stage", rt.Create, &models.Stage{Name: "cond", BootEnv: "local", Tasks: []string{"cond-run", "cond-skip"}}, true},
+		{"Create cond machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	var skipped *Job
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		if runs, err := rt.TaskRuns(m, "cond-run"); err != nil || !runs {
+			t.Errorf("cond-run should run: %v", err)
+		}
+		if runs, err := rt.TaskRuns(m, "cond-skip"); err != nil || runs {
+			t.Errorf("cond-skip should not run: %v", err)
+		}
+		m.CurrentTask = 1
+		if err := rt.SkipTask(m, "cond-skip"); err != nil {
+			t.Errorf("Failed to skip cond-skip: %v", err)
+			return
+		}
+		m = AsMachine(rt.Find("machines", machine.UUID()))
+		jo := rt.Find("jobs", m.CurrentJob.String())
+		if jo == nil {
+			t.Errorf("Skipping a Task should leave a Job behind")
+			return
+		}
+		skipped = AsJob(jo)
+		if skipped.State != "skipped" || skipped.Task != "cond-skip" || skipped.EndTime.IsZero() {
+			t.Errorf("Job should be a finished skip of cond-skip, not %s of %s", skipped.State, skipped.Task)
+		}
+	})
+	if skipped == nil {
+		return
+	}
+	rmTests := []crudTest{
+		{"Remove skipped job", rt.Remove, skipped, true},
+	}
+	for _, test := range rmTests {
+		test.Test(t, rt)
+	}
+}
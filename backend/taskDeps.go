@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"github.com/pborman/uuid"
+)
+
+// TaskDeps returns the TaskDeps of the Stage m is in, or nil if the
+// Tasks of the Stage run one at a time.
+func (rt *RequestTracker) TaskDeps(m *Machine) map[string][]string {
+	so := rt.Find("stages", m.Stage)
+	if so == nil || len(AsStage(so).TaskDeps) == 0 {
+		return nil
+	}
+	return AsStage(so).TaskDeps
+}
+
+// isTaskJob reports whether j is the current Job of m, or one of the
+// Jobs running at the same time as it.
+func (n *Machine) isTaskJob(j *Job) bool {
+	return uuid.Equal(n.CurrentJob, j.Uuid) || uuid.Equal(n.TaskJobs[j.Task], j.Uuid)
+}
+
+// taskJob returns the last Job created for task on m, if any.  If j is
+// that Job, it is returned instead of the stored copy, as it may not
+// have been saved yet.
+func (rt *RequestTracker) taskJob(m *Machine, task string, j *Job) *Job {
+	id := m.TaskJobs[task]
+	if id == nil {
+		return nil
+	}
+	if j != nil && uuid.Equal(id, j.Uuid) {
+		return j
+	}
+	if jo := rt.Find("jobs", id.String()); jo != nil {
+		return AsJob(jo)
+	}
+	return nil
+}
+
+// readyTasks returns the Tasks of m that have no Job running and whose
+// dependencies have all finished or been skipped, in the order they are listed.  done
+// is true once all of them have finished.
+func (rt *RequestTracker) readyTasks(m *Machine, deps map[string][]string, j *Job) (ready []string, done bool) {
+	state := map[string]string{}
+	for _, t := range m.Tasks {
+		if tj := rt.taskJob(m, t, j); tj != nil {
+			state[t] = tj.State
+		}
+	}
+	done = true
+	for _, t := range m.Tasks {
+		switch state[t] {
+		case "finished", "skipped":
+			continue
+		case "created", "running":
+			done = false
+			continue
+		}
+		// Tasks that have not started, or whose last Job failed,
+		// was cancelled, or is incomplete, are run again.
+		done = false
+		ok := true
+		for _, d := range deps[t] {
+			if state[d] != "finished" && state[d] != "skipped" {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			ready = append(ready, t)
+		}
+	}
+	return
+}
+
+// active reports whether j has not finished running yet.
+func (j *Job) active() bool {
+	switch j.State {
+	case "created", "running", "incomplete":
+		return true
+	}
+	return false
+}
+
+// stageSettled reports whether j leaving the running states settles
+// the Stage m is in, and if so whether the Stage succeeded.  Without
+// TaskDeps the Stage fails with its first failed Job and succeeds once
+// the Job for its last Task finishes.  With TaskDeps it is not settled
+// while any other Job of the Stage is still running: then it has
+// failed if the last Job for any Task failed and will not be retried,
+// and succeeded once all of its Tasks have finished, in which case
+// CurrentTask is moved past the end of Tasks as well.
+func (j *Job) stageSettled(m *Machine) (settled, success bool) {
+	if m.Stage != j.Stage {
+		return false, false
+	}
+	deps := j.rt.TaskDeps(m)
+	if deps == nil {
+		if j.State == "failed" {
+			return true, false
+		}
+		return uuid.Equal(m.CurrentJob, j.Uuid) && m.CurrentTask == len(m.Tasks)-1, true
+	}
+	if !uuid.Equal(m.TaskJobs[j.Task], j.Uuid) {
+		return false, false
+	}
+	failed := false
+	for _, t := range m.Tasks {
+		tj := j.rt.taskJob(m, t, j)
+		if tj == nil {
+			continue
+		}
+		if tj.active() {
+			return false, false
+		}
+		if tj.State == "failed" {
+			if retry, _ := j.rt.jobRetry(m, tj); !retry {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return true, false
+	}
+	if _, done := j.rt.readyTasks(m, deps, j); !done {
+		return false, false
+	}
+	m.CurrentTask = len(m.Tasks)
+	_, err := j.rt.Save(m)
+	j.AddError(err)
+	return true, true
+}
+
+// NextParallelJob fills in b as a Job for the first Task of m that is
+// ready to run and creates it, skipping Tasks whose Conditions do not
+// hold along the way.  It returns false when no Task is ready,
+// because the rest are running or waiting on them, or because all of
+// them have finished.  m must be in a Stage with TaskDeps.
+//
+// Each new Job follows the one created before it, so the Previous
+// links still run through every Job of m in the order they were
+// created.
+func (rt *RequestTracker) NextParallelJob(m *Machine, b *Job) (bool, error) {
+	stage := m.Stage
+	task := ""
+	for task == "" {
+		ready, done := rt.readyTasks(m, rt.TaskDeps(m), nil)
+		if len(ready) == 0 {
+			if done && m.CurrentTask != len(m.Tasks) {
+				m.CurrentTask = len(m.Tasks)
+				_, err := rt.Save(m)
+				return false, err
+			}
+			return false, nil
+		}
+		for _, t := range ready {
+			runs, err := rt.TaskRuns(m, t)
+			if err != nil {
+				return false, err
+			}
+			if runs {
+				task = t
+				break
+			}
+			if err := rt.SkipTask(m, t); err != nil {
+				return false, err
+			}
+			// Skipping the last Task can move m along its Workflow.
+			m = AsMachine(rt.Find("machines", m.Key()))
+			if m.Stage != stage {
+				return false, nil
+			}
+		}
+	}
+	b.State = "created"
+	if m.CurrentJob == nil {
+		b.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+	} else {
+		b.Previous = m.CurrentJob
+	}
+	b.Stage = m.Stage
+	b.Task = task
+	b.Retry = 0
+	if prior := rt.taskJob(m, task, nil); prior != nil && prior.State == "failed" {
+		b.Retry = prior.Retry + 1
+	}
+	if _, err := rt.Create(b); err != nil {
+		return false, err
+	}
+	if m.TaskJobs == nil {
+		m.TaskJobs = map[string]uuid.UUID{}
+	}
+	m.TaskJobs[task] = b.Uuid
+	m.CurrentJob = b.Uuid
+	if _, err := rt.Save(m); err != nil {
+		rt.Remove(b)
+		return false, err
+	}
+	return true, nil
+}
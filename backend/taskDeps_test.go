@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestTaskDeps(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "jobs", "workflows", "rollouts")
+	machine := &models.Machine{Name: "dag", Uuid: uuid.NewRandom(), Stage: "dag", Runnable: true}
+	tasks := []string{"dag-a", "dag-b", "dag-c"}
+	tests := []crudTest{
+		{"Create dag-a", rt.Create, &models.Task{Name: "dag-a"}, true},
+		{"Create dag-b", rt.Create, &models.Task{Name: "dag-b"}, true},
+		{"Create dag-c", rt.Create, &models.Task{Name: "dag-c"}, true},
+		{"Create Stage with a missing dependency", rt.Create, &models.Stage{Name: "missing", BootEnv: "local", Tasks: tasks, TaskDeps: map[string][]string{"dag-c": {"dag-d"}}}, false},
+		{"Create Stage with a cycle", rt.Create, &models.Stage{Name: "cycle", BootEnv: "local", Tasks: tasks, TaskDeps: map[string][]string{"dag-a": {"dag-c"}, "dag-c": {"dag-a"}}}, false},
+		{"Create dag Stage", rt.Create, &models.Stage{Name: "dag", BootEnv: "local", Tasks: tasks, TaskDeps: map[string][]string{"dag-c": {"dag-a", "dag-b"}}}, true},
+		{"Create dag machine", rt.Create, machine, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	jobs := map[string]*Job{}
+	var order []uuid.UUID
+	// next asks for the next Job the way POST /jobs would, and returns
+	// the Task it was created for, or "" if there was none.
+	next := func() string {
+		t.Helper()
+		var task string
+		rt.Do(func(d Stores) {
+			m := AsMachine(rt.Find("machines", machine.UUID()))
+			j := &Job{}
+			Fill(j)
+			j.Uuid = uuid.NewRandom()
+			j.Machine = m.Uuid
+			created, err := rt.NextParallelJob(m, j)
+			if err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			if created {
+				task = j.Task
+				jobs[task] = j
+				order = append(order, j.Uuid)
+			}
+		})
+		return task
+	}
+	// finish moves the Job for task to finished.
+	finish := func(task string) {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			j := AsJob(rt.Find("jobs", jobs[task].Key()))
+			nj := AsJob(j.New())
+			nj.Job = models.Clone(j.Job).(*models.Job)
+			nj.State = "finished"
+			if _, err := rt.Update(nj); err != nil {
+				t.Errorf("Failed to finish job for %s: %v", task, err)
+			}
+		})
+	}
+	if a, b, c := next(), next(), next(); a != "dag-a" || b != "dag-b" || c != "" {
+		t.Errorf("dag-a and dag-b should start together, not %q %q %q", a, b, c)
+	}
+	rt.Do(func(d Stores) {
+		if !AsJob(rt.Find("jobs", jobs["dag-a"].Key())).Current {
+			t.Errorf("dag-a should stay current while dag-b runs")
+		}
+	})
+	finish("dag-a")
+	rt.Do(func(d Stores) {
+		if AsJob(rt.Find("jobs", jobs["dag-a"].Key())).Current {
+			t.Errorf("dag-a should not be current once it finishes")
+		}
+	})
+	if task := next(); task != "" {
+		t.Errorf("dag-c should wait for dag-b, not start %q", task)
+	}
+	finish("dag-b")
+	if task := next(); task != "dag-c" {
+		t.Errorf("dag-c should start once dag-a and dag-b finish, not %q", task)
+	}
+	finish("dag-c")
+	rt.Do(func(d Stores) {
+		m := AsMachine(rt.Find("machines", machine.UUID()))
+		if m.CurrentTask != len(m.Tasks) {
+			t.Errorf("Stage should be done once dag-c finishes, not at Task %d", m.CurrentTask)
+		}
+		for i := len(order) - 1; i > 0; i-- {
+			if j := AsJob(rt.Find("jobs", order[i].String())); !uuid.Equal(j.Previous, order[i-1]) {
+				t.Errorf("Job for %s should follow %s, not %s", j.Task, order[i-1], j.Previous)
+			}
+		}
+	})
+	if task := next(); task != "" {
+		t.Errorf("No Task should be left to run, not %q", task)
+	}
+	rmTests := []crudTest{}
+	for _, task := range tasks {
+		rmTests = append(rmTests, crudTest{"Remove job for " + task, rt.Remove, jobs[task], true})
+	}
+	for _, test := range rmTests {
+		test.Test(t, rt)
+	}
+}
@@ -107,7 +107,7 @@ func (t *Template) Validate() {
 	t.rt.dt.tmplMux.Lock()
 	root := t.rt.dt.rootTemplate
 	if root == nil {
-		root = template.New("")
+		root = newTemplate("")
 	} else {
 		root, err = root.Clone()
 	}
@@ -174,7 +174,7 @@ func (t *Template) BeforeDelete() error {
 		}
 		fmt.Fprintf(buf, `{{define "%s"}}%s{{end}}\n`, tmpl.ID, tmpl.Contents)
 	}
-	root, err := template.New("").Parse(buf.String())
+	root, err := newTemplate("").Parse(buf.String())
 	if err != nil {
 		e.Errorf("Template %s still required: %v", t.ID, err)
 		return e
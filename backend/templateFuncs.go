@@ -0,0 +1,573 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// TemplateFuncs returns the functions available to every template
+// dr-provision parses: the shared templates, the templates of
+// BootEnvs, Tasks, and Stages, and BootEnv BootParams.  Functions
+// take the thing they operate on as their last argument so that they
+// work in pipelines, e.g. {{.Machine.Name | shortName}}.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Strings
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       tmplJoin,
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+		"quote":      func(s interface{}) string { return strconv.Quote(tmplString(s)) },
+		"squote":     func(s interface{}) string { return "'" + tmplString(s) + "'" },
+		"indent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+		},
+		// Lists
+		"list":      func(items ...interface{}) []interface{} { return items },
+		"first":     tmplFirst,
+		"last":      tmplLast,
+		"rest":      tmplRest,
+		"initial":   tmplInitial,
+		"has":       tmplHas,
+		"uniq":      tmplUniq,
+		"sortAlpha": tmplSortAlpha,
+		"append":    tmplAppend,
+		// Maps
+		"dict":   tmplDict,
+		"keys":   tmplKeys,
+		"values": tmplValues,
+		"hasKey": func(m map[string]interface{}, key string) bool { _, ok := m[key]; return ok },
+		"get":    func(m map[string]interface{}, key string) interface{} { return m[key] },
+		"merge":  tmplMerge,
+		// Network
+		"ipAdd":         tmplIPAdd,
+		"ipInCidr":      tmplIPInCidr,
+		"cidrNetwork":   tmplCidrNetwork,
+		"cidrBroadcast": tmplCidrBroadcast,
+		"cidrNetmask":   tmplCidrNetmask,
+		"cidrPrefix":    tmplCidrPrefix,
+		"cidrHost":      tmplCidrHost,
+		"cidrSize":      tmplCidrSize,
+		// Hostnames
+		"shortName":  tmplShortName,
+		"domainName": tmplDomainName,
+		"hostName":   tmplHostName,
+		// Encoding and hashing
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) (string, error) {
+			buf, err := base64.StdEncoding.DecodeString(s)
+			return string(buf), err
+		},
+		"toJson": func(v interface{}) (string, error) {
+			buf, err := json.Marshal(v)
+			return string(buf), err
+		},
+		"toPrettyJson": func(v interface{}) (string, error) {
+			buf, err := json.MarshalIndent(v, "", "  ")
+			return string(buf), err
+		},
+		"toYaml": func(v interface{}) (string, error) {
+			buf, err := yaml.Marshal(v)
+			return strings.TrimSuffix(string(buf), "\n"), err
+		},
+		"sha256sum": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"crypt": tmplCrypt,
+		// Defaults
+		"default":  tmplDefaultValue,
+		"coalesce": tmplCoalesce,
+		"empty":    tmplEmpty,
+	}
+}
+
+// newTemplate creates an empty template with TemplateFuncs available.
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(TemplateFuncs())
+}
+
+func tmplString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
+	case fmt.Stringer:
+		return s.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// tmplSlice converts the passed value into a []interface{}.  It
+// accepts any kind of slice or array.
+func tmplSlice(v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	if res, ok := v.([]interface{}); ok {
+		return res, nil
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		res := make([]interface{}, val.Len())
+		for i := range res {
+			res[i] = val.Index(i).Interface()
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("Cannot use %T as a list", v)
+}
+
+func tmplJoin(sep string, v interface{}) (string, error) {
+	items, err := tmplSlice(v)
+	if err != nil {
+		return "", err
+	}
+	res := make([]string, len(items))
+	for i := range items {
+		res[i] = tmplString(items[i])
+	}
+	return strings.Join(res, sep), nil
+}
+
+func tmplFirst(v interface{}) (interface{}, error) {
+	items, err := tmplSlice(v)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func tmplLast(v interface{}) (interface{}, error) {
+	items, err := tmplSlice(v)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+func tmplRest(v interface{}) ([]interface{}, error) {
+	items, err := tmplSlice(v)
+	if err != nil || len(items) == 0 {
+		return []interface{}{}, err
+	}
+	return items[1:], nil
+}
+
+func tmplInitial(v interface{}) ([]interface{}, error) {
+	items, err := tmplSlice(v)
+	if err != nil || len(items) == 0 {
+		return []interface{}{}, err
+	}
+	return items[:len(items)-1], nil
+}
+
+func tmplHas(needle, v interface{}) (bool, error) {
+	items, err := tmplSlice(v)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func tmplUniq(v interface{}) ([]interface{}, error) {
+	items, err := tmplSlice(v)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for _, item := range items {
+		if found, _ := tmplHas(item, res); !found {
+			res = append(res, item)
+		}
+	}
+	return res, nil
+}
+
+func tmplSortAlpha(v interface{}) ([]string, error) {
+	items, err := tmplSlice(v)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, len(items))
+	for i := range items {
+		res[i] = tmplString(items[i])
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func tmplAppend(v interface{}, items ...interface{}) ([]interface{}, error) {
+	res, err := tmplSlice(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]interface{}{}, res...), items...), nil
+}
+
+func tmplDict(kv ...interface{}) (map[string]interface{}, error) {
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("dict requires an even number of arguments")
+	}
+	res := map[string]interface{}{}
+	for i := 0; i < len(kv); i += 2 {
+		res[tmplString(kv[i])] = kv[i+1]
+	}
+	return res, nil
+}
+
+func tmplKeys(m map[string]interface{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// tmplValues returns the values of m, sorted by key.
+func tmplValues(m map[string]interface{}) []interface{} {
+	res := make([]interface{}, 0, len(m))
+	for _, k := range tmplKeys(m) {
+		res = append(res, m[k])
+	}
+	return res
+}
+
+// tmplMerge merges maps together.  Keys in earlier maps take
+// precedence, just like params on a Machine take precedence over the
+// params in its Profiles.
+func tmplMerge(maps ...map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for i := len(maps) - 1; i >= 0; i-- {
+		for k, v := range maps[i] {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func tmplParseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("Invalid IP address %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, nil
+	}
+	return ip, nil
+}
+
+// ipOffset adds n to ip, which may be negative.  It fails if the
+// result does not fit in the address family of ip.
+func ipOffset(ip net.IP, n int64) (net.IP, error) {
+	val := big.NewInt(0).SetBytes(ip)
+	val.Add(val, big.NewInt(n))
+	if val.Sign() < 0 || len(val.Bytes()) > len(ip) {
+		return nil, fmt.Errorf("%s + %d is out of range", ip, n)
+	}
+	buf := val.Bytes()
+	res := make(net.IP, len(ip))
+	copy(res[len(res)-len(buf):], buf)
+	return res, nil
+}
+
+func tmplIPAdd(n int, addr string) (string, error) {
+	ip, err := tmplParseIP(addr)
+	if err != nil {
+		return "", err
+	}
+	res, err := ipOffset(ip, int64(n))
+	if err != nil {
+		return "", err
+	}
+	return res.String(), nil
+}
+
+func tmplIPInCidr(cidr, addr string) (bool, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	ip, err := tmplParseIP(addr)
+	if err != nil {
+		return false, err
+	}
+	return ipNet.Contains(ip), nil
+}
+
+func tmplCidrNetwork(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	return ipNet.IP.String(), nil
+}
+
+func tmplCidrBroadcast(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	res := make(net.IP, len(ipNet.IP))
+	for i := range ipNet.IP {
+		res[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+	}
+	return res.String(), nil
+}
+
+func tmplCidrNetmask(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	return net.IP(ipNet.Mask).String(), nil
+}
+
+func tmplCidrPrefix(cidr string) (int, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 0, err
+	}
+	ones, _ := ipNet.Mask.Size()
+	return ones, nil
+}
+
+// tmplCidrHost returns the nth address in cidr.  Negative values of n
+// count back from the end of the range.
+func tmplCidrHost(n int, cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	base := ipNet.IP
+	if n < 0 {
+		bcast, _ := tmplCidrBroadcast(cidr)
+		base, _ = tmplParseIP(bcast)
+		n++
+	}
+	res, err := ipOffset(base, int64(n))
+	if err != nil || !ipNet.Contains(res) {
+		return "", fmt.Errorf("Host %d is not in %s", n, cidr)
+	}
+	return res.String(), nil
+}
+
+// tmplCidrSize returns the number of addresses in an IPv4 cidr.
+func tmplCidrSize(cidr string) (int64, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return 0, err
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones > 62 {
+		return 0, fmt.Errorf("%s is too large", cidr)
+	}
+	return int64(1) << uint(bits-ones), nil
+}
+
+func tmplShortName(fqdn string) string {
+	return strings.SplitN(fqdn, ".", 2)[0]
+}
+
+func tmplDomainName(fqdn string) string {
+	parts := strings.SplitN(strings.TrimSuffix(fqdn, "."), ".", 2)
+	if len(parts) == 2 {
+		return parts[1]
+	}
+	return ""
+}
+
+var invalidHostChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// tmplHostName turns an arbitrary string (a Machine name, a MAC
+// address, etc.) into a valid RFC 1123 host label.
+func tmplHostName(s string) string {
+	res := invalidHostChars.ReplaceAllString(strings.ToLower(tmplShortName(s)), "-")
+	res = strings.Trim(res, "-")
+	if len(res) > 63 {
+		res = strings.TrimRight(res[:63], "-")
+	}
+	return res
+}
+
+func tmplEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() == 0
+	case reflect.Bool:
+		return !val.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return val.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return val.IsNil()
+	}
+	return false
+}
+
+// tmplDefaultValue returns given unless it is empty, in which case it
+// returns def.  It is intended to be used in pipelines:
+// {{.Param "foo" | default "bar"}}
+func tmplDefaultValue(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || tmplEmpty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+// tmplCoalesce returns the first non-empty argument.
+func tmplCoalesce(vals ...interface{}) interface{} {
+	for _, v := range vals {
+		if !tmplEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// tmplCrypt hashes password with SHA-512 crypt, producing a $6$
+// string suitable for /etc/shadow, kickstart, and preseed files.  If
+// no salt is passed, a random one is generated.
+func tmplCrypt(password string, salt ...string) string {
+	s := ""
+	if len(salt) > 0 {
+		s = salt[0]
+	} else {
+		buf := randString(16)
+		for i := range buf {
+			s += string(cryptAlphabet[int(buf[i])%len(cryptAlphabet)])
+		}
+	}
+	return sha512Crypt(password, s)
+}
+
+// sha512Crypt implements the SHA-512 based crypt() from
+// https://www.akkadia.org/drepper/SHA-crypt.txt with the default
+// number of rounds.
+func sha512Crypt(password, salt string) string {
+	const rounds = 5000
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	p, s := []byte(password), []byte(salt)
+	sum := func(parts ...[]byte) []byte {
+		h := sha512.New()
+		for _, part := range parts {
+			h.Write(part)
+		}
+		return h.Sum(nil)
+	}
+	// repeatTo fills a byte sequence of length n by repeating src.
+	repeatTo := func(src []byte, n int) []byte {
+		res := make([]byte, 0, n)
+		for len(res) < n {
+			l := len(src)
+			if l > n-len(res) {
+				l = n - len(res)
+			}
+			res = append(res, src[:l]...)
+		}
+		return res
+	}
+	b := sum(p, s, p)
+	a := sha512.New()
+	a.Write(p)
+	a.Write(s)
+	a.Write(repeatTo(b, len(p)))
+	for i := len(p); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(b)
+		} else {
+			a.Write(p)
+		}
+	}
+	c := a.Sum(nil)
+	dp := sha512.New()
+	for range p {
+		dp.Write(p)
+	}
+	pSeq := repeatTo(dp.Sum(nil), len(p))
+	ds := sha512.New()
+	for i := 0; i < 16+int(c[0]); i++ {
+		ds.Write(s)
+	}
+	sSeq := repeatTo(ds.Sum(nil), len(s))
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(pSeq)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sSeq)
+		}
+		if i%7 != 0 {
+			h.Write(pSeq)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(pSeq)
+		}
+		c = h.Sum(nil)
+	}
+	out := &bytes.Buffer{}
+	enc := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	// The digest bytes are emitted in a permuted order.
+	for i := 0; i < 21; i++ {
+		j := i * 22
+		enc(c[j%63], c[(j+21)%63], c[(j+42)%63], 4)
+	}
+	enc(0, 0, c[63], 2)
+	return "$6$" + salt + "$" + out.String()
+}
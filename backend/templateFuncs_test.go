@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+)
+
+type funcTest struct {
+	tmpl, expect string
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []funcTest{
+		{`{{"Foo" | lower}} {{"foo" | upper}} {{"foo bar" | title}}`, "foo FOO Foo Bar"},
+		{`{{"  foo  " | trim | trimPrefix "f" | trimSuffix "o"}}`, "o"},
+		{`{{"a-b-c" | replace "-" "." | split "." | join ","}}`, "a,b,c"},
+		{`{{"foo" | contains "o"}} {{"foo" | hasPrefix "b"}} {{"foo" | hasSuffix "oo"}}`, "true false true"},
+		{`{{"ab" | repeat 2 | quote}} {{squote "a"}}`, `"abab" 'a'`},
+		{`{{list "b" "a" "b" | uniq | sortAlpha | join " "}}`, "a b"},
+		{`{{list 1 2 3 | first}} {{list 1 2 3 | last}} {{list 1 2 3 | rest}} {{list 1 2 3 | initial}}`, "1 3 [2 3] [1 2]"},
+		{`{{list 1 2 | has 2}} {{append (list 1) 2 3}}`, "true [1 2 3]"},
+		{`{{$d := dict "b" 2 "a" 1}}{{keys $d}} {{values $d}} {{hasKey $d "a"}} {{get $d "b"}}`, "[a b] [1 2] true 2"},
+		{`{{$m := merge (dict "a" 1) (dict "a" 2 "b" 2)}}{{$m.a}}{{$m.b}}`, "12"},
+		{`{{ipAdd 10 "192.168.1.250"}} {{ipAdd -1 "10.0.0.0"}}`, "192.168.2.4 9.255.255.255"},
+		{`{{ipInCidr "10.0.0.0/8" "10.3.3.3"}} {{ipInCidr "10.0.0.0/8" "11.0.0.1"}}`, "true false"},
+		{`{{cidrNetwork "10.1.2.3/22"}} {{cidrBroadcast "10.1.2.3/22"}} {{cidrNetmask "10.1.2.3/22"}} {{cidrPrefix "10.1.2.3/22"}}`,
+			"10.1.0.0 10.1.3.255 255.255.252.0 22"},
+		{`{{cidrHost 1 "10.0.0.0/24"}} {{cidrHost -2 "10.0.0.0/24"}} {{cidrSize "10.0.0.0/24"}}`, "10.0.0.1 10.0.0.254 256"},
+		{`{{"node1.example.com" | shortName}} {{"node1.example.com" | domainName}} {{"Node_1.example.com" | hostName}}`,
+			"node1 example.com node-1"},
+		{`{{"hello" | b64enc}} {{"aGVsbG8=" | b64dec}}`, "aGVsbG8= hello"},
+		{`{{dict "a" (list 1 2) | toJson}}`, `{"a":[1,2]}`},
+		{`{{dict "a" (list 1 2) | toYaml}}`, "a:\n- 1\n- 2"},
+		{`{{"" | default "x"}} {{"y" | default "x"}} {{coalesce "" 0 "z"}} {{empty (list)}}`, "x y z true"},
+		{`{{"hello" | sha256sum}}`, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{`{{crypt "Hello world!" "saltstring"}}`,
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+	}
+	for _, test := range tests {
+		tmpl, err := newTemplate("test").Parse(test.tmpl)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", test.tmpl, err)
+			continue
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, nil); err != nil {
+			t.Errorf("Failed to execute %s: %v", test.tmpl, err)
+		} else if buf.String() != test.expect {
+			t.Errorf("%s: expected %q, got %q", test.tmpl, test.expect, buf.String())
+		}
+	}
+	if pw := tmplCrypt("password"); !strings.HasPrefix(pw, "$6$") || pw == tmplCrypt("password") {
+		t.Errorf("crypt without a salt should use a random one: %s", pw)
+	}
+	for _, tmpl := range []string{`{{ipAdd 1 "bogus"}}`, `{{cidrHost 300 "10.0.0.0/24"}}`, `{{dict "a"}}`} {
+		tm, err := newTemplate("test").Parse(tmpl)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", tmpl, err)
+		} else if err := tm.Execute(&bytes.Buffer{}, nil); err == nil {
+			t.Errorf("%s should have failed", tmpl)
+		}
+	}
+
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "templates", "bootenvs", "tasks", "machines", "profiles", "params")
+	crudTest{"Create Template using funcs", rt.Create, &models.Template{ID: "funcs", Contents: `{{"foo" | upper}}`}, true}.Test(t, rt)
+	crudTest{"Create Template using an unknown func", rt.Create, &models.Template{ID: "nofuncs", Contents: `{{"foo" | nosuchfunc}}`}, false}.Test(t, rt)
+	crudTest{"Create BootEnv using funcs in BootParams", rt.Create, &models.BootEnv{
+		Name:       "funcs",
+		BootParams: `{{.Machine.Name | shortName}}`,
+		Templates:  []models.TemplateInfo{{Name: "funcs", Path: "funcs", ID: "funcs"}},
+	}, true}.Test(t, rt)
+}
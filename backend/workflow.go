@@ -0,0 +1,208 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/backend/index"
+	"github.com/digitalrebar/provision/models"
+	"github.com/digitalrebar/store"
+)
+
+// Workflow is a chain of Stages that Machines move through as the
+// Tasks in each Stage finish.
+//
+// swagger:model
+type Workflow struct {
+	*models.Workflow
+	validate
+}
+
+func (obj *Workflow) SetReadOnly(b bool) {
+	obj.ReadOnly = b
+}
+
+func (obj *Workflow) SaveClean() store.KeySaver {
+	mod := *obj.Workflow
+	mod.ClearValidation()
+	return toBackend(&mod, obj.rt)
+}
+
+func (w *Workflow) HasStage(name string) bool {
+	return w.Find(name) != -1
+}
+
+func (w *Workflow) Indexes() map[string]index.Maker {
+	fix := AsWorkflow
+	res := index.MakeBaseIndexes(w)
+	res["Name"] = index.Make(
+		true,
+		"string",
+		func(i, j models.Model) bool { return fix(i).Name < fix(j).Name },
+		func(ref models.Model) (gte, gt index.Test) {
+			refName := fix(ref).Name
+			return func(s models.Model) bool {
+					return fix(s).Name >= refName
+				},
+				func(s models.Model) bool {
+					return fix(s).Name > refName
+				}
+		},
+		func(s string) (models.Model, error) {
+			wf := fix(w.New())
+			wf.Name = s
+			return wf, nil
+		})
+	return res
+}
+
+func (w *Workflow) New() store.KeySaver {
+	res := &Workflow{Workflow: &models.Workflow{}}
+	if w.Workflow != nil && w.ChangeForced() {
+		res.ForceChange()
+	}
+	res.Stages = []models.WorkflowStage{}
+	res.rt = w.rt
+	return res
+}
+
+func (w *Workflow) Validate() {
+	w.Workflow.Validate()
+	w.AddError(index.CheckUnique(w, w.rt.stores("workflows").Items()))
+	if !w.SetValid() {
+		return
+	}
+	for _, s := range w.Stages {
+		if w.rt.Find("stages", s.Stage) == nil {
+			w.Errorf("Stage %s does not exist", s.Stage)
+		}
+	}
+	w.SetAvailable()
+}
+
+func (w *Workflow) OnLoad() error {
+	defer func() { w.rt = nil }()
+	return w.BeforeSave()
+}
+
+func (w *Workflow) BeforeSave() error {
+	if w.Stages == nil {
+		w.Stages = []models.WorkflowStage{}
+	}
+	w.Validate()
+	if !w.Validated {
+		return w.MakeError(422, ValidationError, w)
+	}
+	return nil
+}
+
+func (w *Workflow) BeforeDelete() error {
+	e := &models.Error{Code: 409, Type: StillInUseError, Model: w.Prefix(), Key: w.Key()}
+	for _, i := range w.rt.stores("machines").Items() {
+		m := AsMachine(i)
+		if m.Workflow == w.Name {
+			e.Errorf("Workflow %s in use by Machine %s", w.Name, m.Name)
+		}
+	}
+	return e.HasError()
+}
+
+func AsWorkflow(o models.Model) *Workflow {
+	return o.(*Workflow)
+}
+
+func AsWorkflows(o []models.Model) []*Workflow {
+	res := make([]*Workflow, len(o))
+	for i := range o {
+		res[i] = AsWorkflow(o[i])
+	}
+	return res
+}
+
+var workflowLockMap = map[string][]string{
+	"get":    []string{"workflows"},
+	"create": []string{"stages", "workflows"},
+	"update": []string{"stages", "workflows"},
+	"patch":  []string{"stages", "workflows"},
+	"delete": []string{"stages", "machines", "workflows"},
+}
+
+func (w *Workflow) Locks(action string) []string {
+	return workflowLockMap[action]
+}
+
+// WorkflowPosition reports where m is in its Workflow.  It returns
+// nil if m is not following a Workflow.
+func (rt *RequestTracker) WorkflowPosition(m *Machine) *models.WorkflowPosition {
+	if m.Workflow == "" {
+		return nil
+	}
+	res := &models.WorkflowPosition{Workflow: m.Workflow, Stage: m.Stage, Index: -1}
+	wo := rt.Find("workflows", m.Workflow)
+	if wo == nil {
+		return res
+	}
+	wf := AsWorkflow(wo)
+	res.Count = len(wf.Stages)
+	res.Index = wf.Find(m.Stage)
+	if res.Index == -1 {
+		return res
+	}
+	res.OnSuccess = wf.Next(m.Stage, true)
+	res.OnFailure = wf.Next(m.Stage, false)
+	if res.OnSuccess != "" {
+		return res
+	}
+	switch {
+	case len(m.Tasks) == 0 || m.CurrentTask >= len(m.Tasks):
+		res.Complete = true
+	case m.CurrentTask == len(m.Tasks)-1 && rt.locked("jobs"):
+		if jo := rt.Find("jobs", m.CurrentJob.String()); jo != nil {
+			res.Complete = AsJob(jo).State == "finished"
+		}
+	}
+	return res
+}
+
+// AdvanceWorkflow moves m to the next Stage of its Workflow once the
+// last Task of its current Stage has finished, or to the failure Stage
+// when a Task has failed.  It returns true if m was moved.  The caller
+// must hold the workflows lock along with the locks needed to update
+// machines.
+func (rt *RequestTracker) AdvanceWorkflow(m *Machine, success bool) (bool, error) {
+	if m.Workflow == "" {
+		return false, nil
+	}
+	if !rt.locked("workflows") {
+		return false, fmt.Errorf("Cannot move Machine %s along Workflow %s without the workflows lock", m.Key(), m.Workflow)
+	}
+	wo := rt.Find("workflows", m.Workflow)
+	if wo == nil || !AsWorkflow(wo).Available {
+		return false, nil
+	}
+	wf := AsWorkflow(wo)
+	if !wf.HasStage(m.Stage) {
+		// The Machine has been moved out of its Workflow by hand.
+		return false, nil
+	}
+	next := wf.Next(m.Stage, success)
+	if next == "" {
+		// Stages without Tasks get here every time the agent asks
+		// for work, so only announce the end of the Workflow once.
+		if success && len(m.Tasks) > 0 {
+			pos := rt.WorkflowPosition(m)
+			pos.Complete = true
+			rt.dt.Publish("machines", "workflow", m.Key(), pos)
+		}
+		return false, nil
+	}
+	nm := AsMachine(toBackend(models.Clone(m.Machine), rt))
+	nm.Stage = next
+	nm.Runnable = true
+	nm.ForceChange()
+	if _, err := rt.Update(nm); err != nil {
+		return false, err
+	}
+	rt.Infof("Machine %s moved from Stage %s to %s by Workflow %s", m.Key(), m.Stage, next, wf.Name)
+	rt.dt.Publish("machines", "workflow", m.Key(), rt.WorkflowPosition(nm))
+	return true, nil
+}
@@ -0,0 +1,188 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+)
+
+func TestWorkflow(t *testing.T) {
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, "stages", "bootenvs", "templates", "tasks", "machines", "profiles", "params", "jobs", "workflows")
+	steps := []models.WorkflowStage{
+		{Stage: "wf-one", OnSuccess: "wf-two", OnFailure: "wf-fixup"},
+		{Stage: "wf-fixup", OnSuccess: "wf-one"},
+		{Stage: "wf-two"},
+	}
+	tests := []crudTest{
+		{"Create wf task", rt.Create, &models.Task{Name: "wf-task"}, true},
+		{"Create wf-one stage", rt.Create, &models.Stage{Name: "wf-one", BootEnv: "local", Tasks: []string{"wf-task"}}, true},
+		{"Create wf-two stage", rt.Create, &models.Stage{Name: "wf-two", BootEnv: "local"}, true},
+		{"Create wf-fixup stage", rt.Create, &models.Stage{Name: "wf-fixup", BootEnv: "local", Tasks: []string{"wf-task"}}, true},
+		{"Create Workflow with no Stages", rt.Create, &models.Workflow{Name: "empty"}, false},
+		{"Create Workflow with duplicate Stages", rt.Create, &models.Workflow{Name: "dup", Stages: []models.WorkflowStage{{Stage: "wf-one"}, {Stage: "wf-one"}}}, false},
+		{"Create Workflow with outside transition", rt.Create, &models.Workflow{Name: "outside", Stages: []models.WorkflowStage{{Stage: "wf-one", OnFailure: "wf-two"}}}, false},
+		{"Create Workflow with missing Stage", rt.Create, &models.Workflow{Name: "missing", Stages: []models.WorkflowStage{{Stage: "nope"}}}, true},
+		{"Create Workflow", rt.Create, &models.Workflow{Name: "wf", Stages: steps}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	rt.Do(func(d Stores) {
+		if wf := AsWorkflow(rt.Find("workflows", "missing")); wf.Available {
+			t.Errorf("Workflow with a missing Stage should not be available")
+		}
+	})
+	machine := &models.Machine{Name: "wf", Uuid: uuid.NewRandom(), Workflow: "wf"}
+	var m *Machine
+	var err error
+	rt.Do(func(d Stores) {
+		if _, err = rt.Create(machine); err != nil {
+			return
+		}
+		m = AsMachine(rt.Find("machines", machine.UUID()))
+	})
+	if err != nil {
+		t.Fatalf("Failed to create machine with a Workflow: %v", err)
+	}
+	if m.Stage != "wf-one" || len(m.Tasks) != 1 {
+		t.Fatalf("Machine should be in the first Stage of its Workflow, not %s with %v", m.Stage, m.Tasks)
+	}
+	// runJob creates a Job for the Machine's only Task and moves it to state.
+	runJob := func(state string) *Machine {
+		t.Helper()
+		rt.Do(func(d Stores) {
+			m = AsMachine(rt.Find("machines", machine.UUID()))
+			job := &Job{}
+			Fill(job)
+			job.Uuid = uuid.NewRandom()
+			job.Previous = uuid.Parse("00000000-0000-0000-0000-000000000000")
+			job.Machine = m.Uuid
+			job.Stage = m.Stage
+			job.Task = m.Tasks[0]
+			job.State = "created"
+			if _, err := rt.Create(job); err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			m.CurrentTask = 0
+			m.CurrentJob = job.Uuid
+			if _, err := rt.Save(m); err != nil {
+				t.Errorf("Failed to save machine: %v", err)
+				return
+			}
+			job = AsJob(rt.Find("jobs", job.Key()))
+			nj := AsJob(job.New())
+			nj.Job = models.Clone(job.Job).(*models.Job)
+			nj.State = state
+			if _, err := rt.Update(nj); err != nil {
+				t.Errorf("Failed to move job to %s: %v", state, err)
+			}
+			m = AsMachine(rt.Find("machines", machine.UUID()))
+		})
+		return m
+	}
+	if m = runJob("failed"); m.Stage != "wf-fixup" || !m.Runnable {
+		t.Errorf("Failed job should have moved the Machine to wf-fixup, not %s (runnable %v)", m.Stage, m.Runnable)
+	}
+	if m = runJob("finished"); m.Stage != "wf-one" || m.CurrentTask != -1 {
+		t.Errorf("Finished job should have moved the Machine back to wf-one, not %s", m.Stage)
+	}
+	if m = runJob("finished"); m.Stage != "wf-two" {
+		t.Errorf("Finished job should have moved the Machine to wf-two, not %s", m.Stage)
+	}
+	rt.Do(func(d Stores) {
+		pos := rt.WorkflowPosition(m)
+		if pos == nil || pos.Index != 2 || pos.Count != 3 || !pos.Complete {
+			t.Errorf("Unexpected Workflow position: %#v", pos)
+		}
+		if moved, err := rt.AdvanceWorkflow(m, true); moved || err != nil {
+			t.Errorf("Machine at the end of its Workflow should not move: %v", err)
+		}
+	})
+	nrt := dt.Request(dt.Logger, stageLockMap["update"]...)
+	nrt.Do(func(d Stores) {
+		if _, err := nrt.AdvanceWorkflow(m, true); err == nil {
+			t.Errorf("Moving a Machine along its Workflow without the workflows lock should fail")
+		}
+	})
+	rmTests := []crudTest{
+		{"Remove Stage that is in a Workflow", rt.Remove, &models.Stage{Name: "wf-fixup"}, false},
+		{"Remove Workflow that is in use", rt.Remove, &models.Workflow{Name: "wf"}, false},
+		{"Remove Workflow that is not in use", rt.Remove, &models.Workflow{Name: "missing"}, true},
+	}
+	for _, test := range rmTests {
+		test.Test(t, rt)
+	}
+}
+
+func TestWorkflowTaskDeps(t *testing.T) {
+	// Everything that can finish a Job has to be able to move its
+	// Machine along a Workflow.
+	for _, locks := range [][]string{jobLockMap["create"], jobLockMap["update"], jobLockMap["patch"], rolloutLockMap["update"]} {
+		found := false
+		for _, l := range locks {
+			found = found || l == "workflows"
+		}
+		if !found {
+			t.Errorf("Locks %v can finish a Job without the workflows lock", locks)
+		}
+	}
+	dt := mkDT(nil)
+	rt := dt.Request(dt.Logger, jobLockMap["update"]...)
+	tests := []crudTest{
+		{"Create wfdag-a", rt.Create, &models.Task{Name: "wfdag-a"}, true},
+		{"Create wfdag-b", rt.Create, &models.Task{Name: "wfdag-b"}, true},
+		{"Create wfdag stage", rt.Create, &models.Stage{Name: "wfdag", BootEnv: "local", Tasks: []string{"wfdag-a", "wfdag-b"}, TaskDeps: map[string][]string{"wfdag-b": {}}}, true},
+		{"Create wfdag-fixup stage", rt.Create, &models.Stage{Name: "wfdag-fixup", BootEnv: "local"}, true},
+		{"Create wfdag Workflow", rt.Create, &models.Workflow{Name: "wfdag", Stages: []models.WorkflowStage{{Stage: "wfdag", OnFailure: "wfdag-fixup"}, {Stage: "wfdag-fixup"}}}, true},
+	}
+	for _, test := range tests {
+		test.Test(t, rt)
+	}
+	machine := &models.Machine{Name: "wfdag", Uuid: uuid.NewRandom(), Workflow: "wfdag"}
+	jobs := map[string]*Job{}
+	rt.Do(func(d Stores) {
+		if _, err := rt.Create(machine); err != nil {
+			t.Errorf("Failed to create machine: %v", err)
+			return
+		}
+		for i := 0; i < 2; i++ {
+			m := AsMachine(rt.Find("machines", machine.UUID()))
+			j := &Job{}
+			Fill(j)
+			j.Uuid = uuid.NewRandom()
+			j.Machine = m.Uuid
+			if created, err := rt.NextParallelJob(m, j); !created || err != nil {
+				t.Errorf("Failed to create job: %v", err)
+				return
+			}
+			jobs[j.Task] = j
+		}
+	})
+	if len(jobs) != 2 {
+		t.Fatalf("wfdag-a and wfdag-b should start together, not %d jobs", len(jobs))
+	}
+	// move sets the Job for task to state and returns the Machine.
+	move := func(task, state string) *Machine {
+		t.Helper()
+		var m *Machine
+		rt.Do(func(d Stores) {
+			nj := AsJob(jobs[task].New())
+			nj.Job = models.Clone(AsJob(rt.Find("jobs", jobs[task].Key())).Job).(*models.Job)
+			nj.State = state
+			if _, err := rt.Update(nj); err != nil {
+				t.Errorf("Failed to move job for %s to %s: %v", task, state, err)
+			}
+			m = AsMachine(rt.Find("machines", machine.UUID()))
+		})
+		return m
+	}
+	if m := move("wfdag-a", "failed"); m.Stage != "wfdag" {
+		t.Errorf("Machine should stay in wfdag while wfdag-b runs, not move to %s", m.Stage)
+	}
+	if m := move("wfdag-b", "finished"); m.Stage != "wfdag-fixup" {
+		t.Errorf("Machine should move to wfdag-fixup once wfdag-b finishes, not %s", m.Stage)
+	}
+}
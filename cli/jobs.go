@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
 	"github.com/spf13/cobra"
 )
 
@@ -74,6 +75,85 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 		},
 	})
 	op.addCommand(&cobra.Command{
+		Use:   "artifact [id] [name] [- or file]",
+		Short: "Gets an artifact of the job, or stores it if a file or stream is given",
+		Long: `With two arguments, write the named artifact of the job to stdout.
+With three, store the file (or stdin for '-') as the named artifact of
+the running job, replacing any artifact with the same name.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("%v requires at least 2 arguments", c.UseLine())
+			}
+			if len(args) > 3 {
+				return fmt.Errorf("%v requires at most 3 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			job := &models.Job{Uuid: uuid.Parse(args[0])}
+			if len(args) == 2 {
+				if err := session.JobArtifact(job, args[1], os.Stdout); err != nil {
+					return generateError(err, "Error getting artifact")
+				}
+				return nil
+			}
+			var src io.Reader
+			if args[2] == "-" {
+				src = os.Stdin
+			} else {
+				f, err := os.Open(args[2])
+				if err != nil {
+					return fmt.Errorf("Unable to open %s: %v", args[2], err)
+				}
+				defer f.Close()
+				src = f
+			}
+			res, err := session.PutJobArtifact(job, args[1], src, "")
+			if err != nil {
+				return generateError(err, "Error storing artifact")
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "artifacts [id]",
+		Short: "List the artifacts of the job",
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res, err := session.JobArtifacts(&models.Job{Uuid: uuid.Parse(args[0])})
+			if err != nil {
+				return generateError(err, "Error listing artifacts")
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "cancel [id]",
+		Short: "Cancel the job",
+		Long: `Move the job to the cancelled state and mark its machine as not runnable.
+The machine agent running the job kills whatever it is running and stops.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			uuid := args[0]
+			res := &models.Job{}
+			if err := session.Req().Post(nil).UrlFor("jobs", uuid, "cancel").Do(res); err != nil {
+				return generateError(err, "Failed to cancel %v: %v", op.singleName, uuid)
+			}
+			return prettyPrint(res)
+		},
+	})
+	var followLog bool
+	logCmd := &cobra.Command{
 		Use:   "log [id] [- or string]",
 		Short: "Gets the log or appends to the log if a second argument or stream is given",
 		Args: func(c *cobra.Command, args []string) error {
@@ -88,7 +168,11 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 		RunE: func(c *cobra.Command, args []string) error {
 			uuid := args[0]
 			if len(args) == 1 {
-				if err := session.Req().UrlFor("jobs", uuid, "log").Do(os.Stdout); err != nil {
+				req := session.Req().UrlFor("jobs", uuid, "log")
+				if followLog {
+					req = req.Params("follow", "true")
+				}
+				if err := req.Do(os.Stdout); err != nil {
 					return generateError(err, "Error getting log")
 				}
 				return nil
@@ -104,6 +188,49 @@ You may also pass in a machine UUID or Name to create a new job on that Name.
 			}
 			return nil
 		},
+	}
+	logCmd.Flags().BoolVar(&followLog, "follow", false, "Keep printing the log as it is written until the job stops running")
+	op.addCommand(logCmd)
+	op.addCommand(&cobra.Command{
+		Use:   "report",
+		Short: "Report the jobs that will be pruned",
+		Long: `Lists the jobs that the jobRetentionCount, jobRetentionAge, and
+jobRetentionFailedAge preferences say should be removed.`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			res := []*models.JobPrune{}
+			if err := session.Req().UrlFor("reports", "jobs").Do(&res); err != nil {
+				return generateError(err, "Failed to fetch job prune report")
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "results [id] [json]",
+		Short: "Add results to the job",
+		Long: `Merge the passed-in JSON object into the Results of the running job.
+Results named in the ResultParams of the job's task are also set as
+params on its machine.
+
+As a useful shortcut, '-' can be passed to indicate that the JSON should
+be read from stdin.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("%v requires 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			results := map[string]interface{}{}
+			if err := into(args[1], &results); err != nil {
+				return generateError(err, "Invalid results")
+			}
+			res := &models.Job{Uuid: uuid.Parse(args[0])}
+			if err := session.AddJobResults(res, results); err != nil {
+				return generateError(err, "Failed to add results to %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
 	})
 	op.command(app)
 }
@@ -2,8 +2,12 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/digitalrebar/provision/api"
 	"github.com/digitalrebar/provision/models"
@@ -49,6 +53,264 @@ func registerMachine(app *cobra.Command) {
 			return prettyPrint(clone)
 		},
 	})
+	op.addCommand(&cobra.Command{
+		Use:   "workflow [id] [workflow]",
+		Short: fmt.Sprintf("Gets/sets the machine's workflow"),
+		Long: `Helper function to show where the machine is in its workflow, or
+to assign the machine a new workflow.  Assigning a workflow moves the
+machine to the first stage of the workflow.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 && len(args) != 2 {
+				return fmt.Errorf("%v requires 1 or 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			if len(args) == 1 {
+				res := &models.WorkflowPosition{}
+				if err := session.Req().UrlFor(op.name, m.Key(), "workflow").Do(res); err != nil {
+					return generateError(err, "Failed to fetch workflow for %v: %v", op.singleName, args[0])
+				}
+				return prettyPrint(res)
+			}
+			clone := models.Clone(m).(*models.Machine)
+			clone.Workflow = args[1]
+			req := session.Req().ParanoidPatch().PatchTo(m, clone)
+			if force {
+				req.Params("force", "true")
+			}
+			if err := req.Do(&clone); err != nil {
+				return err
+			}
+			return prettyPrint(clone)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "state [id] [state]",
+		Short: fmt.Sprintf("Gets/sets the machine's lifecycle state"),
+		Long: `Helper function to show the lifecycle state of the machine, or to move
+the machine to a new state.  Changes of state that are not normally
+allowed require --force.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 && len(args) != 2 {
+				return fmt.Errorf("%v requires 1 or 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			if len(args) == 1 {
+				return prettyPrint(m.(*models.Machine).State)
+			}
+			clone := models.Clone(m).(*models.Machine)
+			clone.State = args[1]
+			req := session.Req().ParanoidPatch().PatchTo(m, clone)
+			if force {
+				req.Params("force", "true")
+			}
+			if err := req.Do(&clone); err != nil {
+				return err
+			}
+			return prettyPrint(clone)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "inventory [id] [- | JSON or YAML Inventory]",
+		Short: fmt.Sprintf("Gets/sets the machine's hardware inventory"),
+		Long: `Helper function to show the most recent hardware inventory of the
+machine, or to submit a new one.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 && len(args) != 2 {
+				return fmt.Errorf("%v requires 1 or 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := &models.Inventory{}
+			req := session.Req().UrlFor(op.name, m.Key(), "inventory")
+			if len(args) == 2 {
+				if err := into(args[1], res); err != nil {
+					return fmt.Errorf("Unable to unmarshal input stream: %v\n", err)
+				}
+				req = req.Post(res)
+			}
+			if err := req.Do(res); err != nil {
+				return generateError(err, "Failed to process inventory for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "inventoryhistory [id]",
+		Short: fmt.Sprintf("Show the machine's hardware inventory history"),
+		Long:  `Helper function to show every distinct hardware inventory the machine has reported.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := []*models.Inventory{}
+			if err := session.Req().UrlFor(op.name, m.Key(), "inventory", "history").Do(&res); err != nil {
+				return generateError(err, "Failed to fetch inventory history for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "leases [id]",
+		Short: fmt.Sprintf("Show the leases handed out to the machine's MACs"),
+		Long:  `Helper function to show the DHCP leases handed out to the MACs of the machine.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := []*models.Lease{}
+			if err := session.Req().UrlFor(op.name, m.Key(), "leases").Do(&res); err != nil {
+				return generateError(err, "Failed to fetch leases for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "reservations [id]",
+		Short: fmt.Sprintf("Show the reservations for the machine's MACs"),
+		Long:  `Helper function to show the DHCP reservations for the MACs of the machine.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := []*models.Reservation{}
+			if err := session.Req().UrlFor(op.name, m.Key(), "reservations").Do(&res); err != nil {
+				return generateError(err, "Failed to fetch reservations for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "reserve [id]",
+		Short: fmt.Sprintf("Reserve the addresses of the machine's interfaces"),
+		Long: `Helper function to create a MAC reservation for each interface of the
+machine that has an address.  Reservations that already exist are left alone.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			m, err := op.refOrFill(args[0])
+			if err != nil {
+				return generateError(err, "Failed to fetch %v: %v", op.singleName, args[0])
+			}
+			res := []*models.Reservation{}
+			if err := session.Req().Post(nil).UrlFor(op.name, m.Key(), "reservations").Do(&res); err != nil {
+				return generateError(err, "Failed to reserve addresses for %v: %v", op.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	op.addCommand(&cobra.Command{
+		Use:   "whoami [- | JSON or YAML Fingerprint]",
+		Short: fmt.Sprintf("Find the machine that matches a fingerprint"),
+		Long: `Helper function to find the machine whose fingerprint best matches the
+passed one.  If no fingerprint is passed, one is built from the DMI
+information and network interfaces of the system drpcli is running on.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("%v requires 0 or 1 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			fp := localFingerprint()
+			if len(args) == 1 {
+				fp = &models.MachineFingerprint{}
+				if err := into(args[0], fp); err != nil {
+					return fmt.Errorf("Unable to unmarshal input stream: %v\n", err)
+				}
+			}
+			res := &models.Machine{}
+			if err := session.Req().Post(fp).UrlFor("whoami").Do(res); err != nil {
+				return generateError(err, "Failed to find a %v matching the fingerprint", op.singleName)
+			}
+			return prettyPrint(res)
+		},
+	})
+	bulkDryRun := false
+	bulk := &cobra.Command{
+		Use:   "bulk [- | JSON or YAML change] [filter...]",
+		Short: "Change every machine that matches the filters",
+		Long: `Helper function to apply a change to every machine that matches the
+filters in one request.  The change can have a JSON Patch, a Stage,
+AddProfiles, RemoveProfiles, and Params to set.  Filters are given as
+Key=Value pairs, such as Stage=Eq(discover), and are added to the
+Filter of the change.  The result for each machine says whether the
+change worked for it.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("%v requires at least 1 argument", c.UseLine())
+			}
+			for _, arg := range args[1:] {
+				if !strings.Contains(arg, "=") {
+					return fmt.Errorf("Filter %s is not of the form Key=Value", arg)
+				}
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			req := &models.BulkMachineRequest{}
+			if err := into(args[0], req); err != nil {
+				return fmt.Errorf("Unable to unmarshal input stream: %v\n", err)
+			}
+			if req.Filter == nil {
+				req.Filter = map[string]string{}
+			}
+			for _, arg := range args[1:] {
+				kv := strings.SplitN(arg, "=", 2)
+				req.Filter[kv[0]] = kv[1]
+			}
+			req.DryRun = req.DryRun || bulkDryRun
+			req.Force = req.Force || force
+			res := []*models.BulkMachineResult{}
+			if err := session.Req().Post(req).UrlFor("bulk", op.name).Do(&res); err != nil {
+				return generateError(err, "Failed to change %v", op.name)
+			}
+			return prettyPrint(res)
+		},
+	}
+	bulk.Flags().BoolVar(&bulkDryRun, "dry-run", false, "Check the change against each machine without saving it")
+	op.addCommand(bulk)
 	tasks := &cobra.Command{
 		Use:   "tasks",
 		Short: "Access task manipulation for machines",
@@ -201,6 +463,7 @@ pass in more than one task.`,
 		},
 	})
 	var exitOnFailure = false
+	var signingKey = ""
 	processJobs := &cobra.Command{
 		Use:   "processjobs [id]",
 		Short: "For the given machine, process pending jobs until done.",
@@ -222,11 +485,36 @@ the stage runner wait flag.
 			if err := session.FillModel(m, uuid); err != nil {
 				return err
 			}
+			if err := session.PinJobSigningKey(signingKey); err != nil {
+				return err
+			}
 
 			return session.Agent(m, false, exitOnFailure, actuallyPowerThings, os.Stdout)
 		},
 	}
 	processJobs.Flags().BoolVar(&exitOnFailure, "exit-on-failure", false, "Exit on failure of a task")
+	processJobs.Flags().StringVar(&signingKey, "signing-key", "", "Only run actions signed by this job signing key")
 	op.addCommand(processJobs)
 	op.command(app)
 }
+
+// localFingerprint builds a fingerprint for the system drpcli is
+// running on.
+func localFingerprint() *models.MachineFingerprint {
+	dmi := func(name string) string {
+		buf, _ := ioutil.ReadFile(filepath.Join("/sys/class/dmi/id", name))
+		return strings.TrimSpace(string(buf))
+	}
+	res := &models.MachineFingerprint{
+		SystemUUID:   dmi("product_uuid"),
+		SerialNumber: dmi("product_serial"),
+		MACs:         []string{},
+	}
+	ifs, _ := net.Interfaces()
+	for _, intf := range ifs {
+		if intf.Flags&net.FlagLoopback == 0 && len(intf.HardwareAddr) > 0 {
+			res.MACs = append(res.MACs, intf.HardwareAddr.String())
+		}
+	}
+	return res
+}
@@ -408,6 +408,25 @@ func (o *ops) params() {
 		},
 	}
 	getParams.Flags().BoolVar(&aggregate, "aggregate", false, "Should machine return aggregated view")
+	getParams.AddCommand(&cobra.Command{
+		Use:   "explain [id]",
+		Short: fmt.Sprintf("Explain where each parameter of the %s comes from", o.singleName),
+		Long: fmt.Sprintf(`A helper function to show, for each parameter of the %s, the effective value,
+the layer it comes from, and the values from lower layers that it shadows.`, o.singleName),
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			res := map[string]*models.ParamExplanation{}
+			if err := session.Req().UrlFor(o.name, args[0], "params").Params("explain", "true").Do(&res); err != nil {
+				return generateError(err, "Failed to explain params %v: %v", o.singleName, args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
 	o.addCommand(getParams)
 	getParam := &cobra.Command{
 		Use:   "get [id] param [key]",
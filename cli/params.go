@@ -15,5 +15,18 @@ func registerParam(app *cobra.Command) {
 		singleName: "param",
 		example:    func() models.Model { return &models.Param{} },
 	}
+	op.addCommand(&cobra.Command{
+		Use:   "report",
+		Short: "Report param values that do not match their schema",
+		Long:  `Revalidates every param value on every machine, profile, and plugin against the schema of its param.`,
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			res := []*models.ParamError{}
+			if err := session.Req().UrlFor("reports", "params").Do(&res); err != nil {
+				return generateError(err, "Failed to fetch param report")
+			}
+			return prettyPrint(res)
+		},
+	})
 	op.command(app)
 }
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/pborman/uuid"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerPool)
+}
+
+func registerPool(app *cobra.Command) {
+	tree := addPoolCommands()
+	app.AddCommand(tree)
+}
+
+func addPoolCommands() (res *cobra.Command) {
+	name := "pools"
+	res = &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Access CLI commands relating to %v", name),
+	}
+	res.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List all pools",
+		Long:  `Summarize every pool that has machines in it.`,
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			pools := []*models.PoolStatus{}
+			if err := session.Req().UrlFor("pools").Do(&pools); err != nil {
+				return generateError(err, "Failed to list pools")
+			}
+			return prettyPrint(pools)
+		},
+	})
+	res.AddCommand(&cobra.Command{
+		Use:   "show [name]",
+		Short: "Show a single pool by name",
+		Long:  `Summarize the pool and list the machines in it.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("%v requires 1 argument", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			pool := &models.PoolStatus{}
+			if err := session.Req().UrlFor("pools", args[0]).Do(pool); err != nil {
+				return generateError(err, "Failed to fetch pool: %v", args[0])
+			}
+			return prettyPrint(pool)
+		},
+	})
+	res.AddCommand(&cobra.Command{
+		Use:   "claim [name] [- | JSON or YAML claim]",
+		Short: "Claim machines from a pool",
+		Long: `Claim Count ready machines that match Filter from the pool for Owner.
+The machines stay claimed for Duration seconds, or until they are
+released.  Either all of the machines are claimed or none are.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("%v requires 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			claim := &models.PoolClaim{}
+			if err := into(args[1], claim); err != nil {
+				return fmt.Errorf("Unable to unmarshal input stream: %v\n", err)
+			}
+			res := []*models.Machine{}
+			if err := session.Req().Post(claim).UrlFor("pools", args[0], "claim").Do(&res); err != nil {
+				return generateError(err, "Failed to claim machines from pool: %v", args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	res.AddCommand(&cobra.Command{
+		Use:   "release [name] [owner] [machine uuids...]",
+		Short: "Release claimed machines back to a pool",
+		Long: `Release the listed machines claimed by owner back to the pool, or all
+of the ones owner has claimed from it if none are listed.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("%v requires at least 2 arguments", c.UseLine())
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			release := &models.PoolRelease{Owner: args[1]}
+			for _, id := range args[2:] {
+				u := uuid.Parse(id)
+				if u == nil {
+					return fmt.Errorf("%s is not a valid UUID", id)
+				}
+				release.Machines = append(release.Machines, u)
+			}
+			res := []*models.Machine{}
+			if err := session.Req().Post(release).UrlFor("pools", args[0], "release").Do(&res); err != nil {
+				return generateError(err, "Failed to release machines to pool: %v", args[0])
+			}
+			return prettyPrint(res)
+		},
+	})
+	return res
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/digitalrebar/provision/models"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addRegistrar(registerRollout)
+}
+
+func registerRollout(app *cobra.Command) {
+	op := &ops{
+		name:       "rollouts",
+		singleName: "rollout",
+		example:    func() models.Model { return &models.Rollout{} },
+	}
+	for _, action := range []struct{ verb, short, long string }{
+		{"pause", "Pause the rollout", `Stop the rollout from moving any more machines.  Machines it has
+already moved keep running.`},
+		{"resume", "Resume the rollout", `Start a paused rollout moving machines again.  Its count of failed
+machines starts over at zero.`},
+		{"abort", "Abort the rollout", `Stop the rollout for good.  Machines it has already moved are left
+where they are.`},
+	} {
+		verb := action.verb
+		op.addCommand(&cobra.Command{
+			Use:   fmt.Sprintf("%s [name]", verb),
+			Short: action.short,
+			Long:  action.long,
+			Args: func(c *cobra.Command, args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("%v requires 1 argument", c.UseLine())
+				}
+				return nil
+			},
+			RunE: func(c *cobra.Command, args []string) error {
+				res := &models.Rollout{}
+				if err := session.Req().Post(nil).UrlFor(op.name, args[0], verb).Do(res); err != nil {
+					return generateError(err, "Failed to %v %v: %v", verb, op.singleName, args[0])
+				}
+				return prettyPrint(res)
+			},
+		})
+	}
+	op.command(app)
+}
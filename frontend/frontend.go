@@ -42,6 +42,31 @@ type Sanitizable interface {
 	Sanitize() models.Model
 }
 
+// secureReveal returns a function that tests whether claim allows
+// the plaintext values of the named secure params to be seen.
+func secureReveal(claim interface{}) func(string) bool {
+	drpClaim, ok := claim.(*backend.DrpCustomClaims)
+	return func(key string) bool {
+		return ok && drpClaim.Match("params", "getSecure", key)
+	}
+}
+
+// redact hides the values of secure params in m from callers that
+// lack the params:getSecure claim for them.  m must be a copy.
+func (f *Frontend) redact(c *gin.Context, m models.Model) models.Model {
+	claim, _ := c.Get("DRP-CLAIM")
+	return f.dt.Redact(f.dt.WithHeartbeat(m), secureReveal(claim))
+}
+
+func (f *Frontend) redactParams(c *gin.Context, params map[string]interface{}) map[string]interface{} {
+	claim, _ := c.Get("DRP-CLAIM")
+	return f.dt.RedactParams(params, secureReveal(claim))
+}
+
+func (f *Frontend) redactParam(c *gin.Context, key string, val interface{}) interface{} {
+	return f.redactParams(c, map[string]interface{}{key: val})[key]
+}
+
 type Lockable interface {
 	Locks(string) []string
 }
@@ -139,15 +164,35 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				return
 			}
 			var params map[string]interface{}
+			var explained map[string]*models.ParamExplanation
 			var found bool
+			explain := c.Query("explain") == "true"
 			rt.Do(func(d backend.Stores) {
 				ob := rt.Find(obj.Prefix(), id)
-				if ob != nil {
-					params, found = rt.GetParams(ob.(models.Paramer), aggregator(c)), true
+				if ob == nil {
+					return
+				}
+				found = true
+				if explain {
+					explained = rt.ExplainParams(ob.(models.Paramer))
+				} else {
+					params = rt.GetParams(ob.(models.Paramer), aggregator(c))
 				}
 			})
-			if !item404(c, found, id, "Params") {
-				c.JSON(http.StatusOK, params)
+			if item404(c, found, id, "Params") {
+				return
+			}
+			if explain {
+				for k, e := range explained {
+					e.Value = f.redactParam(c, k, e.Value)
+					e.Source.Value = f.redactParam(c, k, e.Source.Value)
+					for _, src := range e.Shadowed {
+						src.Value = f.redactParam(c, k, src.Value)
+					}
+				}
+				c.JSON(http.StatusOK, explained)
+			} else {
+				c.JSON(http.StatusOK, f.redactParams(c, params))
 			}
 		},
 		/* getOne */ func(c *gin.Context) {
@@ -165,7 +210,7 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				}
 			})
 			if !item404(c, found, id, "Param") {
-				c.JSON(http.StatusOK, val)
+				c.JSON(http.StatusOK, f.redactParam(c, key, val))
 			}
 		},
 		/* patchThem */ func(c *gin.Context) {
@@ -214,14 +259,20 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 					patchErr.AddError(err)
 				}
 				if !patchErr.ContainsError() {
-					patchErr.AddError(rt.SetParams(ob.(models.Paramer), res))
+					if err := rt.SetParams(ob.(models.Paramer), res); err != nil {
+						// Schema violations come back as a 422
+						if me, ok := err.(*models.Error); ok {
+							patchErr.Code = me.Code
+						}
+						patchErr.AddError(err)
+					}
 				}
 			})
 			if !item404(c, found, id, "Params") {
 				if patchErr.ContainsError() {
 					c.JSON(patchErr.Code, patchErr)
 				} else {
-					c.JSON(http.StatusOK, res)
+					c.JSON(http.StatusOK, f.redactParams(c, res))
 				}
 			}
 		},
@@ -248,7 +299,7 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				if err != nil {
 					c.JSON(err.(*models.Error).Code, err)
 				} else {
-					c.JSON(http.StatusOK, replacement)
+					c.JSON(http.StatusOK, f.redactParams(c, replacement))
 				}
 			}
 		},
@@ -275,7 +326,7 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				if err != nil {
 					c.JSON(err.(*models.Error).Code, err)
 				} else {
-					c.JSON(http.StatusOK, replacement)
+					c.JSON(http.StatusOK, f.redactParam(c, key, replacement))
 				}
 			}
 		},
@@ -299,7 +350,7 @@ func (f *Frontend) makeParamEndpoints(obj models.Paramer, idKey string) (
 				if err != nil {
 					c.JSON(err.(*models.Error).Code, err)
 				} else {
-					c.JSON(http.StatusOK, val)
+					c.JSON(http.StatusOK, f.redactParam(c, key, val))
 				}
 			}
 		}
@@ -484,10 +535,13 @@ func NewFrontend(
 	me.InitWebSocket()
 	me.InitBootEnvApi()
 	me.InitStageApi()
+	me.InitWorkflowApi()
 	me.InitIsoApi()
 	me.InitFileApi()
 	me.InitTemplateApi()
 	me.InitMachineApi()
+	me.InitPoolApi()
+	me.InitRolloutApi()
 	me.InitProfileApi()
 	me.InitLeaseApi()
 	me.InitReservationApi()
@@ -656,53 +710,6 @@ func assureDecode(c *gin.Context, val interface{}) bool {
 	return false
 }
 
-// This processes the value into a function, if function not specifed, assume Eq.
-// Supported Forms:
-//
-//   Eq(value)
-//   Lt(value)
-//   Lte(value)
-//   Gt(value)
-//   Gte(value)
-//   Ne(value)
-//   Between(valueLower, valueHigher)
-//   Except(valueLower, valueHigher)
-//
-func convertValueToFilter(v string) (index.Filter, error) {
-	args := strings.SplitN(v, "(", 2)
-	switch args[0] {
-	case "Eq":
-		subargs := strings.SplitN(args[1], ")", 2)
-		return index.Eq(subargs[0]), nil
-	case "Lt":
-		subargs := strings.SplitN(args[1], ")", 2)
-		return index.Lt(subargs[0]), nil
-	case "Lte":
-		subargs := strings.SplitN(args[1], ")", 2)
-		return index.Lte(subargs[0]), nil
-	case "Gt":
-		subargs := strings.SplitN(args[1], ")", 2)
-		return index.Gt(subargs[0]), nil
-	case "Gte":
-		subargs := strings.SplitN(args[1], ")", 2)
-		return index.Gte(subargs[0]), nil
-	case "Ne":
-		subargs := strings.SplitN(args[1], ")", 2)
-		return index.Ne(subargs[0]), nil
-	case "Between":
-		subargs := strings.SplitN(args[1], ")", 2)
-		parts := strings.Split(subargs[0], ",")
-		return index.Between(parts[0], parts[1]), nil
-	case "Except":
-		subargs := strings.SplitN(args[1], ")", 2)
-		parts := strings.Split(subargs[0], ",")
-		return index.Except(parts[0], parts[1]), nil
-	default:
-		return index.Eq(v), nil
-	}
-	return nil, fmt.Errorf("Should never get here")
-}
-
 type dynParameter interface {
 	ParameterMaker(*backend.RequestTracker, string) (index.Maker, error)
 }
@@ -737,7 +744,7 @@ func (f *Frontend) processFilters(rt *backend.RequestTracker, d backend.Stores,
 			filters = append(filters, index.Sort(maker))
 			subfilters := []index.Filter{}
 			for _, v := range vs {
-				f, err := convertValueToFilter(v)
+				f, err := index.ParseFilter(v)
 				if err != nil {
 					return nil, err
 				}
@@ -836,14 +843,15 @@ func (f *Frontend) list(c *gin.Context, ref store.KeySaver, statsOnly bool) {
 		items := idx.Items()
 		for i, item := range items {
 			arr = append(arr, models.Clone(item))
-			f, ok := arr[i].(models.Filler)
+			fl, ok := arr[i].(models.Filler)
 			if ok {
-				f.Fill()
+				fl.Fill()
 			}
 			s, ok := arr[i].(Sanitizable)
 			if ok {
 				arr[i] = s.Sanitize()
 			}
+			arr[i] = f.redact(c, arr[i])
 		}
 	})
 
@@ -944,6 +952,7 @@ func (f *Frontend) Fetch(c *gin.Context, ref store.KeySaver, key string) {
 		if ok {
 			res = s.Sanitize()
 		}
+		res = f.redact(c, res)
 		c.JSON(http.StatusOK, res)
 	} else {
 		rerr := &models.Error{
@@ -984,6 +993,7 @@ func (f *Frontend) Create(c *gin.Context, val store.KeySaver) {
 		if ok {
 			res = s.Sanitize()
 		}
+		res = f.redact(c, res)
 		c.JSON(http.StatusCreated, res)
 	}
 }
@@ -1020,6 +1030,7 @@ func (f *Frontend) Patch(c *gin.Context, ref store.KeySaver, key string) {
 		if ok {
 			res = s.Sanitize()
 		}
+		res = f.redact(c, res)
 		c.JSON(http.StatusOK, res)
 		return
 	}
@@ -1064,6 +1075,7 @@ func (f *Frontend) Update(c *gin.Context, ref store.KeySaver, key string) {
 		if ok {
 			res = s.Sanitize()
 		}
+		res = f.redact(c, res)
 		c.JSON(http.StatusOK, res)
 		return
 	}
@@ -1107,6 +1119,7 @@ func (f *Frontend) Remove(c *gin.Context, ref store.KeySaver, key string) {
 		if ok {
 			res = s.Sanitize()
 		}
+		res = f.redact(c, models.Clone(res))
 		c.JSON(http.StatusOK, res)
 	}
 }
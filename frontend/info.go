@@ -67,6 +67,12 @@ func (f *Frontend) GetInfo(c *gin.Context, drpid string) (*models.Info, *models.
 		}
 	})
 
+	hits, misses, entries := f.dt.RenderCacheStats()
+	i.Stats = append(i.Stats,
+		&models.Stat{"render.cache.hits", hits},
+		&models.Stat{"render.cache.misses", misses},
+		&models.Stat{"render.cache.entries", entries})
+
 	if res.HasError() == nil {
 		res = nil
 	}
@@ -3,6 +3,7 @@ package frontend
 import (
 	"fmt"
 	"net/http"
+	"path/filepath"
 
 	"github.com/VictorLowther/jsonpatch2"
 	"github.com/digitalrebar/provision/backend"
@@ -27,6 +28,14 @@ type JobsResponse struct {
 	Body []*models.Job
 }
 
+// JobPruneReportResponse returned on a successful GET of the job
+// prune report
+// swagger:response
+type JobPruneReportResponse struct {
+	// in: body
+	Body []*models.JobPrune
+}
+
 // JobActionsResponse return on a successful GET of a Job's actions
 // swagger:response
 type JobActionsResponse struct {
@@ -71,6 +80,14 @@ type JobPatchBodyParameter struct {
 	Body jsonpatch2.Patch
 }
 
+// JobLogQueryParameter used to follow a Job log
+// swagger:parameters getJobLog
+type JobLogQueryParameter struct {
+	// Keep streaming the log as it is written
+	// in: query
+	Follow string `json:"follow"`
+}
+
 // JobLogBodyParameter used to append to a Job log
 // swagger:parameters putJobLog
 type JobLogPutBodyParameter struct {
@@ -80,7 +97,7 @@ type JobLogPutBodyParameter struct {
 }
 
 // JobPathParameter used to find a Job in the path
-// swagger:parameters putJobs getJob putJob patchJob deleteJob getJobParams postJobParams getJobActions getJobLog putJobLog headJob
+// swagger:parameters putJobs getJob putJob patchJob deleteJob getJobParams postJobParams getJobActions getJobLog putJobLog headJob cancelJob postJobResults listJobArtifacts getJobArtifact putJobArtifact
 type JobPathParameter struct {
 	// in: path
 	// required: true
@@ -96,6 +113,55 @@ type JobParamsBodyParameter struct {
 	Body map[string]interface{}
 }
 
+// JobResultsBodyParameter used to add to the Results of a Job
+// swagger:parameters postJobResults
+type JobResultsBodyParameter struct {
+	// in: body
+	// required: true
+	Body map[string]interface{}
+}
+
+// JobArtifactsResponse is returned by a successful GET of the artifacts of a Job
+// swagger:response
+type JobArtifactsResponse struct {
+	// in: body
+	Body []models.JobArtifact
+}
+
+// JobArtifactDataResponse is returned by a successful GET of an artifact
+// swagger:response
+type JobArtifactDataResponse struct {
+	// in: body
+	// format: binary
+	Body string
+}
+
+// JobArtifactResponse is returned by a successful PUT of an artifact
+// swagger:response
+type JobArtifactResponse struct {
+	// in: body
+	Body *models.JobArtifact
+}
+
+// JobArtifactNameParameter used to find an artifact in the path
+// swagger:parameters getJobArtifact putJobArtifact
+type JobArtifactNameParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+}
+
+// JobArtifactPutParameter used to upload an artifact
+// swagger:parameters putJobArtifact
+type JobArtifactPutParameter struct {
+	// in: body
+	// required: true
+	Body interface{}
+	// The SHA256 checksum the artifact must have, in hex
+	// in: query
+	Sha256 string `json:"sha256"`
+}
+
 // JobListPathParameter used to limit lists of Job by path options
 // swagger:parameters listJobs listStatsJobs
 type JobListPathParameter struct {
@@ -175,6 +241,32 @@ func (f *Frontend) InitJobApi() {
 			f.List(c, &backend.Job{})
 		})
 
+	// swagger:route GET /reports/jobs Jobs getJobPruneReport
+	//
+	// Report the Jobs that will be pruned
+	//
+	// This returns the Jobs that the jobRetentionCount,
+	// jobRetentionAge, and jobRetentionFailedAge preferences say
+	// should be removed.  The server archives their logs and
+	// removes them periodically.
+	//
+	// Responses:
+	//    200: JobPruneReportResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	f.ApiGroup.GET("/reports/jobs",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "jobs", "list", "") {
+				return
+			}
+			var res []*models.JobPrune
+			rt := f.rt(c, "jobs", "machines")
+			rt.Do(func(d backend.Stores) {
+				res = rt.JobPruneReport()
+			})
+			c.JSON(http.StatusOK, res)
+		})
+
 	// swagger:route HEAD /jobs Jobs listStatsJobs
 	//
 	// Stats of the List Jobs filtered by some parameters.
@@ -279,14 +371,32 @@ func (f *Frontend) InitJobApi() {
 					return
 				}
 
+				// Tasks in a Stage with TaskDeps can run at the same
+				// time, so hand out a Job for any Task that is ready.
+				if rt.TaskDeps(m) != nil {
+					var created bool
+					if created, err = rt.NextParallelJob(m, b); err != nil {
+						code = http.StatusBadRequest
+					} else if created {
+						code = http.StatusCreated
+					} else {
+						code = http.StatusNoContent
+					}
+					return
+				}
+
 				// Are we running a job or not on list yet, do some checking.
 				newCT := m.CurrentTask
+				retry := 0
 				if newCT < len(m.Tasks) {
 					if jo := rt.Find("jobs", m.CurrentJob.String()); jo != nil && newCT != -1 {
 						cj := jo.(*backend.Job)
 						if cj.State == "failed" {
 							// We are re-running the current task
-						} else if cj.State == "finished" {
+							retry = cj.Retry + 1
+						} else if cj.State == "cancelled" {
+							// We are starting the current task over
+						} else if cj.State == "finished" || cj.State == "skipped" {
 							// We are running the next task
 							newCT += 1
 						} else if cj.State == "incomplete" {
@@ -323,8 +433,58 @@ func (f *Frontend) InitJobApi() {
 					}
 				}
 
+				// Skip over Tasks whose Conditions do not hold,
+				// leaving a skipped Job behind for each of them.
+				for newCT >= 0 && newCT < len(m.Tasks) {
+					runs, e2 := rt.TaskRuns(m, m.Tasks[newCT])
+					if e2 == nil && !runs {
+						m.CurrentTask = newCT
+						e2 = rt.SkipTask(m, m.Tasks[newCT])
+					}
+					if e2 != nil {
+						err = e2
+						code = http.StatusUnprocessableEntity
+						return
+					}
+					if runs {
+						break
+					}
+					retry = 0
+					newCT += 1
+					// Skipping the last Task can move the Machine
+					// along its Workflow.
+					stage := m.Stage
+					m = backend.AsMachine(rt.Find("machines", m.Key()))
+					if m.Stage != stage {
+						code = http.StatusNoContent
+						return
+					}
+				}
+
 				if newCT >= len(m.Tasks) {
 					// Nothing to do.
+					if len(m.Tasks) == 0 {
+						// Stages without Tasks never finish a Job, so
+						// move the Machine along its Workflow or back
+						// into its Pool here.
+						e2 := rt.RolloutResult(m, true, "")
+						moved := false
+						if e2 == nil {
+							moved, e2 = rt.AdvanceWorkflow(m, true)
+						}
+						if e2 == nil && !moved {
+							moved, e2 = rt.FinishPoolCleanup(m)
+						}
+						if e2 != nil {
+							err = e2
+							code = http.StatusInternalServerError
+							return
+						}
+						if moved {
+							code = http.StatusNoContent
+							return
+						}
+					}
 					if newCT != m.CurrentTask {
 						m.CurrentTask = newCT
 						_, err = rt.Save(m)
@@ -347,6 +507,7 @@ func (f *Frontend) InitJobApi() {
 				}
 				b.Stage = m.Stage
 				b.Task = m.Tasks[newCT]
+				b.Retry = retry
 				// Create the job, and then update the machine
 				_, err = rt.Create(b)
 				if err == nil {
@@ -467,6 +628,127 @@ func (f *Frontend) InitJobApi() {
 			f.Remove(c, &backend.Job{}, c.Param(`uuid`))
 		})
 
+	// swagger:route POST /jobs/{uuid}/cancel Jobs cancelJob
+	//
+	// Cancel a Job
+	//
+	// Move the Job specified by {uuid} to the cancelled state and mark
+	// its Machine as not runnable.  The machine agent running the Job
+	// kills whatever it is running and stops.
+	//
+	//     Responses:
+	//       200: JobResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/jobs/:uuid/cancel",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			j := &backend.Job{}
+			var authKey string
+			rt := f.rt(c, j.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				if jo := rt.Find("jobs", uuid); jo != nil {
+					authKey = backend.AsJob(jo).AuthKey()
+				}
+			})
+			if authKey == "" {
+				err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+					Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+				c.JSON(err.Code, err)
+				return
+			}
+			if !f.assureAuth(c, "jobs", "cancel", authKey) {
+				return
+			}
+			var res *backend.Job
+			var err error
+			rt.Do(func(d backend.Stores) {
+				jo := rt.Find("jobs", uuid)
+				if jo == nil {
+					err = &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+						Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+					return
+				}
+				res, err = rt.CancelJob(backend.AsJob(jo))
+			})
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if ok {
+					c.JSON(be.Code, be)
+				} else {
+					c.JSON(http.StatusBadRequest, models.NewError(c.Request.Method, http.StatusBadRequest, err.Error()))
+				}
+				return
+			}
+			c.JSON(http.StatusOK, res.Job)
+		})
+
+	// swagger:route POST /jobs/{uuid}/results Jobs postJobResults
+	//
+	// Add results to a Job
+	//
+	// Merge the passed-in object into the Results of the running Job
+	// specified by {uuid}.  Results named in the ResultParams of the
+	// Task are also written to the Params of the Machine.
+	//
+	//     Responses:
+	//       200: JobResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/jobs/:uuid/results",
+		func(c *gin.Context) {
+			var results map[string]interface{}
+			if !assureDecode(c, &results) {
+				return
+			}
+			uuid := c.Param(`uuid`)
+			j := &backend.Job{}
+			var authKey string
+			rt := f.rt(c, j.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				if jo := rt.Find("jobs", uuid); jo != nil {
+					authKey = backend.AsJob(jo).AuthKey()
+				}
+			})
+			if authKey == "" {
+				err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+					Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+				c.JSON(err.Code, err)
+				return
+			}
+			if !f.assureAuth(c, "jobs", "results", authKey) {
+				return
+			}
+			var res *backend.Job
+			var err error
+			rt.Do(func(d backend.Stores) {
+				jo := rt.Find("jobs", uuid)
+				if jo == nil {
+					err = &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+						Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+					return
+				}
+				res, err = rt.SetJobResults(backend.AsJob(jo), results)
+			})
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if ok {
+					c.JSON(be.Code, be)
+				} else {
+					c.JSON(http.StatusBadRequest, models.NewError(c.Request.Method, http.StatusBadRequest, err.Error()))
+				}
+				return
+			}
+			c.JSON(http.StatusOK, res.Job)
+		})
+
 	// swagger:route GET /jobs/{uuid}/actions Jobs getJobActions
 	//
 	// Get actions for this job
@@ -514,6 +796,7 @@ func (f *Frontend) InitJobApi() {
 				} else {
 					c.JSON(http.StatusBadRequest, models.NewError(c.Request.Method, http.StatusBadRequest, err.Error()))
 				}
+				return
 			}
 			c.JSON(http.StatusOK, actions)
 
@@ -524,6 +807,8 @@ func (f *Frontend) InitJobApi() {
 	// Get the log for this job
 	//
 	// Get log for the Job specified by {uuid} or return NotFound.
+	// If follow is true, the log is streamed as it is written until
+	// the Job is no longer created or running.
 	//
 	//     Produces:
 	//       application/octet-stream
@@ -562,7 +847,15 @@ func (f *Frontend) InitJobApi() {
 			}
 
 			c.Writer.Header().Set("Content-Type", "application/octet-stream")
-			c.File(j.LogPath(rt))
+			if c.Query("follow") != "true" {
+				c.File(j.LogPath(rt))
+				return
+			}
+			c.Status(http.StatusOK)
+			if err := rt.FollowJobLog(j.Key(), c.Writer, c.Writer.CloseNotify()); err != nil && !c.Writer.Written() {
+				c.Writer.Header().Set("Content-Type", gin.MIMEJSON)
+				c.JSON(http.StatusInternalServerError, models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+			}
 		})
 
 	// swagger:route PUT /jobs/{uuid}/log Jobs putJobLog
@@ -629,4 +922,137 @@ func (f *Frontend) InitJobApi() {
 			}
 		})
 
+	// swagger:route GET /jobs/{uuid}/artifacts Jobs listJobArtifacts
+	//
+	// List the artifacts of a Job
+	//
+	//     Responses:
+	//       200: JobArtifactsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/artifacts",
+		func(c *gin.Context) {
+			j := f.findJob(c, "artifacts")
+			if j == nil {
+				return
+			}
+			res := j.Artifacts
+			if res == nil {
+				res = []models.JobArtifact{}
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route GET /jobs/{uuid}/artifacts/{name} Jobs getJobArtifact
+	//
+	// Get an artifact of a Job
+	//
+	//     Produces:
+	//       application/octet-stream
+	//       application/json
+	//
+	//     Responses:
+	//       200: JobArtifactDataResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/jobs/:uuid/artifacts/:name",
+		func(c *gin.Context) {
+			j := f.findJob(c, "artifacts")
+			if j == nil {
+				return
+			}
+			name := c.Param(`name`)
+			a := j.Artifact(name)
+			if a == nil {
+				err := &models.Error{Code: http.StatusNotFound, Type: c.Request.Method, Model: "jobs", Key: j.Key()}
+				err.Errorf("Job %s has no artifact %s", j.Key(), name)
+				c.JSON(err.Code, err)
+				return
+			}
+			c.Writer.Header().Set("Content-Type", "application/octet-stream")
+			c.Writer.Header().Set("X-Sha256", a.Sha256)
+			c.File(filepath.Join(j.ArtifactDir(f.rt(c)), name))
+		})
+
+	// swagger:route PUT /jobs/{uuid}/artifacts/{name} Jobs putJobArtifact
+	//
+	// Store an artifact of a running Job
+	//
+	// Store the body as the artifact {name} of the Job specified by
+	// {uuid}, replacing any artifact with the same name.  If sha256 is
+	// passed, the body must have that checksum.
+	//
+	//     Consumes:
+	//       application/octet-stream
+	//
+	//     Responses:
+	//       201: JobArtifactResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       413: ErrorResponse
+	//       415: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PUT("/jobs/:uuid/artifacts/:name",
+		func(c *gin.Context) {
+			if c.Request.Body == nil {
+				err := &models.Error{Code: http.StatusBadRequest}
+				c.JSON(err.Code, err)
+				return
+			}
+			defer c.Request.Body.Close()
+			if c.Request.Header.Get(`Content-Type`) != `application/octet-stream` {
+				c.JSON(http.StatusUnsupportedMediaType,
+					models.NewError("API ERROR", http.StatusUnsupportedMediaType,
+						"job artifact put must have content-type application/octet-stream"))
+				return
+			}
+			j := f.findJob(c, "artifacts")
+			if j == nil {
+				return
+			}
+			rt := f.rt(c, j.Locks("update")...)
+			res, err := rt.AddJobArtifact(j.Key(), c.Param(`name`), c.Request.Body, c.Query("sha256"))
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if ok {
+					c.JSON(be.Code, be)
+				} else {
+					c.JSON(http.StatusInternalServerError, models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+				}
+				return
+			}
+			c.JSON(http.StatusCreated, res)
+		})
+}
+
+// findJob finds the Job named by the uuid in the path and checks that
+// the caller can perform action on it.  It returns a copy of the Job,
+// so it can be read once the jobs lock is released.  If it returns
+// nil, the response has already been sent.
+func (f *Frontend) findJob(c *gin.Context, action string) *backend.Job {
+	uuid := c.Param(`uuid`)
+	j := &backend.Job{}
+	var found bool
+	rt := f.rt(c, j.Locks("get")...)
+	rt.Do(func(d backend.Stores) {
+		if jo := rt.Find("jobs", uuid); jo != nil {
+			j.Job = models.Clone(jo).(*models.Job)
+			found = true
+		}
+	})
+	if !found {
+		err := &models.Error{Code: http.StatusNotFound, Type: backend.ValidationError,
+			Messages: []string{fmt.Sprintf("Job %s does not exist", uuid)}}
+		c.JSON(err.Code, err)
+		return nil
+	}
+	if !f.assureAuth(c, "jobs", action, j.AuthKey()) {
+		return nil
+	}
+	return j
 }
@@ -67,6 +67,8 @@ type LeaseListPathParameter struct {
 	Strategy string
 	// in: query
 	ExpireTime string
+	// in: query
+	Machine string
 }
 
 func (f *Frontend) InitLeaseApi() {
@@ -85,6 +87,7 @@ func (f *Frontend) InitLeaseApi() {
 	//    Token = string
 	//    Strategy = string
 	//    ExpireTime = Date/Time
+	//    Machine = UUID string
 	//    Available = boolean
 	//    Valid = boolean
 	//    ReadOnly = boolean
@@ -128,6 +131,7 @@ func (f *Frontend) InitLeaseApi() {
 	//    Token = string
 	//    Strategy = string
 	//    ExpireTime = Date/Time
+	//    Machine = UUID string
 	//    Available = boolean
 	//    Valid = boolean
 	//    ReadOnly = boolean
@@ -52,6 +52,82 @@ type MachineParamResponse struct {
 	Body interface{}
 }
 
+// MachineWorkflowResponse return on a successful GET of a Machine's Workflow position
+// swagger:response
+type MachineWorkflowResponse struct {
+	// in: body
+	Body *models.WorkflowPosition
+}
+
+// MachineInventoryResponse return on a successful GET or POST of a Machine's Inventory
+// swagger:response
+type MachineInventoryResponse struct {
+	// in: body
+	Body *models.Inventory
+}
+
+// MachineHeartbeatResponse return on a successful POST of a Machine's heartbeat
+// swagger:response
+type MachineHeartbeatResponse struct {
+	// in: body
+	Body *models.MachineHeartbeat
+}
+
+// MachineInventoryHistoryResponse return on a successful GET of a Machine's Inventory history
+// swagger:response
+type MachineInventoryHistoryResponse struct {
+	// in: body
+	Body []*models.Inventory
+}
+
+// MachineBulkResponse return on a successful POST of a bulk Machine change
+// swagger:response
+type MachineBulkResponse struct {
+	// in: body
+	Body []*models.BulkMachineResult
+}
+
+// MachineBulkBodyParameter used to change many Machines at once
+// swagger:parameters postMachinesBulk
+type MachineBulkBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.BulkMachineRequest
+}
+
+// MachineInventoryBodyParameter used to submit the Inventory of a Machine
+// swagger:parameters postMachineInventory
+type MachineInventoryBodyParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: body
+	// required: true
+	Body *models.Inventory
+}
+
+// MachineHeartbeatBodyParameter used to submit a heartbeat from the
+// agent on a Machine
+// swagger:parameters postMachineHeartbeat
+type MachineHeartbeatBodyParameter struct {
+	// in: path
+	// required: true
+	// swagger:strfmt uuid
+	Uuid uuid.UUID `json:"uuid"`
+	// in: body
+	// required: true
+	Body *models.MachineHeartbeat
+}
+
+// WhoamiBodyParameter used to find a Machine by its Fingerprint
+// swagger:parameters whoami
+type WhoamiBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.MachineFingerprint
+}
+
 // MachineActionPostResponse return on a successful POST of action
 // swagger:response
 type MachineActionPostResponse struct {
@@ -104,7 +180,7 @@ type MachinePostParamsParameter struct {
 }
 
 // MachinePathParameter used to find a Machine in the path
-// swagger:parameters putMachines getMachine putMachine patchMachine deleteMachine getMachineActions headMachine patchMachineParams postMachineParams
+// swagger:parameters putMachines getMachine putMachine patchMachine deleteMachine getMachineActions getMachineWorkflow getMachineInventory getMachineInventoryHistory getMachineLeases getMachineReservations postMachineReservations headMachine patchMachineParams postMachineParams
 type MachinePathParameter struct {
 	// in: path
 	// required: true
@@ -129,6 +205,8 @@ type MachinePostParamPathParemeter struct {
 type MachineGetParamsPathParameter struct {
 	// in: query
 	Aggregate string `json:"aggregate"`
+	// in: query
+	Explain string `json:"explain"`
 	// in: path
 	// required: true
 	// swagger:strfmt uuid
@@ -199,6 +277,22 @@ type MachineListPathParameter struct {
 	Address string
 	// in: query
 	Runnable string
+	// in: query
+	Workflow string
+	// in: query
+	State string
+	// in: query
+	Pool string
+	// in: query
+	Vendor string
+	// in: query
+	SerialNumber string
+	// in: query
+	Memory string
+	// in: query
+	MAC string
+	// in: query
+	LastSeen string
 }
 
 func (f *Frontend) InitMachineApi() {
@@ -218,6 +312,14 @@ func (f *Frontend) InitMachineApi() {
 	//    BootEnv = string
 	//    Address = IP Address
 	//    Runnable = true/false
+	//    Workflow = string
+	//    State = string
+	//    Pool = string
+	//    Vendor = string
+	//    SerialNumber = string
+	//    Memory = integer (bytes)
+	//    MAC = MAC Address (Eq and Ne only)
+	//    LastSeen = datetime
 	//    Available = boolean
 	//    Valid = boolean
 	//    ReadOnly = boolean
@@ -264,6 +366,14 @@ func (f *Frontend) InitMachineApi() {
 	//    BootEnv = string
 	//    Address = IP Address
 	//    Runnable = true/false
+	//    Workflow = string
+	//    State = string
+	//    Pool = string
+	//    Vendor = string
+	//    SerialNumber = string
+	//    Memory = integer (bytes)
+	//    MAC = MAC Address (Eq and Ne only)
+	//    LastSeen = datetime
 	//    Available = boolean
 	//    Valid = boolean
 	//    ReadOnly = boolean
@@ -337,7 +447,7 @@ func (f *Frontend) InitMachineApi() {
 				} else {
 					res = b
 				}
-				c.JSON(http.StatusCreated, res)
+				c.JSON(http.StatusCreated, f.redact(c, models.Clone(res)))
 			}
 		})
 
@@ -447,6 +557,10 @@ func (f *Frontend) InitMachineApi() {
 	//
 	// List Machine parms for a Machine specified by {uuid}
 	//
+	// If explain=true is passed, this returns a ParamExplanation for each
+	// parameter instead, showing the effective value, the layer it comes
+	// from, and the values from lower layers that it shadows.
+	//
 	//     Responses:
 	//       200: MachineParamsResponse
 	//       401: NoContentResponse
@@ -516,6 +630,494 @@ func (f *Frontend) InitMachineApi() {
 	//       409: ErrorResponse
 	f.ApiGroup.POST("/machines/:uuid/params/*key", pSetOne)
 
+	// swagger:route GET /machines/{uuid}/workflow Machines getMachineWorkflow
+	//
+	// Get the Workflow position of a Machine
+	//
+	// Get where the Machine specified by {uuid} is in its Workflow.
+	//
+	//     Responses:
+	//       200: MachineWorkflowResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/workflow",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "get", uuid) {
+				return
+			}
+			var pos *models.WorkflowPosition
+			err := &models.Error{
+				Code:  http.StatusNotFound,
+				Type:  c.Request.Method,
+				Model: "machines",
+				Key:   uuid,
+			}
+			rt := f.rt(c, "machines", "workflows", "jobs")
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					err.Errorf("Not Found")
+					return
+				}
+				pos = rt.WorkflowPosition(backend.AsMachine(ref))
+				if pos == nil {
+					err.Errorf("Machine is not following a Workflow")
+				}
+			})
+			if err.ContainsError() {
+				c.JSON(err.Code, err)
+			} else {
+				c.JSON(http.StatusOK, pos)
+			}
+		})
+
+	// swagger:route POST /whoami Machines whoami
+	//
+	// Find a Machine by its Fingerprint
+	//
+	// Return the Machine whose Fingerprint best matches the passed one.
+	// Discovery images use this to reclaim an existing Machine
+	// instead of creating a new one.  A matching SystemUUID counts for
+	// more than a matching SerialNumber, which counts for more than
+	// any number of matching MACs.  The caller needs the machines
+	// whoami claim, and errors do not say which Machines matched.
+	//
+	//     Responses:
+	//       200: MachineResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/whoami",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "machines", "whoami", "") {
+				return
+			}
+			fp := &models.MachineFingerprint{}
+			if !assureDecode(c, fp) {
+				return
+			}
+			var m *models.Machine
+			var err error
+			rt := f.rt(c, "machines")
+			rt.Do(func(d backend.Stores) {
+				var found *backend.Machine
+				if found, err = rt.FindMachineByFingerprint(fp); found != nil {
+					m = models.Clone(found.Machine).(*models.Machine)
+				}
+			})
+			if err != nil {
+				be := err.(*models.Error)
+				c.JSON(be.Code, be)
+				return
+			}
+			if m == nil {
+				res := &models.Error{Code: http.StatusNotFound, Type: c.Request.Method, Model: "machines"}
+				res.Errorf("No Machine matches the Fingerprint")
+				c.JSON(res.Code, res)
+				return
+			}
+			if !f.assureAuth(c, "machines", "get", m.Key()) {
+				return
+			}
+			c.JSON(http.StatusOK, f.redact(c, m))
+		})
+
+	// swagger:route POST /bulk/machines Machines postMachinesBulk
+	//
+	// Change many Machines at once
+	//
+	// Apply a JSON patch, a Stage change, Profiles to add or remove,
+	// and Params to set to every Machine that matches Filter, all
+	// while holding one set of locks.  The result for each Machine
+	// says whether the change worked for it.  With DryRun, each change
+	// is checked but nothing is saved.
+	//
+	//     Responses:
+	//       200: MachineBulkResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	f.ApiGroup.POST("/bulk/machines",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "machines", "update", "*") {
+				return
+			}
+			req := &models.BulkMachineRequest{}
+			if !assureDecode(c, req) {
+				return
+			}
+			params := map[string][]string{}
+			for k, v := range req.Filter {
+				params[k] = []string{v}
+			}
+			var res []*models.BulkMachineResult
+			var err error
+			ref := &backend.Machine{}
+			backend.Fill(ref)
+			rt := f.rt(c, ref.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				filters, e2 := f.processFilters(rt, d, ref, params)
+				if e2 != nil {
+					be := &models.Error{
+						Code:  http.StatusBadRequest,
+						Type:  c.Request.Method,
+						Model: "machines",
+					}
+					be.AddError(e2)
+					err = be
+					return
+				}
+				if res, err = rt.BulkMachines(req, filters...); err == nil {
+					for _, r := range res {
+						if r.Object != nil {
+							r.Object = f.redact(c, models.Clone(r.Object)).(*models.Machine)
+						}
+					}
+				}
+			})
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if ok {
+					c.JSON(be.Code, be)
+				} else {
+					c.JSON(http.StatusInternalServerError, models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+				}
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route GET /machines/{uuid}/inventory Machines getMachineInventory
+	//
+	// Get the Inventory of a Machine
+	//
+	// Get the most recent hardware Inventory of the Machine specified by {uuid}.
+	//
+	//     Responses:
+	//       200: MachineInventoryResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/inventory",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "get", uuid) {
+				return
+			}
+			var inv *models.Inventory
+			err := &models.Error{
+				Code:  http.StatusNotFound,
+				Type:  c.Request.Method,
+				Model: "machines",
+				Key:   uuid,
+			}
+			rt := f.rt(c, "machines")
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					err.Errorf("Not Found")
+					return
+				}
+				if inv = backend.AsMachine(ref).Inventory; inv == nil {
+					err.Errorf("Machine has not reported an Inventory")
+				}
+			})
+			if err.ContainsError() {
+				c.JSON(err.Code, err)
+			} else {
+				c.JSON(http.StatusOK, inv)
+			}
+		})
+
+	// swagger:route GET /machines/{uuid}/inventory/history Machines getMachineInventoryHistory
+	//
+	// Get the Inventory history of a Machine
+	//
+	// Get every distinct hardware Inventory the Machine specified by {uuid}
+	// has reported, oldest first.
+	//
+	//     Responses:
+	//       200: MachineInventoryHistoryResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       500: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/inventory/history",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "get", uuid) {
+				return
+			}
+			var res []*models.Inventory
+			err := &models.Error{
+				Code:  http.StatusNotFound,
+				Type:  c.Request.Method,
+				Model: "machines",
+				Key:   uuid,
+			}
+			rt := f.rt(c, "machines")
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					err.Errorf("Not Found")
+					return
+				}
+				var e2 error
+				if res, e2 = rt.InventoryHistory(backend.AsMachine(ref)); e2 != nil {
+					err.Code = http.StatusInternalServerError
+					err.AddError(e2)
+				}
+			})
+			if err.ContainsError() {
+				c.JSON(err.Code, err)
+			} else {
+				c.JSON(http.StatusOK, res)
+			}
+		})
+
+	// swagger:route POST /machines/{uuid}/inventory Machines postMachineInventory
+	//
+	// Submit the Inventory of a Machine
+	//
+	// Record the hardware Inventory of the Machine specified by {uuid}.
+	// Inventories that differ from the previous one are added to the
+	// Machine's Inventory history.
+	//
+	//     Responses:
+	//       200: MachineInventoryResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/inventory",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "update", uuid) {
+				return
+			}
+			inv := &models.Inventory{}
+			if !assureDecode(c, inv) {
+				return
+			}
+			var err error
+			b := &backend.Machine{}
+			rt := f.rt(c, b.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					e2 := &models.Error{
+						Code:  http.StatusNotFound,
+						Type:  c.Request.Method,
+						Model: "machines",
+						Key:   uuid,
+					}
+					e2.Errorf("Not Found")
+					err = e2
+					return
+				}
+				b, err = rt.SetInventory(backend.AsMachine(ref), inv)
+			})
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if ok {
+					c.JSON(be.Code, be)
+				} else {
+					c.JSON(http.StatusInternalServerError, models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+				}
+				return
+			}
+			c.JSON(http.StatusOK, b.Inventory)
+		})
+
+	// swagger:route POST /machines/{uuid}/heartbeat Machines postMachineHeartbeat
+	//
+	// Submit a heartbeat from the agent on a Machine
+	//
+	// Record that the machine agent on the Machine specified by {uuid}
+	// is alive, along with its version, uptime, and current Job.
+	// Running Jobs on Machines that stop sending heartbeats are
+	// failed.
+	//
+	//     Responses:
+	//       200: MachineHeartbeatResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/heartbeat",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "heartbeat", uuid) {
+				return
+			}
+			hb := &models.MachineHeartbeat{}
+			if !assureDecode(c, hb) {
+				return
+			}
+			found := false
+			rt := f.rt(c, "machines")
+			rt.Do(func(d backend.Stores) {
+				if ref := rt.Find("machines", uuid); ref != nil {
+					found = true
+					hb = rt.SetHeartbeat(backend.AsMachine(ref), hb)
+				}
+			})
+			if !found {
+				err := &models.Error{
+					Code:  http.StatusNotFound,
+					Type:  c.Request.Method,
+					Model: "machines",
+					Key:   uuid,
+				}
+				err.Errorf("Not Found")
+				c.JSON(err.Code, err)
+				return
+			}
+			c.JSON(http.StatusOK, hb)
+		})
+
+	// swagger:route GET /machines/{uuid}/leases Machines getMachineLeases
+	//
+	// Get the Leases of a Machine
+	//
+	// Get the Leases that have been handed out to the MACs of the Machine
+	// specified by {uuid}.
+	//
+	//     Responses:
+	//       200: LeasesResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/leases",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "get", uuid) ||
+				!f.assureAuth(c, "leases", "list", "") {
+				return
+			}
+			var res []*models.Lease
+			err := &models.Error{
+				Code:  http.StatusNotFound,
+				Type:  c.Request.Method,
+				Model: "machines",
+				Key:   uuid,
+			}
+			rt := f.rt(c, "machines", "leases")
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					err.Errorf("Not Found")
+					return
+				}
+				res = rt.MachineLeases(backend.AsMachine(ref))
+			})
+			if err.ContainsError() {
+				c.JSON(err.Code, err)
+			} else {
+				c.JSON(http.StatusOK, res)
+			}
+		})
+
+	// swagger:route GET /machines/{uuid}/reservations Machines getMachineReservations
+	//
+	// Get the Reservations of a Machine
+	//
+	// Get the Reservations for the MACs of the Machine specified by {uuid},
+	// along with the ones that were made for it automatically.
+	//
+	//     Responses:
+	//       200: ReservationsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/machines/:uuid/reservations",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "machines", "get", uuid) ||
+				!f.assureAuth(c, "reservations", "list", "") {
+				return
+			}
+			var res []*models.Reservation
+			err := &models.Error{
+				Code:  http.StatusNotFound,
+				Type:  c.Request.Method,
+				Model: "machines",
+				Key:   uuid,
+			}
+			rt := f.rt(c, "machines", "reservations")
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					err.Errorf("Not Found")
+					return
+				}
+				res = rt.MachineReservations(backend.AsMachine(ref))
+			})
+			if err.ContainsError() {
+				c.JSON(err.Code, err)
+			} else {
+				c.JSON(http.StatusOK, res)
+			}
+		})
+
+	// swagger:route POST /machines/{uuid}/reservations Machines postMachineReservations
+	//
+	// Reserve the addresses of a Machine's Interfaces
+	//
+	// Create a MAC Reservation for each Interface of the Machine
+	// specified by {uuid} that has an Address.  Reservations that
+	// already exist are left alone.
+	//
+	//     Responses:
+	//       200: ReservationsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/machines/:uuid/reservations",
+		func(c *gin.Context) {
+			uuid := c.Param(`uuid`)
+			if !f.assureAuth(c, "reservations", "create", "") {
+				return
+			}
+			var err error
+			res := []*models.Reservation{}
+			rt := f.rt(c, "machines", "reservations", "subnets")
+			rt.Do(func(d backend.Stores) {
+				ref := rt.Find("machines", uuid)
+				if ref == nil {
+					e2 := &models.Error{
+						Code:  http.StatusNotFound,
+						Type:  c.Request.Method,
+						Model: "machines",
+						Key:   uuid,
+					}
+					e2.Errorf("Not Found")
+					err = e2
+					return
+				}
+				res, err = rt.ReserveInterfaces(backend.AsMachine(ref))
+			})
+			if err != nil {
+				be, ok := err.(*models.Error)
+				if ok {
+					c.JSON(be.Code, be)
+				} else {
+					c.JSON(http.StatusInternalServerError, models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+				}
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
 	// swagger:route GET /machines/{uuid}/actions Machines getMachineActions
 	//
 	// List machine actions Machine
@@ -1,6 +1,7 @@
 package frontend
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/VictorLowther/jsonpatch2"
@@ -30,6 +31,13 @@ type ParamParamsResponse struct {
 	Body map[string]interface{}
 }
 
+// ParamReportResponse returned on a successful GET of the param report
+// swagger:response
+type ParamReportResponse struct {
+	// in: body
+	Body []*models.ParamError
+}
+
 // ParamBodyParameter used to inject a Param
 // swagger:parameters createParam putParam
 type ParamBodyParameter struct {
@@ -119,6 +127,31 @@ func (f *Frontend) InitParamApi() {
 			f.List(c, &backend.Param{})
 		})
 
+	// swagger:route GET /reports/params Params getParamReport
+	//
+	// Report invalid param values
+	//
+	// This revalidates every param value on every Machine, Profile,
+	// and Plugin against the schema of its Param, and returns the
+	// values that fail.
+	//
+	// Responses:
+	//    200: ParamReportResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	f.ApiGroup.GET("/reports/params",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "params", "list", "") {
+				return
+			}
+			var res []*models.ParamError
+			rt := f.rt(c, "machines", "profiles", "plugins", "params")
+			rt.Do(func(d backend.Stores) {
+				res = rt.ParamReport()
+			})
+			c.JSON(http.StatusOK, res)
+		})
+
 	// swagger:route HEAD /params Params listStatsParams
 	//
 	// Stats of the List Params filtered by some parameters.
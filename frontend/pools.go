@@ -0,0 +1,226 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+)
+
+// PoolResponse returned on a successful GET of a Pool
+// swagger:response
+type PoolResponse struct {
+	// in: body
+	Body *models.PoolStatus
+}
+
+// PoolsResponse returned on a successful GET of all the Pools
+// swagger:response
+type PoolsResponse struct {
+	// in: body
+	Body []*models.PoolStatus
+}
+
+// swagger:parameters getPool postPoolClaim postPoolRelease
+type PoolPathParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+}
+
+// PoolClaimBodyParameter used to claim Machines from a Pool
+// swagger:parameters postPoolClaim
+type PoolClaimBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.PoolClaim
+}
+
+// PoolReleaseBodyParameter used to release Machines back to a Pool
+// swagger:parameters postPoolRelease
+type PoolReleaseBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.PoolRelease
+}
+
+func poolError(c *gin.Context, err error) {
+	if be, ok := err.(*models.Error); ok {
+		c.JSON(be.Code, be)
+	} else {
+		c.JSON(http.StatusInternalServerError, models.NewError(c.Request.Method, http.StatusInternalServerError, err.Error()))
+	}
+}
+
+// redactMachines returns redacted copies of ms.  The caller must hold
+// the machines lock.
+func (f *Frontend) redactMachines(c *gin.Context, ms []*models.Machine) []*models.Machine {
+	res := make([]*models.Machine, len(ms))
+	for i, m := range ms {
+		res[i] = f.redact(c, models.Clone(m)).(*models.Machine)
+	}
+	return res
+}
+
+func (f *Frontend) InitPoolApi() {
+	// swagger:route GET /pools Pools listPools
+	//
+	// Lists the Pools
+	//
+	// Summarize every Pool that has Machines in it.
+	//
+	//     Responses:
+	//       200: PoolsResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	f.ApiGroup.GET("/pools",
+		func(c *gin.Context) {
+			if !f.assureAuth(c, "pools", "list", "") {
+				return
+			}
+			var res []*models.PoolStatus
+			rt := f.rt(c, (&backend.Machine{}).Locks("get")...)
+			rt.Do(func(d backend.Stores) {
+				res = rt.Pools()
+			})
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route GET /pools/{name} Pools getPool
+	//
+	// Get a Pool
+	//
+	// Summarize the Pool specified by {name}, along with the Machines
+	// in it.
+	//
+	//     Responses:
+	//       200: PoolResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/pools/:name",
+		func(c *gin.Context) {
+			name := c.Param(`name`)
+			if !f.assureAuth(c, "pools", "get", name) {
+				return
+			}
+			var res *models.PoolStatus
+			rt := f.rt(c, (&backend.Machine{}).Locks("get")...)
+			rt.Do(func(d backend.Stores) {
+				if res = rt.Pool(name); res != nil {
+					res.Machines = f.redactMachines(c, res.Machines)
+				}
+			})
+			if res == nil {
+				err := &models.Error{
+					Code:  http.StatusNotFound,
+					Type:  c.Request.Method,
+					Model: "pools",
+					Key:   name,
+				}
+				err.Errorf("Not Found")
+				c.JSON(err.Code, err)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route POST /pools/{name}/claim Pools postPoolClaim
+	//
+	// Claim Machines from a Pool
+	//
+	// Claim Count ready Machines that match Filter from the Pool
+	// specified by {name} for Owner.  The Machines are moved to the
+	// in-use State and stay claimed for Duration seconds, or until
+	// they are released.  Either all of the Machines are claimed or
+	// none are.
+	//
+	//     Responses:
+	//       200: MachinesResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       409: ErrorResponse
+	f.ApiGroup.POST("/pools/:name/claim",
+		func(c *gin.Context) {
+			name := c.Param(`name`)
+			if !f.assureAuth(c, "pools", "claim", name) {
+				return
+			}
+			claim := &models.PoolClaim{}
+			if !assureDecode(c, claim) {
+				return
+			}
+			params := map[string][]string{}
+			for k, v := range claim.Filter {
+				params[k] = []string{v}
+			}
+			var res []*models.Machine
+			var err error
+			ref := &backend.Machine{}
+			backend.Fill(ref)
+			rt := f.rt(c, ref.Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				filters, e2 := f.processFilters(rt, d, ref, params)
+				if e2 != nil {
+					be := &models.Error{
+						Code:  http.StatusBadRequest,
+						Type:  c.Request.Method,
+						Model: "pools",
+						Key:   name,
+					}
+					be.AddError(e2)
+					err = be
+					return
+				}
+				if res, err = rt.ClaimMachines(name, claim, filters...); err == nil {
+					res = f.redactMachines(c, res)
+				}
+			})
+			if err != nil {
+				poolError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+
+	// swagger:route POST /pools/{name}/release Pools postPoolRelease
+	//
+	// Release Machines back to a Pool
+	//
+	// Release the listed Machines claimed by Owner from the Pool
+	// specified by {name}, or all of them if none are listed.  Machines
+	// pass through the Stage named by the pool/cleanup-stage param, if
+	// any, before they can be claimed again.
+	//
+	//     Responses:
+	//       200: MachinesResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       409: ErrorResponse
+	f.ApiGroup.POST("/pools/:name/release",
+		func(c *gin.Context) {
+			name := c.Param(`name`)
+			if !f.assureAuth(c, "pools", "release", name) {
+				return
+			}
+			release := &models.PoolRelease{}
+			if !assureDecode(c, release) {
+				return
+			}
+			var res []*models.Machine
+			var err error
+			rt := f.rt(c, (&backend.Machine{}).Locks("update")...)
+			rt.Do(func(d backend.Stores) {
+				res, err = rt.ReleaseMachines(name, release)
+				res = f.redactMachines(c, res)
+			})
+			if err != nil {
+				poolError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, res)
+		})
+}
@@ -39,7 +39,12 @@ func (f *Frontend) InitPrefApi() {
 			if !f.assureAuth(c, "prefs", "list", "") {
 				return
 			}
-			c.JSON(http.StatusOK, f.dt.Prefs())
+			prefs := f.dt.Prefs()
+			// The keys used to seal secure params and sign job
+			// actions never leave the server.
+			delete(prefs, "secureParamSecret")
+			delete(prefs, "jobSigningKey")
+			c.JSON(http.StatusOK, prefs)
 		})
 
 	// swagger:route POST /prefs Prefs setPrefs
@@ -75,18 +80,27 @@ func (f *Frontend) InitPrefApi() {
 					if len(prefs[k]) != 32 {
 						err.Errorf("%s: Must be 32 bytes long", k)
 					}
-				case "defaultBootEnv", "unknownBootEnv", "defaultStage", "systemGrantorSecret",
+				case "defaultBootEnv", "unknownBootEnv", "defaultStage", "systemGrantorSecret", "jobSigningKey",
 					"debugRenderer", "debugDhcp", "debugBootEnv", "debugFrontend", "debugPlugins", "logLevel":
 					if !f.assureAuth(c, "prefs", "post", k) {
 						return
 					}
-				case "knownTokenTimeout", "unknownTokenTimeout":
+				case "knownTokenTimeout", "unknownTokenTimeout", "jobArtifactMaxSize",
+					"jobRetentionCount", "jobRetentionAge", "jobRetentionFailedAge",
+					"agentHeartbeatTimeout":
 					if !f.assureAuth(c, "prefs", "post", k) {
 						return
 					}
 					if _, e := strconv.Atoi(prefs[k]); e != nil {
 						err.Errorf("%s: %v", k, e)
 					}
+				case "reserveMachineAddresses":
+					if !f.assureAuth(c, "prefs", "post", k) {
+						return
+					}
+					if _, e := strconv.ParseBool(prefs[k]); e != nil {
+						err.Errorf("%s: %v", k, e)
+					}
 				default:
 					err.Errorf("Unknown Preference %s", k)
 				}
@@ -101,7 +115,10 @@ func (f *Frontend) InitPrefApi() {
 			if err.ContainsError() {
 				c.JSON(err.Code, err)
 			} else {
-				c.JSON(http.StatusCreated, f.dt.Prefs())
+				prefs := f.dt.Prefs()
+				delete(prefs, "secureParamSecret")
+				delete(prefs, "jobSigningKey")
+				c.JSON(http.StatusCreated, prefs)
 			}
 		})
 }
@@ -78,6 +78,8 @@ type ReservationListPathParameter struct {
 	Strategy string
 	// in: query
 	NextServer string
+	// in: query
+	Machine string
 }
 
 func (f *Frontend) InitReservationApi() {
@@ -96,6 +98,7 @@ func (f *Frontend) InitReservationApi() {
 	//    Token = string
 	//    Strategy = string
 	//    NextServer = IP Address
+	//    Machine = UUID string
 	//    Available = boolean
 	//    Valid = boolean
 	//    ReadOnly = boolean
@@ -139,6 +142,7 @@ func (f *Frontend) InitReservationApi() {
 	//    Token = string
 	//    Strategy = string
 	//    NextServer = IP Address
+	//    Machine = UUID string
 	//    Available = boolean
 	//    Valid = boolean
 	//    ReadOnly = boolean
@@ -0,0 +1,349 @@
+package frontend
+
+import (
+	"net/http"
+
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/digitalrebar/provision/backend"
+	"github.com/digitalrebar/provision/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RolloutResponse returned on a successful GET, PUT, PATCH, or POST of a single rollout
+// swagger:response
+type RolloutResponse struct {
+	// in: body
+	Body *models.Rollout
+}
+
+// RolloutsResponse returned on a successful GET of all the rollouts
+// swagger:response
+type RolloutsResponse struct {
+	//in: body
+	Body []*models.Rollout
+}
+
+// RolloutBodyParameter used to inject a Rollout
+// swagger:parameters createRollout putRollout
+type RolloutBodyParameter struct {
+	// in: body
+	// required: true
+	Body *models.Rollout
+}
+
+// RolloutPatchBodyParameter used to patch a Rollout
+// swagger:parameters patchRollout
+type RolloutPatchBodyParameter struct {
+	// in: body
+	// required: true
+	Body jsonpatch2.Patch
+}
+
+// RolloutPathParameter used to name a Rollout in the path
+// swagger:parameters putRollouts getRollout putRollout patchRollout deleteRollout headRollout pauseRollout resumeRollout abortRollout
+type RolloutPathParameter struct {
+	// in: path
+	// required: true
+	Name string `json:"name"`
+}
+
+// RolloutListPathParameter used to limit lists of Rollout by path options
+// swagger:parameters listRollouts listStatsRollouts
+type RolloutListPathParameter struct {
+	// in: query
+	Offest int `json:"offset"`
+	// in: query
+	Limit int `json:"limit"`
+	// in: query
+	Available string
+	// in: query
+	Valid string
+	// in: query
+	ReadOnly string
+	// in: query
+	Name string
+	// in: query
+	Stage string
+	// in: query
+	State string
+}
+
+func (f *Frontend) InitRolloutApi() {
+	// swagger:route GET /rollouts Rollouts listRollouts
+	//
+	// Lists Rollouts filtered by some parameters.
+	//
+	// This will show all Rollouts by default.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//
+	// Functional Indexs:
+	//    Name = string
+	//    Stage = string
+	//    State = string
+	//    Available = boolean
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    Name=fred - returns items named fred
+	//    Name=Lt(fred) - returns items that alphabetically less than fred.
+	//    Name=Lt(fred)&Available=true - returns items with Name less than fred and Available is true
+	//
+	// Responses:
+	//    200: RolloutsResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.GET("/rollouts",
+		func(c *gin.Context) {
+			f.List(c, &backend.Rollout{})
+		})
+
+	// swagger:route HEAD /rollouts Rollouts listStatsRollouts
+	//
+	// Stats of the List Rollouts filtered by some parameters.
+	//
+	// This will return headers with the stats of the list.
+	//
+	// You may specify:
+	//    Offset = integer, 0-based inclusive starting point in filter data.
+	//    Limit = integer, number of items to return
+	//
+	// Functional Indexs:
+	//    Name = string
+	//    Stage = string
+	//    State = string
+	//    Available = boolean
+	//
+	// Functions:
+	//    Eq(value) = Return items that are equal to value
+	//    Lt(value) = Return items that are less than value
+	//    Lte(value) = Return items that less than or equal to value
+	//    Gt(value) = Return items that are greater than value
+	//    Gte(value) = Return items that greater than or equal to value
+	//    Between(lower,upper) = Return items that are inclusively between lower and upper
+	//    Except(lower,upper) = Return items that are not inclusively between lower and upper
+	//
+	// Example:
+	//    Name=fred - returns items named fred
+	//    Name=Lt(fred) - returns items that alphabetically less than fred.
+	//    Name=Lt(fred)&Available=true - returns items with Name less than fred and Available is true
+	//
+	// Responses:
+	//    200: NoContentResponse
+	//    401: NoContentResponse
+	//    403: NoContentResponse
+	//    406: ErrorResponse
+	f.ApiGroup.HEAD("/rollouts",
+		func(c *gin.Context) {
+			f.ListStats(c, &backend.Rollout{})
+		})
+
+	// swagger:route POST /rollouts Rollouts createRollout
+	//
+	// Create a Rollout
+	//
+	// Create a Rollout from the provided object.  The Filter is
+	// evaluated once to pick the Machines, and the first of them are
+	// moved to Stage right away.
+	//
+	//     Responses:
+	//       201: RolloutResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/rollouts",
+		func(c *gin.Context) {
+			b := &backend.Rollout{}
+			f.Create(c, b)
+		})
+	// swagger:route GET /rollouts/{name} Rollouts getRollout
+	//
+	// Get a Rollout
+	//
+	// Get the Rollout specified by {name} or return NotFound.
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	f.ApiGroup.GET("/rollouts/:name",
+		func(c *gin.Context) {
+			f.Fetch(c, &backend.Rollout{}, c.Param(`name`))
+		})
+
+	// swagger:route HEAD /rollouts/{name} Rollouts headRollout
+	//
+	// See if a Rollout exists
+	//
+	// Return 200 if the Rollout specifiec by {name} exists, or return NotFound.
+	//
+	//     Responses:
+	//       200: NoContentResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: NoContentResponse
+	f.ApiGroup.HEAD("/rollouts/:name",
+		func(c *gin.Context) {
+			f.Exists(c, &backend.Rollout{}, c.Param(`name`))
+		})
+
+	// swagger:route PATCH /rollouts/{name} Rollouts patchRollout
+	//
+	// Patch a Rollout
+	//
+	// Update a Rollout specified by {name} using a RFC6902 Patch structure
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       406: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PATCH("/rollouts/:name",
+		func(c *gin.Context) {
+			f.Patch(c, &backend.Rollout{}, c.Param(`name`))
+		})
+
+	// swagger:route PUT /rollouts/{name} Rollouts putRollout
+	//
+	// Put a Rollout
+	//
+	// Update a Rollout specified by {name} using a JSON Rollout.
+	// The Filter and Stage can not be changed.
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       400: ErrorResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.PUT("/rollouts/:name",
+		func(c *gin.Context) {
+			f.Update(c, &backend.Rollout{}, c.Param(`name`))
+		})
+
+	// swagger:route DELETE /rollouts/{name} Rollouts deleteRollout
+	//
+	// Delete a Rollout
+	//
+	// Delete a Rollout specified by {name}
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       409: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.DELETE("/rollouts/:name",
+		func(c *gin.Context) {
+			f.Remove(c, &backend.Rollout{}, c.Param(`name`))
+		})
+
+	// swagger:route POST /rollouts/{name}/pause Rollouts pauseRollout
+	//
+	// Pause a Rollout
+	//
+	// Stop the Rollout specified by {name} from moving any more
+	// Machines.  Machines it has already moved keep running.
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/rollouts/:name/pause",
+		func(c *gin.Context) {
+			f.setRolloutState(c, "pause", models.RolloutPaused)
+		})
+
+	// swagger:route POST /rollouts/{name}/resume Rollouts resumeRollout
+	//
+	// Resume a Rollout
+	//
+	// Start the paused Rollout specified by {name} moving Machines
+	// again.  Its count of failed Machines starts over at zero.
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/rollouts/:name/resume",
+		func(c *gin.Context) {
+			f.setRolloutState(c, "resume", models.RolloutRunning)
+		})
+
+	// swagger:route POST /rollouts/{name}/abort Rollouts abortRollout
+	//
+	// Abort a Rollout
+	//
+	// Stop the Rollout specified by {name} for good.  Machines it has
+	// already moved are left where they are.
+	//
+	//     Responses:
+	//       200: RolloutResponse
+	//       401: NoContentResponse
+	//       403: NoContentResponse
+	//       404: ErrorResponse
+	//       422: ErrorResponse
+	f.ApiGroup.POST("/rollouts/:name/abort",
+		func(c *gin.Context) {
+			f.setRolloutState(c, "abort", models.RolloutAborted)
+		})
+}
+
+func (f *Frontend) setRolloutState(c *gin.Context, action, state string) {
+	name := c.Param(`name`)
+	if !f.assureAuth(c, "rollouts", action, name) {
+		return
+	}
+	var res *models.Rollout
+	var err error
+	rt := f.rt(c, (&backend.Rollout{}).Locks("actions")...)
+	rt.Do(func(d backend.Stores) {
+		ro := rt.Find("rollouts", name)
+		if ro == nil {
+			be := &models.Error{
+				Code:  http.StatusNotFound,
+				Type:  c.Request.Method,
+				Model: "rollouts",
+				Key:   name,
+			}
+			be.Errorf("Not Found")
+			err = be
+			return
+		}
+		r := models.Clone(backend.AsRollout(ro).Rollout).(*models.Rollout)
+		r.State = state
+		if _, err = rt.Update(r); err == nil {
+			res = backend.AsRollout(rt.Find("rollouts", name)).Rollout
+		}
+	})
+	if err != nil {
+		poolError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
 	"github.com/digitalrebar/provision/models"
 	"github.com/gin-gonic/gin"
 	"gopkg.in/olahol/melody.v1"
@@ -59,7 +60,51 @@ func (f *Frontend) filterFunction(emap []string, claim interface{}, e *models.Ev
 	return matched
 }
 
+// sealedKeys returns the names of the sealed params carried by the
+// object in the event, if any.
+func sealedKeys(e *models.Event) []string {
+	res := []string{}
+	if p, ok := e.Object.(models.Paramer); ok {
+		for k, v := range p.GetParams() {
+			if backend.IsSealed(v) {
+				res = append(res, k)
+			}
+		}
+	}
+	return res
+}
+
+// redactEvent returns a copy of e with the secure params redacted.
+// If reveal is true, they are unsealed instead.
+func (f *Frontend) redactEvent(e *models.Event, reveal bool) *models.Event {
+	res := *e
+	res.Object = f.dt.Redact(models.Clone(e.Object.(models.Model)), func(string) bool { return reveal })
+	return &res
+}
+
 func (f *Frontend) Publish(e *models.Event) error {
+	secure := sealedKeys(e)
+	if len(secure) > 0 {
+		// Sessions that may see every sealed value get them in the
+		// clear, everyone else gets them redacted.
+		canSee := func(claim interface{}) bool {
+			reveal := secureReveal(claim)
+			for _, k := range secure {
+				if !reveal(k) {
+					return false
+				}
+			}
+			return true
+		}
+		if err := f.publish(f.redactEvent(e, true), canSee); err != nil {
+			return err
+		}
+		return f.publish(f.redactEvent(e, false), func(claim interface{}) bool { return !canSee(claim) })
+	}
+	return f.publish(e, func(interface{}) bool { return true })
+}
+
+func (f *Frontend) publish(e *models.Event, claimTest func(interface{}) bool) error {
 	if msg, err := json.Marshal(e); err != nil {
 		return err
 	} else {
@@ -81,7 +126,7 @@ func (f *Frontend) Publish(e *models.Event) error {
 					return true
 				}
 			}()
-			if !hasMap {
+			if !hasMap || !claimTest(claim) {
 				return false
 			}
 			return f.filterFunction(emap, claim, e)
@@ -379,6 +379,14 @@ func (h *DhcpHandler) Serve() error {
 	}
 }
 
+// logOwner notes which Machine, if any, owns the hardware address
+// that sent p.
+func (h *DhcpHandler) logOwner(rt *backend.RequestTracker, p dhcp.Packet) {
+	if key, name, found := h.bk.MachineOwningMAC(p.CHAddr().String()); found {
+		rt.Infof("%s: %s belongs to Machine %s (%s)", xid(p), p.CHAddr(), key, name)
+	}
+}
+
 func (h *DhcpHandler) ServeDHCP(p dhcp.Packet,
 	msgType dhcp.MessageType,
 	options dhcp.Options,
@@ -522,6 +530,7 @@ func (h *DhcpHandler) ServeDHCP(p dhcp.Packet,
 			reply.SetSIAddr(nextServer)
 		}
 		rt.Infof("%s: Request handing out: %s to %s via %s", xid(p), reply.YIAddr(), reply.CHAddr(), h.respondFrom(lease.Addr, cm))
+		h.logOwner(rt, p)
 		return reply
 	case dhcp.Discover:
 		for _, s := range h.strats {
@@ -608,6 +617,7 @@ func (h *DhcpHandler) ServeDHCP(p dhcp.Packet,
 					}
 				}
 				rt.Infof("%s: Discovery handing out: %s to %s via %s", xid(p), reply.YIAddr(), reply.CHAddr(), h.respondFrom(lease.Addr, cm))
+				h.logOwner(rt, p)
 				return reply
 			}
 		}
@@ -0,0 +1,103 @@
+package midlayer
+
+import (
+	"context"
+	"time"
+
+	"github.com/digitalrebar/logger"
+	"github.com/digitalrebar/provision/backend"
+)
+
+// Reaper periodically runs a cleanup function with some locks.
+type Reaper struct {
+	logger.Logger
+	dt    *backend.DataTracker
+	locks []string
+	reap  func(*backend.RequestTracker)
+	done  chan struct{}
+	quit  chan struct{}
+}
+
+// StartReaper starts calling reap every interval with locks held.
+func StartReaper(dt *backend.DataTracker,
+	l logger.Logger,
+	interval time.Duration,
+	locks []string,
+	reap func(*backend.RequestTracker)) *Reaper {
+	return startReaper(dt, l, interval, locks,
+		func(rt *backend.RequestTracker) {
+			rt.Do(func(d backend.Stores) {
+				reap(rt)
+			})
+		})
+}
+
+// startReaper starts calling reap every interval with a
+// RequestTracker for locks, leaving it to reap to take them.
+func startReaper(dt *backend.DataTracker,
+	l logger.Logger,
+	interval time.Duration,
+	locks []string,
+	reap func(*backend.RequestTracker)) *Reaper {
+	res := &Reaper{
+		Logger: l,
+		dt:     dt,
+		locks:  locks,
+		reap:   reap,
+		done:   make(chan struct{}),
+		quit:   make(chan struct{}),
+	}
+	go res.run(interval)
+	return res
+}
+
+// StartClaimReaper starts releasing Machines whose Pool claims have
+// run out every interval.
+func StartClaimReaper(dt *backend.DataTracker, l logger.Logger, interval time.Duration) *Reaper {
+	return StartReaper(dt, l, interval,
+		(&backend.Machine{}).Locks("update"),
+		(*backend.RequestTracker).ExpireClaims)
+}
+
+// StartJobReaper starts failing Jobs that have run past the Timeout of
+// their Task, and retrying failed ones, every interval.
+func StartJobReaper(dt *backend.DataTracker, l logger.Logger, interval time.Duration) *Reaper {
+	return StartReaper(dt, l, interval,
+		(&backend.Job{}).Locks("update"),
+		(*backend.RequestTracker).ExpireJobs)
+}
+
+// StartJobPruner starts archiving and removing the Jobs that the job
+// retention preferences say should go every interval.  PruneJobs takes
+// the locks itself, so that they are not held while logs are
+// compressed.
+func StartJobPruner(dt *backend.DataTracker, l logger.Logger, interval time.Duration) *Reaper {
+	return startReaper(dt, l, interval,
+		(&backend.Job{}).Locks("update"),
+		(*backend.RequestTracker).PruneJobs)
+}
+
+func (r *Reaper) run(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+			r.reap(r.dt.Request(r.Logger.Fork(), r.locks...))
+		}
+	}
+}
+
+// Shutdown stops the Reaper.
+func (r *Reaper) Shutdown(ctx context.Context) error {
+	close(r.quit)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/VictorLowther/jsonpatch2"
+	"github.com/pborman/uuid"
+)
+
+// BulkMachineRequest describes a change to make to every Machine that
+// matches Filter.  The parts of the change are applied in the order
+// they are listed here.
+//
+// swagger:model
+type BulkMachineRequest struct {
+	// Machine list filters picking the Machines to change, in the same
+	// form as the query parameters of a Machine list, such as
+	// Stage: Eq(discover).
+	//
+	// required: true
+	Filter map[string]string
+	// A JSON patch to apply to each Machine.
+	Patch jsonpatch2.Patch `json:",omitempty"`
+	// The Stage to move each Machine to.
+	Stage string `json:",omitempty"`
+	// Profiles to add to the end of each Machine's Profiles, unless
+	// they are already there.
+	AddProfiles []string `json:",omitempty"`
+	// Profiles to remove from each Machine's Profiles.
+	RemoveProfiles []string `json:",omitempty"`
+	// Params to set on each Machine.
+	Params map[string]interface{} `json:",omitempty"`
+	// Force changes that would otherwise be refused, such as changing
+	// the Stage of a Machine with pending Tasks.
+	Force bool
+	// Check the change against each Machine and report what it would
+	// look like, without saving anything.
+	DryRun bool
+}
+
+// BulkMachineResult is the outcome of a BulkMachineRequest for one
+// Machine.
+//
+// swagger:model
+type BulkMachineResult struct {
+	// The UUID of the Machine.
+	//
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// The name of the Machine.
+	Name string
+	// Why the Machine could not be changed, if it could not.
+	Error *Error `json:",omitempty"`
+	// The Machine after the change.  For a dry run, it is what the
+	// Machine would look like.
+	Object *Machine `json:",omitempty"`
+}
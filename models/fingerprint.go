@@ -0,0 +1,83 @@
+package models
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// MachineFingerprint is a set of hardware identifiers that can be used
+// to recognize a Machine that has lost its UUID, such as when it is
+// rediscovered after its disks have been wiped.
+//
+// swagger:model
+type MachineFingerprint struct {
+	// The SMBIOS system UUID.
+	SystemUUID string
+	// The serial number of the system board.
+	SerialNumber string
+	// The hardware addresses of the network interfaces.
+	MACs []string
+}
+
+// Firmware that does not bother to set these fields tends to fill them
+// with one of these values, so they are useless for telling machines
+// apart.
+var uselessIds = map[string]bool{
+	"":                                     true,
+	"0":                                    true,
+	"none":                                 true,
+	"not specified":                        true,
+	"default string":                       true,
+	"system serial number":                 true,
+	"to be filled by o.e.m.":               true,
+	"00000000-0000-0000-0000-000000000000": true,
+	"ffffffff-ffff-ffff-ffff-ffffffffffff": true,
+	"03000200-0400-0500-0006-000700080009": true,
+}
+
+func usefulId(s string) bool {
+	return !uselessIds[strings.ToLower(strings.TrimSpace(s))]
+}
+
+// Validate checks the fingerprint for errors and puts it into
+// canonical form.
+func (f *MachineFingerprint) Validate(e ErrorAdder) {
+	f.SystemUUID = strings.ToLower(strings.TrimSpace(f.SystemUUID))
+	f.SerialNumber = strings.TrimSpace(f.SerialNumber)
+	for i := range f.MACs {
+		mac, err := net.ParseMAC(f.MACs[i])
+		if err != nil {
+			e.Errorf("Fingerprint has an invalid MAC %s", f.MACs[i])
+			continue
+		}
+		f.MACs[i] = mac.String()
+	}
+	sort.Strings(f.MACs)
+}
+
+// Score returns how closely f matches other.  A matching system UUID
+// counts for more than a matching serial number, which in turn counts
+// for more than any number of matching MAC addresses.  A score of 0
+// means that nothing matched.  Both fingerprints must be in canonical
+// form.
+func (f *MachineFingerprint) Score(other *MachineFingerprint) int {
+	if f == nil || other == nil {
+		return 0
+	}
+	score := 0
+	if usefulId(f.SystemUUID) && f.SystemUUID == other.SystemUUID {
+		score += 1 << 16
+	}
+	if usefulId(f.SerialNumber) && f.SerialNumber == other.SerialNumber {
+		score += 1 << 15
+	}
+	for _, mac := range f.MACs {
+		for _, omac := range other.MACs {
+			if mac == omac {
+				score++
+			}
+		}
+	}
+	return score
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"net"
+	"reflect"
+	"time"
+)
+
+// InventorySystem describes the system board of a Machine, as
+// reported by DMI.
+//
+// swagger:model
+type InventorySystem struct {
+	// The manufacturer of the system.
+	Vendor string
+	// The product name of the system.
+	Product string
+	// The serial number of the system.
+	SerialNumber string
+	// The SMBIOS system UUID.
+	UUID string
+	// The version of the BIOS or firmware.
+	BIOSVersion string
+}
+
+// InventoryCPU describes a single CPU socket.
+//
+// swagger:model
+type InventoryCPU struct {
+	// The model name of the CPU.
+	Model string
+	// The number of physical cores.
+	Cores int
+	// The number of hardware threads.
+	Threads int
+}
+
+// InventoryDisk describes a single disk.
+//
+// swagger:model
+type InventoryDisk struct {
+	// The name the kernel gave the disk.
+	Name string
+	// The model of the disk.
+	Model string
+	// The serial number of the disk.
+	SerialNumber string
+	// The size of the disk in bytes.
+	Size uint64
+}
+
+// InventoryNIC describes a single network interface.
+//
+// swagger:model
+type InventoryNIC struct {
+	// The name the kernel gave the interface.
+	Name string
+	// The hardware address of the interface.
+	MAC string
+	// The link speed of the interface in Mbit/s, if known.
+	Speed int
+}
+
+// Inventory is the hardware of a Machine as reported by a discovery
+// image or the machine agent.
+//
+// swagger:model
+type Inventory struct {
+	// When the inventory was gathered.  The server fills this in if
+	// it is not set.
+	Collected time.Time
+	System    InventorySystem
+	CPUs      []InventoryCPU
+	// The amount of memory in bytes.
+	Memory uint64
+	Disks  []InventoryDisk
+	NICs   []InventoryNIC
+}
+
+// Validate checks the Inventory for errors and puts the MAC addresses
+// of its NICs into canonical form.
+func (i *Inventory) Validate(e ErrorAdder) {
+	for j := range i.NICs {
+		mac, err := net.ParseMAC(i.NICs[j].MAC)
+		if err != nil {
+			e.Errorf("NIC %s has an invalid MAC %s", i.NICs[j].Name, i.NICs[j].MAC)
+			continue
+		}
+		i.NICs[j].MAC = mac.String()
+	}
+}
+
+// HasMAC returns whether one of the NICs in the Inventory has the
+// passed MAC address.
+func (i *Inventory) HasMAC(mac string) bool {
+	if i == nil {
+		return false
+	}
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	}
+	for _, nic := range i.NICs {
+		if nic.MAC == mac {
+			return true
+		}
+	}
+	return false
+}
+
+// SameHardware returns whether i and other describe the same
+// hardware, ignoring when they were collected.
+func (i *Inventory) SameHardware(other *Inventory) bool {
+	if i == nil || other == nil {
+		return i == other
+	}
+	a, b := *i, *other
+	a.Collected, b.Collected = time.Time{}, time.Time{}
+	return reflect.DeepEqual(a, b)
+}
+
+// Fingerprint returns the identifiers in the Inventory that can be
+// used to recognize the Machine later.
+func (i *Inventory) Fingerprint() *MachineFingerprint {
+	res := &MachineFingerprint{
+		SystemUUID:   i.System.UUID,
+		SerialNumber: i.System.SerialNumber,
+		MACs:         []string{},
+	}
+	for _, nic := range i.NICs {
+		res.MACs = append(res.MACs, nic.MAC)
+	}
+	return res
+}
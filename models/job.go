@@ -18,6 +18,48 @@ type JobAction struct {
 	Path string
 	// required: true
 	Content string
+	// The signature dr-provision made over the action with the
+	// jobSigningKey preference.  Machine agents that have the public
+	// key pinned refuse to run actions without a valid signature.
+	Signature string `json:",omitempty"`
+}
+
+// JobArtifact describes a file a Job stored on the server, such as a
+// sosreport or the output of a benchmark.
+// swagger:model
+type JobArtifact struct {
+	// The name of the artifact.  It is unique within the Job.
+	// required: true
+	Name string
+	// The size of the artifact in bytes.
+	// required: true
+	Size int64
+	// The SHA256 checksum of the artifact, in hex.
+	// required: true
+	Sha256 string
+	// The time the artifact was stored.
+	// required: true
+	Time time.Time
+}
+
+// JobPrune describes a Job that the job retention preferences say
+// should be removed.
+// swagger:model
+type JobPrune struct {
+	// The Job to be removed.
+	// swagger:strfmt uuid
+	Uuid uuid.UUID
+	// The Machine the Job ran on.
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// The Task the Job ran.
+	Task string
+	// The state the Job ended in.
+	State string
+	// The time the Job ended.
+	EndTime time.Time
+	// Why the Job is to be removed.  It is either "count" or "age".
+	Reason string
 }
 
 // swagger:model
@@ -42,13 +84,27 @@ type Job struct {
 	// The stage that the task was created in.
 	// read only: true
 	Stage string
-	// The state the job is in.  Must be one of "created", "running", "failed", "finished", "incomplete"
+	// The state the job is in.  Must be one of "created", "running", "failed", "finished", "incomplete", "cancelled", "skipped"
 	// required: true
 	State string
 	// The final disposition of the job.
-	// Can be one of "reboot","poweroff","stop", or "complete"
+	// Can be one of "reboot","poweroff","stop","complete","timeout", or "lost"
 	// Other substates may be added as time goes on
 	ExitState string
+	// How many times the Task had already been tried when this Job was
+	// created.  It is 0 for the first attempt.
+	Retry int
+	// When the Machine is to be made runnable again to retry the Task
+	// after this Job failed.  It is only set while the Machine waits
+	// out the RetryBackoff of the Task.
+	// read only: true
+	RetryAt time.Time
+	// Structured results reported by the Task while the job ran,
+	// by way of POST /jobs/{uuid}/results.
+	Results map[string]interface{} `json:",omitempty"`
+	// The files the job stored on the server, by way of
+	// PUT /jobs/{uuid}/artifacts/{name}.
+	Artifacts []JobArtifact `json:",omitempty"`
 	// The time the job entered running.
 	StartTime time.Time
 	// The time the job entered failed or finished.
@@ -66,13 +122,13 @@ func (j *Job) Validate() {
 	j.AddError(ValidName("Invalid Stage", j.Stage))
 	switch j.State {
 	case "created", "running", "incomplete":
-	case "failed", "finished":
+	case "failed", "finished", "cancelled", "skipped":
 	default:
 		j.AddError(fmt.Errorf("Invalid State `%s`", j.State))
 	}
 	if j.ExitState != "" {
 		switch j.ExitState {
-		case "reboot", "poweroff", "stop", "complete", "failed":
+		case "reboot", "poweroff", "stop", "complete", "failed", "timeout", "lost":
 		default:
 			j.AddError(fmt.Errorf("Invalid ExitState `%s`", j.ExitState))
 		}
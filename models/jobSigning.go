@@ -0,0 +1,107 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/pborman/uuid"
+)
+
+// jobActionSignature is the ASN.1 form of an ECDSA signature over a
+// JobAction.
+type jobActionSignature struct {
+	R, S *big.Int
+}
+
+// Digest returns the SHA256 digest that is signed for the action at
+// idx in the count actions rendered for job.  Binding the Job, the
+// position, and the number of actions into the digest keeps a signed
+// action from being replayed into another Job, reordered, or having
+// its neighbours dropped.
+func (a *JobAction) Digest(job uuid.UUID, idx, count int) []byte {
+	h := sha256.New()
+	h.Write(job)
+	buf := make([]byte, 8)
+	for _, i := range []int{idx, count} {
+		binary.BigEndian.PutUint64(buf, uint64(i))
+		h.Write(buf)
+	}
+	for _, s := range []string{a.Name, a.Path, a.Content} {
+		binary.BigEndian.PutUint64(buf, uint64(len(s)))
+		h.Write(buf)
+		h.Write([]byte(s))
+	}
+	return h.Sum(nil)
+}
+
+// EncodeJobSigningKey returns the base64 encoded PKIX form of key,
+// which is how the public half of the jobSigningKey preference is
+// handed to machine agents.
+func EncodeJobSigningKey(key *ecdsa.PublicKey) (string, error) {
+	buf, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// ParseJobSigningKey parses a public key encoded by
+// EncodeJobSigningKey.
+func ParseJobSigningKey(s string) (*ecdsa.PublicKey, error) {
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid job signing key: %v", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(buf)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid job signing key: %v", err)
+	}
+	res, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Invalid job signing key: not an ECDSA key")
+	}
+	return res, nil
+}
+
+// VerifyJobActions checks that every action rendered for job carries
+// a valid signature made with the private half of key.
+func VerifyJobActions(key *ecdsa.PublicKey, job uuid.UUID, actions []*JobAction) error {
+	for i, a := range actions {
+		buf, err := base64.StdEncoding.DecodeString(a.Signature)
+		if err != nil || a.Signature == "" {
+			return fmt.Errorf("Action %s of Job %s is not signed", a.Name, job)
+		}
+		sig := &jobActionSignature{}
+		if rest, err := asn1.Unmarshal(buf, sig); err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+			return fmt.Errorf("Action %s of Job %s has a malformed signature", a.Name, job)
+		}
+		if !ecdsa.Verify(key, a.Digest(job, i, len(actions)), sig.R, sig.S) {
+			return fmt.Errorf("Action %s of Job %s has an invalid signature", a.Name, job)
+		}
+	}
+	return nil
+}
+
+// SignJobActions signs every action rendered for job with key,
+// replacing any Signature they already had.
+func SignJobActions(key *ecdsa.PrivateKey, job uuid.UUID, actions []*JobAction) error {
+	for i, a := range actions {
+		r, s, err := ecdsa.Sign(rand.Reader, key, a.Digest(job, i, len(actions)))
+		if err != nil {
+			return err
+		}
+		buf, err := asn1.Marshal(jobActionSignature{R: r, S: s})
+		if err != nil {
+			return err
+		}
+		a.Signature = base64.StdEncoding.EncodeToString(buf)
+	}
+	return nil
+}
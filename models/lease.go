@@ -3,6 +3,8 @@ package models
 import (
 	"net"
 	"time"
+
+	"github.com/pborman/uuid"
 )
 
 var hexDigit = []byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'A', 'B', 'C', 'D', 'E', 'F'}
@@ -49,6 +51,12 @@ type Lease struct {
 	// read only: true
 	// required: true
 	State string
+	// Machine is the UUID of the Machine that owns the Token of
+	// this Lease, if there is one.
+	//
+	// read only: true
+	// swagger:strfmt uuid
+	Machine uuid.UUID `json:",omitempty"`
 }
 
 func (l *Lease) Prefix() string {
@@ -0,0 +1,64 @@
+package models
+
+import "github.com/pborman/uuid"
+
+// The lifecycle States a Machine can be in.
+const (
+	MachineDiscovered   = "discovered"
+	MachineProvisioning = "provisioning"
+	MachineReady        = "ready"
+	MachineInUse        = "in-use"
+	MachineMaintenance  = "maintenance"
+	MachineRetired      = "retired"
+)
+
+// MachineStateTransitions lists the States a Machine is allowed to
+// move to from each State.  Any other change must be forced.
+var MachineStateTransitions = map[string][]string{
+	MachineDiscovered:   {MachineProvisioning, MachineMaintenance, MachineRetired},
+	MachineProvisioning: {MachineReady, MachineMaintenance, MachineRetired},
+	MachineReady:        {MachineProvisioning, MachineInUse, MachineMaintenance, MachineRetired},
+	MachineInUse:        {MachineProvisioning, MachineReady, MachineMaintenance, MachineRetired},
+	MachineMaintenance:  {MachineProvisioning, MachineReady, MachineInUse, MachineRetired},
+	MachineRetired:      {MachineDiscovered},
+}
+
+// ValidMachineState returns whether s is a lifecycle State.
+func ValidMachineState(s string) bool {
+	_, ok := MachineStateTransitions[s]
+	return ok
+}
+
+// MachineStateAllowed returns whether a Machine may move from one
+// State to another without being forced.
+func MachineStateAllowed(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, s := range MachineStateTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MachineStateChange is published as a "state" event on machines
+// whenever a Machine moves from one lifecycle State to another.
+//
+// swagger:model
+type MachineStateChange struct {
+	// The UUID of the Machine.
+	//
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// The name of the Machine.
+	Name string
+	// The State the Machine left.  It is empty when the Machine was
+	// just created.
+	From string
+	// The State the Machine entered.
+	To string
+	// The Stage the Machine is in after the change.
+	Stage string
+}
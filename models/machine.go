@@ -4,10 +4,51 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"time"
 
 	"github.com/pborman/uuid"
 )
 
+// MachineInterface describes one network interface of a Machine.
+//
+// swagger:model
+type MachineInterface struct {
+	// The name of the interface, such as eth0 or bond0.
+	//
+	// required: true
+	Name string
+	// The hardware address of the interface.
+	//
+	// required: true
+	MAC string
+	// The IPv4 address the interface should have, if any.
+	//
+	// swagger:strfmt ipv4
+	Address net.IP `json:",omitempty"`
+	// The name of the Subnet that Address is part of, if any.
+	Subnet string `json:",omitempty"`
+	// What the interface is used for, such as boot, data, or bmc.
+	Role string `json:",omitempty"`
+}
+
+// MachineHeartbeat is what the machine agent running on a Machine last
+// reported about itself.
+//
+// swagger:model
+type MachineHeartbeat struct {
+	// The version of the machine agent.
+	Version string
+	// How many seconds the machine agent has been running for.
+	Uptime int64
+	// The Job the machine agent is working on, if any.
+	//
+	// swagger:strfmt uuid
+	CurrentJob uuid.UUID `json:",omitempty"`
+	// When dr-provision last heard from the machine agent.  It is set
+	// by dr-provision when the heartbeat arrives.
+	LastSeen time.Time
+}
+
 // Machine represents a single bare-metal system that the provisioner
 // should manage the boot environment for.
 // swagger:model
@@ -44,6 +85,21 @@ type Machine struct {
 	Address net.IP
 	// An optional value to indicate tasks and profiles to apply.
 	Stage string
+	// The lifecycle state of the machine: one of discovered,
+	// provisioning, ready, in-use, maintenance, or retired.  New
+	// machines start out discovered, and only some changes of state
+	// are allowed unless forced.
+	State string
+	// The Pool the machine belongs to, if any.  Ready machines in a
+	// Pool can be claimed through the pools API.
+	Pool string `json:",omitempty"`
+	// Who has the machine claimed from its Pool, if anyone.
+	Claim *MachineClaim `json:",omitempty"`
+	// The Workflow the machine is following.  When set, the machine is
+	// placed in the first Stage of the Workflow, and is moved from
+	// Stage to Stage by dr-provision as the Tasks of each Stage
+	// finish.
+	Workflow string `json:",omitempty"`
 	// The boot environment that the machine should boot into.  This
 	// must be the name of a boot environment present in the backend.
 	// If this field is not present or blank, the global default bootenv
@@ -63,6 +119,10 @@ type Machine struct {
 	Tasks []string
 	// required: true
 	CurrentTask int
+	// When the Stage of the machine has TaskDeps, the last Job created
+	// for each of its Tasks, by Task name.  It is cleared whenever the
+	// machine changes Stage.
+	TaskJobs map[string]uuid.UUID `json:",omitempty"`
 	// Indicates if the machine can run jobs or not.  Failed jobs mark the machine
 	// not runnable.
 	//
@@ -75,11 +135,35 @@ type Machine struct {
 	// OS is the operating system that the node is running in
 	//
 	OS string
+	// The most recent hardware inventory reported for the machine.
+	Inventory *Inventory `json:",omitempty"`
+	// The network interfaces of the machine.  Each MAC can only
+	// belong to one interface of one machine.
+	Interfaces []MachineInterface `json:",omitempty"`
+	// Hardware identifiers used to recognize the machine if it is
+	// rediscovered.  It is filled in from the Inventory when one is
+	// reported.
+	Fingerprint *MachineFingerprint `json:",omitempty"`
+	// The last heartbeat from the machine agent, if it has sent one.
+	// Running Jobs are failed when the agent stops sending them.
+	Heartbeat *MachineHeartbeat `json:",omitempty"`
 }
 
 func (n *Machine) Validate() {
 	n.AddError(ValidName("Invalid Name", n.Name))
 	n.AddError(ValidName("Invalid Stage", n.Stage))
+	if n.Workflow != "" {
+		n.AddError(ValidName("Invalid Workflow", n.Workflow))
+	}
+	if n.Pool != "" {
+		n.AddError(ValidName("Invalid Pool", n.Pool))
+	}
+	if n.Claim != nil && n.Pool == "" {
+		n.Errorf("Machine is claimed but not in a Pool")
+	}
+	if n.State != "" && !ValidMachineState(n.State) {
+		n.Errorf("Invalid State %s", n.State)
+	}
 	n.AddError(ValidName("Invalid BootEnv", n.BootEnv))
 	for _, p := range n.Profiles {
 		n.AddError(ValidName("Invalid Profile", p))
@@ -87,6 +171,50 @@ func (n *Machine) Validate() {
 	for _, t := range n.Tasks {
 		n.AddError(ValidName("Invalid Task", t))
 	}
+	names := map[string]bool{}
+	macs := map[string]bool{}
+	for i := range n.Interfaces {
+		intf := &n.Interfaces[i]
+		if intf.Name == "" {
+			n.Errorf("Interface %d has no Name", i)
+		} else if names[intf.Name] {
+			n.Errorf("Interface %s is listed more than once", intf.Name)
+		}
+		names[intf.Name] = true
+		mac, err := net.ParseMAC(intf.MAC)
+		if err != nil {
+			n.Errorf("Interface %s has an invalid MAC %s", intf.Name, intf.MAC)
+			continue
+		}
+		intf.MAC = mac.String()
+		if macs[intf.MAC] {
+			n.Errorf("MAC %s is used by more than one interface", intf.MAC)
+		}
+		macs[intf.MAC] = true
+		if intf.Address != nil && intf.Address.To4() == nil {
+			n.Errorf("Interface %s has an invalid IPv4 address %s", intf.Name, intf.Address)
+		}
+	}
+	if n.Inventory != nil {
+		n.Inventory.Validate(n)
+	}
+	if n.Fingerprint != nil {
+		n.Fingerprint.Validate(n)
+	}
+}
+
+// HasMAC returns whether mac belongs to one of the Interfaces of the
+// Machine, or to a NIC in its Inventory.
+func (n *Machine) HasMAC(mac string) bool {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	}
+	for _, intf := range n.Interfaces {
+		if intf.MAC == mac {
+			return true
+		}
+	}
+	return n.Inventory.HasMAC(mac)
 }
 
 func (n *Machine) UUID() string {
@@ -24,6 +24,10 @@ type Param struct {
 	//
 	// required: true
 	Schema interface{}
+	// Secure implies that values of this Param are encrypted before
+	// they are saved, and that they will be redacted from API responses
+	// and events unless the caller has a params:getSecure claim for it.
+	Secure bool `json:",omitempty"`
 }
 
 func (p *Param) DefaultValue() (interface{}, bool) {
@@ -93,3 +97,45 @@ func (b *Param) ToModels(obj interface{}) []Model {
 	}
 	return res
 }
+
+// ParamError describes a value on a Machine, Profile, or Plugin that
+// does not match the schema of the Param it is for.
+// swagger:model
+type ParamError struct {
+	// Model is the type of the object holding the value.
+	Model string
+	// Key is the key of the object holding the value.
+	Key string
+	// Param is the name of the Param the value is for.
+	Param string
+	// Errors are the reasons the value failed validation.
+	Errors []string
+}
+
+// ParamSource is one layer that provides a value for a parameter.
+type ParamSource struct {
+	// Source is where the value came from.  It is one of "machine",
+	// "profile", "stage", "global", or "default".
+	Source string
+	// Name is the name of the object that holds the value.  For
+	// "stage", this is the name of the Stage.
+	Name string
+	// Profile is the name of the Profile that holds the value when
+	// Source is "stage".
+	Profile string `json:",omitempty"`
+	// Value is the value this layer provides.
+	Value interface{}
+}
+
+// ParamExplanation describes how the effective value of a parameter
+// was arrived at.
+// swagger:model
+type ParamExplanation struct {
+	// Value is the effective value of the parameter.
+	Value interface{}
+	// Source is the layer the effective value comes from.
+	Source *ParamSource
+	// Shadowed are the values from lower layers that Source overrides,
+	// in order of precedence.
+	Shadowed []*ParamSource
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// MachineClaim records who has a Machine claimed from its Pool, and
+// until when.
+//
+// swagger:model
+type MachineClaim struct {
+	// Who claimed the Machine.
+	//
+	// required: true
+	Owner string
+	// When the Machine was claimed.
+	//
+	// required: true
+	Claimed time.Time
+	// When the claim runs out.  The Machine is released back to its
+	// Pool once this time has passed.
+	//
+	// required: true
+	Expires time.Time
+}
+
+// Expired returns whether the claim has run out.
+func (c *MachineClaim) Expired() bool {
+	return c != nil && time.Now().After(c.Expires)
+}
+
+// PoolClaim is what is sent to claim Machines from a Pool.
+//
+// swagger:model
+type PoolClaim struct {
+	// Who is claiming the Machines.
+	//
+	// required: true
+	Owner string
+	// How many Machines to claim.  Defaults to 1.
+	Count int
+	// How long the claim lasts, in seconds.  Defaults to an hour.
+	Duration int
+	// Machine list filters that the claimed Machines must match, in
+	// the same form as the query parameters of a Machine list, such
+	// as Vendor: Eq(Dell).
+	Filter map[string]string `json:",omitempty"`
+}
+
+// PoolRelease is what is sent to release claimed Machines back to a
+// Pool.
+//
+// swagger:model
+type PoolRelease struct {
+	// The owner the Machines were claimed by.
+	//
+	// required: true
+	Owner string
+	// The Machines to release.  If empty, all the Machines claimed by
+	// Owner from the Pool are released.
+	Machines []uuid.UUID `json:",omitempty"`
+}
+
+// PoolStatus summarizes the Machines in a Pool.
+//
+// swagger:model
+type PoolStatus struct {
+	// The name of the Pool.
+	Name string
+	// How many Machines are in the Pool.
+	Total int
+	// How many Machines can be claimed right now.
+	Free int
+	// How many Machines are claimed.
+	Claimed int
+	// How many Machines are neither free nor claimed, such as ones
+	// still being cleaned up.
+	Busy int
+	// The Machines in the Pool.
+	Machines []*Machine `json:",omitempty"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "net"
+import (
+	"net"
+
+	"github.com/pborman/uuid"
+)
 
 // Reservation tracks persistent DHCP IP address reservations.
 //
@@ -30,6 +34,14 @@ type Reservation struct {
 	//
 	// required: true
 	Strategy string
+	// Machine is the UUID of the Machine this Reservation was made
+	// for by the reserveMachineAddresses preference or by reserving
+	// the Interfaces of the Machine.  It is empty for Reservations
+	// made any other way.
+	//
+	// read only: true
+	// swagger:strfmt uuid
+	Machine uuid.UUID `json:",omitempty"`
 }
 
 func (r *Reservation) Prefix() string {
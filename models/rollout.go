@@ -0,0 +1,150 @@
+package models
+
+import "github.com/pborman/uuid"
+
+// The States a Rollout can be in.
+const (
+	RolloutRunning  = "running"
+	RolloutPaused   = "paused"
+	RolloutComplete = "complete"
+	RolloutAborted  = "aborted"
+)
+
+// The Status of each Machine in a Rollout.
+const (
+	RolloutPending   = "pending"
+	RolloutActive    = "active"
+	RolloutSucceeded = "succeeded"
+	RolloutFailed    = "failed"
+)
+
+// RolloutMachine tracks one Machine in a Rollout.
+//
+// swagger:model
+type RolloutMachine struct {
+	// The UUID of the Machine.
+	//
+	// swagger:strfmt uuid
+	Machine uuid.UUID
+	// The name of the Machine.
+	Name string
+	// One of pending, active, succeeded, or failed.
+	Status string
+	// Why the Machine failed, if it did.
+	Reason string `json:",omitempty"`
+}
+
+// Rollout moves the Machines that match a filter to a Stage a few at a
+// time, and stops when too many of them fail.
+//
+// swagger:model
+type Rollout struct {
+	Validation
+	Access
+	Meta
+	// The name of the rollout.
+	//
+	// required: true
+	Name string
+	// A description of this rollout.
+	Description string
+	// Machine list filters picking the Machines to roll out to, in the
+	// same form as the query parameters of a Machine list.  They are
+	// evaluated once, when the Rollout is created.
+	//
+	// required: true
+	Filter map[string]string
+	// The Stage to move the Machines to.
+	//
+	// required: true
+	Stage string
+	// How many Machines may be working through Stage at once.
+	// Defaults to 1.
+	Concurrency int
+	// How many Machines may fail before the Rollout is paused.
+	MaxFailures int
+	// One of running, paused, complete, or aborted.  Setting it to
+	// paused, running, or aborted pauses, resumes, or aborts the
+	// Rollout.
+	State string
+	// Why the Rollout was paused, if it was paused on its own.
+	Reason string `json:",omitempty"`
+	// How many Machines have failed since the Rollout was started or
+	// last resumed.
+	Failures int
+	// The Machines in the Rollout, in the order they are moved.
+	Machines []RolloutMachine
+}
+
+func (r *Rollout) Validate() {
+	r.AddError(ValidName("Invalid Name", r.Name))
+	r.AddError(ValidName("Invalid Stage", r.Stage))
+	if len(r.Filter) == 0 {
+		r.Errorf("Rollout %s has no Filter", r.Name)
+	}
+	if r.Concurrency < 1 {
+		r.Errorf("Concurrency must be at least 1, not %d", r.Concurrency)
+	}
+	if r.MaxFailures < 0 {
+		r.Errorf("MaxFailures must not be negative, not %d", r.MaxFailures)
+	}
+	switch r.State {
+	case RolloutRunning, RolloutPaused, RolloutComplete, RolloutAborted:
+	default:
+		r.Errorf("Invalid State %s", r.State)
+	}
+}
+
+// Count returns how many Machines in the Rollout have status.
+func (r *Rollout) Count(status string) int {
+	res := 0
+	for _, m := range r.Machines {
+		if m.Status == status {
+			res++
+		}
+	}
+	return res
+}
+
+func (r *Rollout) Prefix() string {
+	return "rollouts"
+}
+
+func (r *Rollout) Key() string {
+	return r.Name
+}
+
+func (r *Rollout) Fill() {
+	r.Validation.fill()
+	if r.Meta == nil {
+		r.Meta = Meta{}
+	}
+	if r.Filter == nil {
+		r.Filter = map[string]string{}
+	}
+	if r.Machines == nil {
+		r.Machines = []RolloutMachine{}
+	}
+}
+
+func (r *Rollout) AuthKey() string {
+	return r.Key()
+}
+
+func (b *Rollout) SliceOf() interface{} {
+	s := []*Rollout{}
+	return &s
+}
+
+func (b *Rollout) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*Rollout)
+	res := make([]Model, len(*items))
+	for i, item := range *items {
+		res[i] = Model(item)
+	}
+	return res
+}
+
+func (b *Rollout) SetName(n string) {
+	b.Name = n
+}
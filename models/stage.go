@@ -42,6 +42,12 @@ type Stage struct {
 	BootEnv string
 	// The list of initial machine tasks that the stage should run
 	Tasks []string
+	// Dependencies between the Tasks of the stage.  Each key is one of
+	// Tasks, and its value lists the Tasks that must finish before it
+	// can start.  When set, Tasks whose dependencies have finished
+	// may run at the same time.  When empty, Tasks run one at a time
+	// in order.
+	TaskDeps map[string][]string `json:",omitempty"`
 	// The list of profiles a machine should use while in this stage.
 	// These are used after machine profiles, but before global.
 	Profiles []string
@@ -75,6 +81,64 @@ func (s *Stage) Validate() {
 	for _, t := range s.Tasks {
 		s.AddError(ValidName("Invalid Task", t))
 	}
+	s.validateTaskDeps()
+}
+
+// validateTaskDeps checks that TaskDeps only refers to Tasks in the
+// stage, and that it has no cycles.
+func (s *Stage) validateTaskDeps() {
+	if len(s.TaskDeps) == 0 {
+		return
+	}
+	tasks := map[string]bool{}
+	for _, t := range s.Tasks {
+		if tasks[t] {
+			s.Errorf("Task %s is listed more than once, which TaskDeps does not allow", t)
+		}
+		tasks[t] = true
+	}
+	for t, deps := range s.TaskDeps {
+		if !tasks[t] {
+			s.Errorf("TaskDeps has Task %s, which is not in Tasks", t)
+		}
+		for _, d := range deps {
+			if !tasks[d] {
+				s.Errorf("Task %s depends on %s, which is not in Tasks", t, d)
+			}
+		}
+	}
+	// Repeatedly remove the Tasks whose dependencies have all been
+	// removed.  Anything left over is part of a cycle.
+	left := map[string]bool{}
+	for t := range tasks {
+		left[t] = true
+	}
+	for len(left) > 0 {
+		removed := []string{}
+		for t := range left {
+			ready := true
+			for _, d := range s.TaskDeps[t] {
+				if left[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				removed = append(removed, t)
+			}
+		}
+		if len(removed) == 0 {
+			for _, t := range s.Tasks {
+				if left[t] {
+					s.Errorf("Task %s is part of a dependency cycle", t)
+				}
+			}
+			return
+		}
+		for _, t := range removed {
+			delete(left, t)
+		}
+	}
 }
 
 func (s *Stage) Prefix() string {
@@ -29,6 +29,24 @@ type Task struct {
 	//
 	// required: true
 	OptionalParams []string
+	// Timeout is how many seconds a Job for this Task may run before it
+	// is failed.  0 means the Job may run forever.
+	Timeout int
+	// Retries is how many more times the Task is tried after its Job
+	// fails before the Machine is marked as not Runnable.
+	Retries int
+	// RetryBackoff is how many seconds to wait after a failed Job before
+	// the Task is tried again.  It doubles with each retry.
+	RetryBackoff int
+	// Conditions must all hold for the Machine when a Job is created
+	// for the Task, or the Task is skipped.  Each key is a Machine field
+	// or the name of a Param, which is looked up the same way templates
+	// see it.  Each value uses the same syntax as list filters, such as
+	// Ne(centos-7) for the OS field or Eq(true) for a boolean Param.
+	Conditions map[string]string `json:",omitempty"`
+	// ResultParams maps keys of the Results of a Job for the Task to
+	// the Params on the Machine that they are written to.
+	ResultParams map[string]string `json:",omitempty"`
 }
 
 func (t *Task) Validate() {
@@ -43,6 +61,18 @@ func (t *Task) Validate() {
 	for _, tt := range t.Templates {
 		t.AddError(ValidName("Invalid Template Name", tt.Name))
 	}
+	for _, p := range t.ResultParams {
+		t.AddError(ValidParamName("Invalid Result Param", p))
+	}
+	if t.Timeout < 0 {
+		t.Errorf("Timeout must not be negative, not %d", t.Timeout)
+	}
+	if t.Retries < 0 {
+		t.Errorf("Retries must not be negative, not %d", t.Retries)
+	}
+	if t.RetryBackoff < 0 {
+		t.Errorf("RetryBackoff must not be negative, not %d", t.RetryBackoff)
+	}
 }
 
 func (t *Task) Prefix() string {
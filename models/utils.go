@@ -51,11 +51,13 @@ func All() []Model {
 		&Pref{},
 		&Profile{},
 		&Reservation{},
+		&Rollout{},
 		&Stage{},
 		&Subnet{},
 		&Task{},
 		&Template{},
 		&User{},
+		&Workflow{},
 	}
 }
 
@@ -84,6 +86,8 @@ func New(kind string) (Slicer, error) {
 		res = &Profile{}
 	case "reservations", "reservation":
 		res = &Reservation{}
+	case "rollouts", "rollout":
+		res = &Rollout{}
 	case "stages", "stage":
 		res = &Stage{}
 	case "subnets", "subnet":
@@ -94,6 +98,8 @@ func New(kind string) (Slicer, error) {
 		res = &Template{}
 	case "users", "user":
 		res = &User{}
+	case "workflows", "workflow":
+		res = &Workflow{}
 	default:
 		return nil, fmt.Errorf("No such Model: %s", kind)
 	}
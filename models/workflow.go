@@ -0,0 +1,158 @@
+package models
+
+// WorkflowStage is one step of a Workflow.
+//
+// swagger:model
+type WorkflowStage struct {
+	// The Stage a Machine is placed in for this step.
+	//
+	// required: true
+	Stage string
+	// The Stage to move the Machine to when the last Task of this
+	// Stage finishes.  If empty, the Machine moves to the next entry in
+	// the Workflow's Stages, and the Workflow is complete when this is
+	// the last entry.
+	OnSuccess string
+	// The Stage to move the Machine to when a Task in this Stage
+	// fails.  If empty, the Machine stays where it is and is marked
+	// not Runnable, as it would be without a Workflow.
+	OnFailure string
+}
+
+// Workflow is an ordered chain of Stages that a Machine moves through
+// on its own as the Tasks of each Stage finish.
+//
+// swagger:model
+type Workflow struct {
+	Validation
+	Access
+	Meta
+	// The name of the workflow.
+	//
+	// required: true
+	Name string
+	// A description of this workflow.
+	Description string
+	// The Stages of the workflow.  A Machine that is assigned this
+	// Workflow starts in the first one.  A Stage may only appear
+	// once.
+	//
+	// required: true
+	Stages []WorkflowStage
+}
+
+func (w *Workflow) Validate() {
+	w.AddError(ValidName("Invalid Name", w.Name))
+	if len(w.Stages) == 0 {
+		w.Errorf("Workflow %s has no Stages", w.Name)
+	}
+	seen := map[string]int{}
+	for i, s := range w.Stages {
+		w.AddError(ValidName("Invalid Stage", s.Stage))
+		if at, ok := seen[s.Stage]; ok {
+			w.Errorf("Stage %s appears at %d and %d", s.Stage, at, i)
+		}
+		seen[s.Stage] = i
+	}
+	for _, s := range w.Stages {
+		for _, next := range []string{s.OnSuccess, s.OnFailure} {
+			if next == "" {
+				continue
+			}
+			if _, ok := seen[next]; !ok {
+				w.Errorf("Stage %s transitions to %s, which is not part of the Workflow", s.Stage, next)
+			}
+		}
+	}
+}
+
+// Find returns the index of stage in the Workflow, or -1 if it is not
+// part of the Workflow.
+func (w *Workflow) Find(stage string) int {
+	for i := range w.Stages {
+		if w.Stages[i].Stage == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// Next returns the Stage that a Machine in stage should move to.  It
+// returns an empty string if the Machine should stay where it is.
+func (w *Workflow) Next(stage string, success bool) string {
+	i := w.Find(stage)
+	if i == -1 {
+		return ""
+	}
+	if !success {
+		return w.Stages[i].OnFailure
+	}
+	if w.Stages[i].OnSuccess != "" {
+		return w.Stages[i].OnSuccess
+	}
+	if i+1 < len(w.Stages) {
+		return w.Stages[i+1].Stage
+	}
+	return ""
+}
+
+func (w *Workflow) Prefix() string {
+	return "workflows"
+}
+
+func (w *Workflow) Key() string {
+	return w.Name
+}
+
+func (w *Workflow) Fill() {
+	w.Validation.fill()
+	if w.Meta == nil {
+		w.Meta = Meta{}
+	}
+	if w.Stages == nil {
+		w.Stages = []WorkflowStage{}
+	}
+}
+
+func (w *Workflow) AuthKey() string {
+	return w.Key()
+}
+
+func (b *Workflow) SliceOf() interface{} {
+	s := []*Workflow{}
+	return &s
+}
+
+func (b *Workflow) ToModels(obj interface{}) []Model {
+	items := obj.(*[]*Workflow)
+	res := make([]Model, len(*items))
+	for i, item := range *items {
+		res[i] = Model(item)
+	}
+	return res
+}
+
+func (b *Workflow) SetName(n string) {
+	b.Name = n
+}
+
+// WorkflowPosition describes where a Machine is in its Workflow.
+//
+// swagger:model
+type WorkflowPosition struct {
+	// The Workflow the Machine is following.
+	Workflow string
+	// The Stage the Machine is in.
+	Stage string
+	// The index of Stage in the Workflow's Stages, or -1 if the
+	// Machine has been moved out of the Workflow.
+	Index int
+	// The number of Stages in the Workflow.
+	Count int
+	// The Stage the Machine will move to when its Tasks finish.
+	OnSuccess string
+	// The Stage the Machine will move to if one of its Tasks fails.
+	OnFailure string
+	// Whether the Machine has finished the last Stage of the Workflow.
+	Complete bool
+}
@@ -37,6 +37,7 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/digitalrebar/logger"
 	"github.com/digitalrebar/provision"
@@ -63,6 +64,13 @@ type ProgOpts struct {
 	OurAddress          string `long:"static-ip" description:"IP address to advertise for the static HTTP file server" default:""`
 	ForceStatic         bool   `long:"force-static" description:"Force the system to always use the static IP."`
 
+	ReserveMachineAddresses bool  `long:"reserve-machine-addresses" description:"Automatically reserve the addresses of machines with known MAC addresses"`
+	JobArtifactMaxSize      int64 `long:"job-artifact-max-size" description:"The most bytes of artifacts a single job can store" default:"104857600"`
+	JobRetentionCount       int   `long:"job-retention-count" description:"The number of finished jobs to keep for each machine, or 0 to keep them all" default:"0"`
+	JobRetentionAge         int   `long:"job-retention-age" description:"The number of seconds to keep finished jobs for, or 0 to keep them forever" default:"0"`
+	JobRetentionFailedAge   int   `long:"job-retention-failed-age" description:"The number of seconds to keep failed jobs for, or 0 to use job-retention-age" default:"0"`
+	AgentHeartbeatTimeout   int   `long:"agent-heartbeat-timeout" description:"The number of seconds a machine agent can go without a heartbeat before its running jobs fail, or 0 to never fail them" default:"120"`
+
 	BackEndType    string `long:"backend" description:"Storage to use for persistent data. Can be either 'consul', 'directory', or a store URI" default:"directory"`
 	LocalContent   string `long:"local-content" description:"Storage to use for local overrides." default:"directory:///etc/dr-provision?codec=yaml"`
 	DefaultContent string `long:"default-content" description:"Store URL for local content" default:"file:///usr/share/dr-provision/default.yaml?codec=yaml"`
@@ -175,19 +183,25 @@ func Server(c_opts *ProgOpts) {
 		c_opts.ApiPort,
 		buf.Log("backend"),
 		map[string]string{
-			"debugBootEnv":        c_opts.DebugBootEnv,
-			"debugDhcp":           c_opts.DebugDhcp,
-			"debugRenderer":       c_opts.DebugRenderer,
-			"debugFrontend":       c_opts.DebugFrontend,
-			"debugPlugins":        c_opts.DebugPlugins,
-			"defaultStage":        c_opts.DefaultStage,
-			"logLevel":            c_opts.DefaultLogLevel,
-			"defaultBootEnv":      c_opts.DefaultBootEnv,
-			"unknownBootEnv":      c_opts.UnknownBootEnv,
-			"knownTokenTimeout":   fmt.Sprintf("%d", c_opts.KnownTokenTimeout),
-			"unknownTokenTimeout": fmt.Sprintf("%d", c_opts.UnknownTokenTimeout),
-			"baseTokenSecret":     c_opts.BaseTokenSecret,
-			"systemGrantorSecret": c_opts.SystemGrantorSecret,
+			"debugBootEnv":            c_opts.DebugBootEnv,
+			"debugDhcp":               c_opts.DebugDhcp,
+			"debugRenderer":           c_opts.DebugRenderer,
+			"debugFrontend":           c_opts.DebugFrontend,
+			"debugPlugins":            c_opts.DebugPlugins,
+			"defaultStage":            c_opts.DefaultStage,
+			"logLevel":                c_opts.DefaultLogLevel,
+			"defaultBootEnv":          c_opts.DefaultBootEnv,
+			"unknownBootEnv":          c_opts.UnknownBootEnv,
+			"knownTokenTimeout":       fmt.Sprintf("%d", c_opts.KnownTokenTimeout),
+			"unknownTokenTimeout":     fmt.Sprintf("%d", c_opts.UnknownTokenTimeout),
+			"reserveMachineAddresses": fmt.Sprintf("%v", c_opts.ReserveMachineAddresses),
+			"jobArtifactMaxSize":      fmt.Sprintf("%d", c_opts.JobArtifactMaxSize),
+			"jobRetentionCount":       fmt.Sprintf("%d", c_opts.JobRetentionCount),
+			"jobRetentionAge":         fmt.Sprintf("%d", c_opts.JobRetentionAge),
+			"jobRetentionFailedAge":   fmt.Sprintf("%d", c_opts.JobRetentionFailedAge),
+			"agentHeartbeatTimeout":   fmt.Sprintf("%d", c_opts.AgentHeartbeatTimeout),
+			"baseTokenSecret":         c_opts.BaseTokenSecret,
+			"systemGrantorSecret":     c_opts.SystemGrantorSecret,
 		},
 		publishers)
 
@@ -220,6 +234,10 @@ func Server(c_opts *ProgOpts) {
 		services = append(services, pc)
 	}
 
+	services = append(services, midlayer.StartClaimReaper(dt, buf.Log("backend"), time.Minute))
+	services = append(services, midlayer.StartJobReaper(dt, buf.Log("backend"), 10*time.Second))
+	services = append(services, midlayer.StartJobPruner(dt, buf.Log("backend"), 10*time.Minute))
+
 	fe := frontend.NewFrontend(dt, buf.Log("frontend"),
 		c_opts.OurAddress,
 		c_opts.ApiPort, c_opts.StaticPort, c_opts.DhcpPort, c_opts.BinlPort,